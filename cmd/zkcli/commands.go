@@ -0,0 +1,768 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// errUsage is wrapped by the errors of misused commands.
+var errUsage = errors.New("usage")
+
+// conn is the part of *zk.Conn the commands use.
+type conn interface {
+	zk.Client
+	DeleteRecursive(path string, opts *zk.DeleteOptions) ([]string, error)
+}
+
+// cli runs commands. It connects when the first command that needs a
+// session runs, and keeps the session for the following ones.
+type cli struct {
+	server     string   // connection string or zk:// URL
+	servers    []string // for the four letter word commands
+	flwTimeout time.Duration
+	dial       func(server string) (conn, error)
+	c          conn
+	cwd        string // relative paths are resolved against it, "/" if empty
+	human      bool   // print Stats for people rather than scripts
+
+	stdin     io.Reader // where data is read from if not given, or nil
+	out       io.Writer
+	errOut    io.Writer
+	interrupt <-chan os.Signal // stops watch, if set
+}
+
+type command struct {
+	args string // synopsis of the flags and arguments
+	help string
+	run  func(cl *cli, args []string) error
+}
+
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"cd":      {"[path]", "change the node relative paths are resolved against, / if not given", cmdCd},
+		"pwd":     {"", "print the node relative paths are resolved against", cmdPwd},
+		"ls":      {"[-R] [path]", "list the children of path, or with -R the paths of the subtree", cmdLs},
+		"get":     {"[-raw] path", "print the data of path, followed by a newline unless -raw", cmdGet},
+		"stat":    {"[-h] path", "print the Stat of path as name=value lines, or with -h for people", cmdStat},
+		"set":     {"[-v version] path [data]", "set the data of path, read from standard input if not given", cmdSet},
+		"create":  {"[-e] [-s] [-c] [-t ttl] [-acl acl,...] path [data]", "create an ephemeral, sequential, container or TTL node and print its path", cmdCreate},
+		"rm":      {"[-v version] path", "delete path", cmdRm},
+		"rmr":     {"[-n] path", "delete path and its descendants, printing the deleted paths; -n only prints them", cmdRmr},
+		"getacl":  {"path", "print the ACL of path as scheme:id:perms lines", cmdGetACL},
+		"setacl":  {"[-v version] path acl...", "set the ACL of path, given as scheme:id:perms entries such as world:anyone:cdrwa", cmdSetACL},
+		"addauth": {"scheme auth", "add credentials to the session", cmdAddAuth},
+		"sync":    {"path", "wait for the server to catch up with the leader on path", cmdSync},
+		"watch":   {"[-n count] path", "print the events of path and its children as JSON lines, stopping after count events", cmdWatch},
+		"srvr":    {"", "print the srvr output of every server as JSON lines", cmdSrvr},
+		"cons":    {"", "print the connections of every server as JSON lines", cmdCons},
+		"ruok":    {"", "check that every server is running", cmdRuok},
+		"diff":    {"[-with connstring] [-ignore-acl] [-ignore-ephemeral] [-ignore-owner] [-json] [-q] path [path2]", "compare the subtree at path with the one at path2, or at path on the -with servers, and fail if they differ", cmdDiff},
+		"help":    {"", "list the commands", cmdHelp},
+	}
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func printCommands(w io.Writer) {
+	for _, name := range commandNames() {
+		cmd := commands[name]
+		fmt.Fprintf(w, "  %s %s\n    \t%s\n", name, cmd.args, cmd.help)
+	}
+}
+
+// run runs the command args[0].
+func (cl *cli) run(args []string) error {
+	cmd := commands[args[0]]
+	if cmd == nil {
+		return fmt.Errorf("%w: unknown command %q", errUsage, args[0])
+	}
+	return cmd.run(cl, args[1:])
+}
+
+// conn returns the connection, connecting first if needed.
+func (cl *cli) conn() (conn, error) {
+	if cl.c == nil {
+		c, err := cl.dial(cl.server)
+		if err != nil {
+			return nil, err
+		}
+		cl.c = c
+	}
+	return cl.c, nil
+}
+
+func (cl *cli) close() {
+	if cl.c != nil {
+		cl.c.Close()
+		cl.c = nil
+	}
+}
+
+// data returns the optional data argument, or what standard input holds.
+func (cl *cli) data(args []string) ([]byte, error) {
+	if len(args) > 0 {
+		return []byte(args[0]), nil
+	}
+	if cl.stdin == nil {
+		return []byte{}, nil
+	}
+	return io.ReadAll(cl.stdin)
+}
+
+// resolve returns the absolute, cleaned form of p.
+func (cl *cli) resolve(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = joinPath(cl.wd(), p)
+	}
+	return path.Clean(p)
+}
+
+func (cl *cli) wd() string {
+	if cl.cwd == "" {
+		return "/"
+	}
+	return cl.cwd
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseArgs parses the flags of fs and checks that between min and max
+// arguments follow them, max < 0 meaning no limit.
+func parseArgs(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("%w: %s %s: %v", errUsage, fs.Name(), commands[fs.Name()].args, err)
+	}
+	if n := fs.NArg(); n < min || (max >= 0 && n > max) {
+		return nil, fmt.Errorf("%w: %s %s", errUsage, fs.Name(), commands[fs.Name()].args)
+	}
+	return fs.Args(), nil
+}
+
+func cmdCd(cl *cli, args []string) error {
+	args, err := parseArgs(newFlagSet("cd"), args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		cl.cwd = "/"
+		return nil
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	dir := cl.resolve(args[0])
+	if ok, _, err := c.Exists(dir); err != nil {
+		return err
+	} else if !ok {
+		return zk.ErrNoNode
+	}
+	cl.cwd = dir
+	return nil
+}
+
+func cmdPwd(cl *cli, args []string) error {
+	if _, err := parseArgs(newFlagSet("pwd"), args, 0, 0); err != nil {
+		return err
+	}
+	fmt.Fprintln(cl.out, cl.wd())
+	return nil
+}
+
+func cmdLs(cl *cli, args []string) error {
+	fs := newFlagSet("ls")
+	recursive := fs.Bool("R", false, "")
+	args, err := parseArgs(fs, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	dir := cl.wd()
+	if len(args) > 0 {
+		dir = cl.resolve(args[0])
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	if *recursive {
+		return listTree(c, cl.out, dir, true)
+	}
+	children, _, err := c.Children(dir)
+	if err != nil {
+		return err
+	}
+	sort.Strings(children)
+	for _, name := range children {
+		fmt.Fprintln(cl.out, name)
+	}
+	return nil
+}
+
+// listTree prints path and its descendants, parents before their children
+// and siblings sorted. Descendants deleted meanwhile are skipped.
+func listTree(c conn, w io.Writer, path string, root bool) error {
+	children, _, err := c.Children(path)
+	if errors.Is(err, zk.ErrNoNode) && !root {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, path)
+	sort.Strings(children)
+	for _, name := range children {
+		if err := listTree(c, w, joinPath(path, name), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func joinPath(parent, child string) string {
+	if parent == "/" {
+		return "/" + child
+	}
+	return parent + "/" + child
+}
+
+func cmdGet(cl *cli, args []string) error {
+	fs := newFlagSet("get")
+	raw := fs.Bool("raw", false, "")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	data, _, err := c.Get(cl.resolve(args[0]))
+	if err != nil {
+		return err
+	}
+	if !*raw {
+		data = append(data, '\n')
+	}
+	_, err = cl.out.Write(data)
+	return err
+}
+
+func cmdStat(cl *cli, args []string) error {
+	fs := newFlagSet("stat")
+	human := fs.Bool("h", cl.human, "")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	exists, stat, err := c.Exists(cl.resolve(args[0]))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return zk.ErrNoNode
+	}
+	if *human {
+		printStatHuman(cl.out, stat, c.SessionID(), time.Now())
+	} else {
+		printStat(cl.out, stat)
+	}
+	return nil
+}
+
+func printStat(w io.Writer, s *zk.Stat) {
+	fmt.Fprintf(w, "czxid=0x%x\nmzxid=0x%x\npzxid=0x%x\nctime=%d\nmtime=%d\n", s.Czxid, s.Mzxid, s.Pzxid, s.Ctime, s.Mtime)
+	fmt.Fprintf(w, "version=%d\ncversion=%d\naversion=%d\n", s.Version, s.Cversion, s.Aversion)
+	fmt.Fprintf(w, "ephemeralOwner=0x%x\ndataLength=%d\nnumChildren=%d\n", s.EphemeralOwner, s.DataLength, s.NumChildren)
+}
+
+// printStatHuman prints a Stat with readable times and sizes. sessionID
+// marks the nodes owned by the session.
+func printStatHuman(w io.Writer, s *zk.Stat, sessionID int64, now time.Time) {
+	owner := "none"
+	if s.EphemeralOwner != 0 {
+		owner = fmt.Sprintf("0x%x", s.EphemeralOwner)
+		if s.EphemeralOwner == sessionID {
+			owner += " (this session)"
+		}
+	}
+	fmt.Fprintf(w, "czxid:          0x%x\n", s.Czxid)
+	fmt.Fprintf(w, "mzxid:          0x%x\n", s.Mzxid)
+	fmt.Fprintf(w, "pzxid:          0x%x\n", s.Pzxid)
+	fmt.Fprintf(w, "ctime:          %s\n", humanTime(s.Ctime, now))
+	fmt.Fprintf(w, "mtime:          %s\n", humanTime(s.Mtime, now))
+	fmt.Fprintf(w, "version:        %d\n", s.Version)
+	fmt.Fprintf(w, "cversion:       %d\n", s.Cversion)
+	fmt.Fprintf(w, "aversion:       %d\n", s.Aversion)
+	fmt.Fprintf(w, "ephemeralOwner: %s\n", owner)
+	fmt.Fprintf(w, "dataLength:     %s\n", humanSize(s.DataLength))
+	fmt.Fprintf(w, "numChildren:    %d\n", s.NumChildren)
+}
+
+// humanTime formats milliseconds since the epoch as a local time followed by
+// how long ago it was.
+func humanTime(ms int64, now time.Time) string {
+	t := time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+	d := now.Sub(t)
+	var ago string
+	switch {
+	case d < 0:
+		ago = "in the future"
+	case d < time.Second:
+		ago = "just now"
+	case d < 48*time.Hour:
+		ago = d.Truncate(time.Second).String() + " ago"
+	default:
+		ago = fmt.Sprintf("%d days ago", d/(24*time.Hour))
+	}
+	return fmt.Sprintf("%s (%s)", t.Format("2006-01-02 15:04:05.000 MST"), ago)
+}
+
+// humanSize formats a number of bytes with binary units.
+func humanSize(n int32) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	size, unit := float64(n)/1024, "KiB"
+	if size >= 1024 {
+		size, unit = size/1024, "MiB"
+	}
+	return fmt.Sprintf("%.1f %s (%d bytes)", size, unit, n)
+}
+
+func cmdSet(cl *cli, args []string) error {
+	fs := newFlagSet("set")
+	version := fs.Int("v", -1, "")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	data, err := cl.data(args[1:])
+	if err != nil {
+		return err
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	_, err = c.Set(cl.resolve(args[0]), data, int32(*version))
+	return err
+}
+
+func cmdCreate(cl *cli, args []string) error {
+	fs := newFlagSet("create")
+	ephemeral := fs.Bool("e", false, "")
+	sequential := fs.Bool("s", false, "")
+	container := fs.Bool("c", false, "")
+	ttl := fs.Duration("t", 0, "")
+	aclSpec := fs.String("acl", "", "")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	if *container && (*ephemeral || *sequential || *ttl != 0) || *ttl != 0 && *ephemeral {
+		return fmt.Errorf("%w: create: -c excludes -e, -s and -t, and -t excludes -e", errUsage)
+	}
+	acl := zk.WorldACL(zk.PermAll)
+	if *aclSpec != "" {
+		if acl, err = parseACL(strings.Split(*aclSpec, ",")); err != nil {
+			return err
+		}
+	}
+	data, err := cl.data(args[1:])
+	if err != nil {
+		return err
+	}
+	var flags int32
+	if *ephemeral {
+		flags |= zk.FlagEphemeral
+	}
+	if *sequential {
+		flags |= zk.FlagSequence
+	}
+
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	var path string
+	switch {
+	case *container:
+		path, _, err = c.CreateContainer(cl.resolve(args[0]), data, acl)
+	case *ttl != 0:
+		path, _, err = c.CreateTTL(cl.resolve(args[0]), data, flags, acl, *ttl)
+	default:
+		path, err = c.Create(cl.resolve(args[0]), data, flags, acl)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cl.out, path)
+	return nil
+}
+
+func cmdRm(cl *cli, args []string) error {
+	fs := newFlagSet("rm")
+	version := fs.Int("v", -1, "")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	return c.Delete(cl.resolve(args[0]), int32(*version))
+}
+
+func cmdRmr(cl *cli, args []string) error {
+	fs := newFlagSet("rmr")
+	dryRun := fs.Bool("n", false, "")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	deleted, err := c.DeleteRecursive(cl.resolve(args[0]), &zk.DeleteOptions{DryRun: *dryRun})
+	for _, path := range deleted {
+		fmt.Fprintln(cl.out, path)
+	}
+	return err
+}
+
+func cmdGetACL(cl *cli, args []string) error {
+	args, err := parseArgs(newFlagSet("getacl"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	acl, _, err := c.GetACL(cl.resolve(args[0]))
+	if err != nil {
+		return err
+	}
+	for _, a := range acl {
+		fmt.Fprintln(cl.out, aclEntry(a))
+	}
+	return nil
+}
+
+// aclEntry formats an ACL entry as scheme:id:perms.
+func aclEntry(a zk.ACL) string {
+	return a.Scheme + ":" + a.ID + ":" + formatPerms(a.Perms)
+}
+
+func cmdSetACL(cl *cli, args []string) error {
+	fs := newFlagSet("setacl")
+	version := fs.Int("v", -1, "")
+	args, err := parseArgs(fs, args, 2, -1)
+	if err != nil {
+		return err
+	}
+	var specs []string
+	for _, arg := range args[1:] {
+		specs = append(specs, strings.Split(arg, ",")...)
+	}
+	acl, err := parseACL(specs)
+	if err != nil {
+		return err
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	_, err = c.SetACL(cl.resolve(args[0]), acl, int32(*version))
+	return err
+}
+
+// permLetters are the letters of the permissions, in the order ZooKeeper's
+// own CLI prints them.
+var permLetters = []struct {
+	letter byte
+	perm   int32
+}{
+	{'c', zk.PermCreate},
+	{'d', zk.PermDelete},
+	{'r', zk.PermRead},
+	{'w', zk.PermWrite},
+	{'a', zk.PermAdmin},
+}
+
+func formatPerms(perms int32) string {
+	var b []byte
+	for _, p := range permLetters {
+		if perms&p.perm != 0 {
+			b = append(b, p.letter)
+		}
+	}
+	return string(b)
+}
+
+// parseACL parses scheme:id:perms entries. The id may contain colons, as
+// digest ids do.
+func parseACL(specs []string) ([]zk.ACL, error) {
+	acl := make([]zk.ACL, 0, len(specs))
+	for _, spec := range specs {
+		first, last := strings.Index(spec, ":"), strings.LastIndex(spec, ":")
+		if first < 0 || first == last {
+			return nil, fmt.Errorf("%w: ACL entry %q isn't scheme:id:perms", errUsage, spec)
+		}
+		a := zk.ACL{Scheme: spec[:first], ID: spec[first+1 : last]}
+	letters:
+		for _, c := range []byte(spec[last+1:]) {
+			for _, p := range permLetters {
+				if c == p.letter {
+					a.Perms |= p.perm
+					continue letters
+				}
+			}
+			return nil, fmt.Errorf("%w: unknown permission %q in ACL entry %q", errUsage, c, spec)
+		}
+		acl = append(acl, a)
+	}
+	return acl, nil
+}
+
+func cmdAddAuth(cl *cli, args []string) error {
+	args, err := parseArgs(newFlagSet("addauth"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	return c.AddAuth(args[0], []byte(args[1]))
+}
+
+func cmdSync(cl *cli, args []string) error {
+	args, err := parseArgs(newFlagSet("sync"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	_, err = c.Sync(cl.resolve(args[0]))
+	return err
+}
+
+// watchEvent is a line printed by watch.
+type watchEvent struct {
+	Time  time.Time `json:"time"`
+	Type  string    `json:"type"`
+	Path  string    `json:"path"`
+	Error string    `json:"error,omitempty"`
+}
+
+func cmdWatch(cl *cli, args []string) error {
+	fs := newFlagSet("watch")
+	count := fs.Int("n", 0, "")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	path := cl.resolve(args[0])
+	enc := json.NewEncoder(cl.out)
+	for n := 0; *count <= 0 || n < *count; n++ {
+		// Watches fire once, so they are set again after every event.
+		exists, _, nodeEvents, err := c.ExistsW(path)
+		if err != nil {
+			return err
+		}
+		var childEvents <-chan zk.Event
+		if exists {
+			_, _, childEvents, err = c.ChildrenW(path)
+			// If the node was just deleted, nodeEvents reports it.
+			if err != nil && !errors.Is(err, zk.ErrNoNode) {
+				return err
+			}
+		}
+
+		var ev zk.Event
+		var ok bool
+		select {
+		case ev, ok = <-nodeEvents:
+		case ev, ok = <-childEvents:
+		case <-cl.interrupt:
+			return nil
+		}
+		if !ok {
+			return zk.ErrClosing
+		}
+		line := watchEvent{Time: time.Now().UTC(), Type: ev.Type.String(), Path: ev.Path}
+		if ev.Err != nil {
+			line.Error = ev.Err.Error()
+		}
+		if err := enc.Encode(&line); err != nil {
+			return err
+		}
+		if ev.Err != nil {
+			return ev.Err
+		}
+	}
+	return nil
+}
+
+// srvrLine is a line printed by srvr.
+type srvrLine struct {
+	Server      string `json:"server"`
+	Mode        string `json:"mode,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Zxid        string `json:"zxid,omitempty"`
+	NodeCount   int64  `json:"nodeCount"`
+	Connections int64  `json:"connections"`
+	Outstanding int64  `json:"outstanding"`
+	Sent        int64  `json:"sent"`
+	Received    int64  `json:"received"`
+	MinLatency  int64  `json:"minLatency"`
+	AvgLatency  int64  `json:"avgLatency"`
+	MaxLatency  int64  `json:"maxLatency"`
+	Error       string `json:"error,omitempty"`
+}
+
+func cmdSrvr(cl *cli, args []string) error {
+	if _, err := parseArgs(newFlagSet("srvr"), args, 0, 0); err != nil {
+		return err
+	}
+	stats, ok := zk.FLWSrvr(cl.servers, cl.flwTimeout)
+	enc := json.NewEncoder(cl.out)
+	for i, s := range stats {
+		line := srvrLine{Server: cl.servers[i]}
+		if s.Error != nil {
+			line.Error = s.Error.Error()
+		} else {
+			line.Mode = s.Mode.String()
+			line.Version = s.Version
+			line.Zxid = fmt.Sprintf("0x%x", int64(s.Epoch)<<32|int64(uint32(s.Counter)))
+			line.NodeCount, line.Connections, line.Outstanding = s.NodeCount, s.Connections, s.Outstanding
+			line.Sent, line.Received = s.Sent, s.Received
+			line.MinLatency, line.AvgLatency, line.MaxLatency = s.MinLatency, s.AvgLatency, s.MaxLatency
+		}
+		if err := enc.Encode(&line); err != nil {
+			return err
+		}
+	}
+	if !ok {
+		return errors.New("srvr failed on some servers")
+	}
+	return nil
+}
+
+// consLine is a line printed by cons: a client connection, or the error of
+// a server.
+type consLine struct {
+	Server        string     `json:"server"`
+	Addr          string     `json:"addr,omitempty"`
+	SessionID     string     `json:"sessionId,omitempty"`
+	Timeout       int32      `json:"timeout,omitempty"`
+	Queued        int64      `json:"queued"`
+	Received      int64      `json:"received"`
+	Sent          int64      `json:"sent"`
+	LastOperation string     `json:"lastOperation,omitempty"`
+	Lzxid         string     `json:"lzxid,omitempty"`
+	Established   *time.Time `json:"established,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+func cmdCons(cl *cli, args []string) error {
+	if _, err := parseArgs(newFlagSet("cons"), args, 0, 0); err != nil {
+		return err
+	}
+	servers, ok := zk.FLWCons(cl.servers, cl.flwTimeout)
+	enc := json.NewEncoder(cl.out)
+	for i, s := range servers {
+		lines := []consLine{}
+		if s.Error != nil {
+			lines = append(lines, consLine{Server: cl.servers[i], Error: s.Error.Error()})
+		}
+		for _, client := range s.Clients {
+			line := consLine{
+				Server:        cl.servers[i],
+				Addr:          client.Addr,
+				SessionID:     fmt.Sprintf("0x%x", client.SessionID),
+				Timeout:       client.Timeout,
+				Queued:        client.Queued,
+				Received:      client.Received,
+				Sent:          client.Sent,
+				LastOperation: client.LastOperation,
+				Lzxid:         fmt.Sprintf("0x%x", client.Lzxid),
+			}
+			if !client.Established.IsZero() {
+				established := client.Established
+				line.Established = &established
+			}
+			if client.Error != nil {
+				line.Error = client.Error.Error()
+			}
+			lines = append(lines, line)
+		}
+		for i := range lines {
+			if err := enc.Encode(&lines[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if !ok {
+		return errors.New("cons failed on some servers")
+	}
+	return nil
+}
+
+func cmdRuok(cl *cli, args []string) error {
+	if _, err := parseArgs(newFlagSet("ruok"), args, 0, 0); err != nil {
+		return err
+	}
+	failed := false
+	for i, ok := range zk.FLWRuok(cl.servers, cl.flwTimeout) {
+		status := "imok"
+		if !ok {
+			status, failed = "not ok", true
+		}
+		fmt.Fprintf(cl.out, "%s %s\n", cl.servers[i], status)
+	}
+	if failed {
+		return errors.New("some servers are not ok")
+	}
+	return nil
+}
+
+func cmdHelp(cl *cli, args []string) error {
+	printCommands(cl.out)
+	return nil
+}
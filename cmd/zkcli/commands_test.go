@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// fakeConn adds the methods of *zk.Conn that FakeClient lacks.
+type fakeConn struct {
+	*zk.FakeClient
+}
+
+func (f fakeConn) DeleteRecursive(path string, opts *zk.DeleteOptions) ([]string, error) {
+	var nodes []string
+	var list func(path string) error
+	list = func(path string) error {
+		children, _, err := f.Children(path)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := list(joinPath(path, child)); err != nil {
+				return err
+			}
+		}
+		nodes = append(nodes, path)
+		return nil
+	}
+	if err := list(path); err != nil || opts.DryRun {
+		return nodes, err
+	}
+	for i, node := range nodes {
+		if err := f.Delete(node, -1); err != nil {
+			return nodes[:i], err
+		}
+	}
+	return nodes, nil
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newTestCLI(paths ...string) (*cli, *zk.FakeClient, *syncBuffer) {
+	f := zk.NewFakeClient()
+	for _, path := range paths {
+		if _, err := f.Create(path, []byte(path), 0, zk.WorldACL(zk.PermAll)); err != nil {
+			panic(err)
+		}
+	}
+	out := &syncBuffer{}
+	cl := &cli{
+		dial:   func(string) (conn, error) { return fakeConn{f}, nil },
+		out:    out,
+		errOut: io.Discard,
+	}
+	return cl, f, out
+}
+
+// runCommand runs a command line and returns what it printed.
+func runCommand(t *testing.T, cl *cli, line string) (string, error) {
+	t.Helper()
+	out := cl.out.(*syncBuffer)
+	before := len(out.String())
+	args, err := splitArgs(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cl.run(args)
+	return out.String()[before:], err
+}
+
+func TestReadCommands(t *testing.T) {
+	cl, _, _ := newTestCLI("/a", "/a/y", "/a/x", "/a/x/1", "/b")
+	tests := []struct {
+		line, want string
+	}{
+		{"ls /", "a\nb\n"},
+		{"ls -R /a", "/a\n/a/x\n/a/x/1\n/a/y\n"},
+		{"get /a/x", "/a/x\n"},
+		{"get -raw /a/x", "/a/x"},
+		{"getacl /a", "world:anyone:cdrwa\n"},
+	}
+	for _, tt := range tests {
+		if got, err := runCommand(t, cl, tt.line); err != nil || got != tt.want {
+			t.Errorf("%s printed %q, %v; want %q", tt.line, got, err, tt.want)
+		}
+	}
+
+	got, err := runCommand(t, cl, "stat /a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"version=0\n", "dataLength=2\n", "numChildren=2\n", "ephemeralOwner=0x0\n"} {
+		if !strings.Contains(got, field) {
+			t.Errorf("stat printed %q; want a line %q", got, field)
+		}
+	}
+	for _, line := range []string{"get /missing", "stat /missing"} {
+		if got, err := runCommand(t, cl, line); !errors.Is(err, zk.ErrNoNode) || got != "" {
+			t.Errorf("%s printed %q, %v; want ErrNoNode", line, got, err)
+		}
+	}
+}
+
+func TestWriteCommands(t *testing.T) {
+	cl, f, _ := newTestCLI("/a", "/a/b", "/a/b/c")
+
+	if _, err := runCommand(t, cl, "set -v 0 /a 'new data'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runCommand(t, cl, "set -v 0 /a again"); !errors.Is(err, zk.ErrBadVersion) {
+		t.Errorf("set with a stale version returned %v; want ErrBadVersion", err)
+	}
+	if data, _, _ := f.Get("/a"); string(data) != "new data" {
+		t.Errorf("data of /a = %q", data)
+	}
+
+	cl.stdin = strings.NewReader("from stdin")
+	if got, err := runCommand(t, cl, "create -e -s /a/seq-"); err != nil || got != "/a/seq-0000000001\n" {
+		t.Errorf("create printed %q, %v", got, err)
+	}
+	data, stat, _ := f.Get("/a/seq-0000000001")
+	if string(data) != "from stdin" || stat.EphemeralOwner == 0 {
+		t.Errorf("sequential node has data %q and ephemeral owner %d", data, stat.EphemeralOwner)
+	}
+	if _, err := runCommand(t, cl, "create -c -e /a/c"); !errors.Is(err, errUsage) {
+		t.Errorf("create -c -e returned %v; want a usage error", err)
+	}
+
+	if _, err := runCommand(t, cl, "setacl /a digest:user:hash=:rw world:anyone:r"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := runCommand(t, cl, "getacl /a"); got != "digest:user:hash=:rw\nworld:anyone:r\n" {
+		t.Errorf("getacl printed %q", got)
+	}
+
+	if got, err := runCommand(t, cl, "rmr -n /a/b"); err != nil || got != "/a/b/c\n/a/b\n" {
+		t.Errorf("rmr -n printed %q, %v", got, err)
+	}
+	if ok, _, _ := f.Exists("/a/b/c"); !ok {
+		t.Error("rmr -n deleted /a/b/c")
+	}
+	if _, err := runCommand(t, cl, "rmr /a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runCommand(t, cl, "rm -v 0 /a/seq-0000000001"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := runCommand(t, cl, "ls /a"); got != "" {
+		t.Errorf("/a still has children %q", got)
+	}
+}
+
+func TestParseACL(t *testing.T) {
+	acl, err := parseACL([]string{"world:anyone:cdrwa", "auth::r", "digest:u:h:wa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []zk.ACL{
+		{Scheme: "world", ID: "anyone", Perms: zk.PermAll},
+		{Scheme: "auth", ID: "", Perms: zk.PermRead},
+		{Scheme: "digest", ID: "u:h", Perms: zk.PermWrite | zk.PermAdmin},
+	}
+	for i := range want {
+		if acl[i] != want[i] {
+			t.Errorf("entry %d = %+v; want %+v", i, acl[i], want[i])
+		}
+	}
+	for _, spec := range []string{"world:anyone", "world:anyone:rx"} {
+		if _, err := parseACL([]string{spec}); !errors.Is(err, errUsage) {
+			t.Errorf("parseACL(%q) returned %v; want a usage error", spec, err)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	cl, f, out := newTestCLI()
+	done := make(chan error, 1)
+	go func() {
+		done <- cl.run([]string{"watch", "-n", "2", "/w"})
+	}()
+
+	// waitForCall waits until watch has called method n times.
+	waitForCall := func(method string, n int) {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			count := 0
+			for _, call := range f.Calls() {
+				if call.Method == method {
+					count++
+				}
+			}
+			if count >= n {
+				return
+			}
+		}
+		t.Fatalf("watch didn't call %s %d times", method, n)
+	}
+	waitForCall("ExistsW", 1)
+	f.Create("/w", nil, 0, zk.WorldACL(zk.PermAll))
+	waitForCall("ChildrenW", 1)
+	f.Create("/w/child", nil, 0, zk.WorldACL(zk.PermAll))
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch didn't return")
+	}
+	var types []string
+	sc := bufio.NewScanner(strings.NewReader(out.String()))
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, `{"time":"`) {
+			t.Errorf("line %q isn't a JSON event", line)
+		}
+		types = append(types, line[strings.Index(line, `"type"`):])
+	}
+	want := []string{`"type":"EventNodeCreated","path":"/w"}`, `"type":"EventNodeChildrenChanged","path":"/w"}`}
+	if strings.Join(types, "\n") != strings.Join(want, "\n") {
+		t.Errorf("watch printed %q; want %q", types, want)
+	}
+}
+
+func TestRuok(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			io.ReadFull(conn, make([]byte, 4))
+			conn.Write([]byte("imok"))
+			conn.Close()
+		}
+	}()
+
+	cl, _, _ := newTestCLI()
+	cl.servers = []string{l.Addr().String()}
+	cl.flwTimeout = 5 * time.Second
+	if got, err := runCommand(t, cl, "ruok"); err != nil || got != l.Addr().String()+" imok\n" {
+		t.Errorf("ruok printed %q, %v", got, err)
+	}
+
+	l.Close()
+	if got, err := runCommand(t, cl, "ruok"); err == nil || got != l.Addr().String()+" not ok\n" {
+		t.Errorf("ruok of a stopped server printed %q, %v", got, err)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	cl, f, _ := newTestCLI()
+	for _, line := range []string{"frobnicate /", "get", "ls / /a", "pwd /", "get -x /", "setacl /", "srvr extra"} {
+		if _, err := runCommand(t, cl, line); !errors.Is(err, errUsage) {
+			t.Errorf("%s returned %v; want a usage error", line, err)
+		}
+	}
+	if calls := f.Calls(); len(calls) != 0 {
+		t.Errorf("misused commands made calls %v", calls)
+	}
+}
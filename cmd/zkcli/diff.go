@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// errDiffer is returned by diff when the trees differ, so that the exit
+// status tells.
+var errDiffer = errors.New("the trees differ")
+
+// diffEntry is a line printed by diff -json.
+type diffEntry struct {
+	*zk.NodeDiff
+	TextDiff string `json:"textDiff,omitempty"`
+}
+
+func cmdDiff(cl *cli, args []string) error {
+	fs := newFlagSet("diff")
+	with := fs.String("with", "", "")
+	ignoreACL := fs.Bool("ignore-acl", false, "")
+	ignoreEphemeral := fs.Bool("ignore-ephemeral", false, "")
+	ignoreOwner := fs.Bool("ignore-owner", false, "")
+	asJSON := fs.Bool("json", false, "")
+	quiet := fs.Bool("q", false, "")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	oldRoot, newRoot := cl.resolve(args[0]), cl.resolve(args[len(args)-1])
+
+	a, err := cl.conn()
+	if err != nil {
+		return err
+	}
+	b := a
+	if *with != "" {
+		if b, err = cl.dial(*with); err != nil {
+			return err
+		}
+		defer b.Close()
+	}
+	opts := &zk.DiffOptions{IgnoreACL: *ignoreACL, IgnoreEphemeral: *ignoreEphemeral, IgnoreOwner: *ignoreOwner}
+	diffs, err := zk.DiffTrees(a, oldRoot, b, newRoot, opts)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *quiet:
+	case *asJSON:
+		enc := json.NewEncoder(cl.out)
+		for i := range diffs {
+			entry := diffEntry{NodeDiff: &diffs[i]}
+			if diffs[i].Data {
+				entry.TextDiff, _ = diffs[i].TextDiff()
+			}
+			if err := enc.Encode(&entry); err != nil {
+				return err
+			}
+		}
+	default:
+		printDiff(cl.out, diffs)
+	}
+	if len(diffs) > 0 {
+		return errDiffer
+	}
+	return nil
+}
+
+// printDiff prints a line per node, "+" for added, "-" for removed and "~"
+// for changed nodes, followed by what changed.
+func printDiff(w io.Writer, diffs []zk.NodeDiff) {
+	for i := range diffs {
+		d := &diffs[i]
+		switch d.Change {
+		case zk.DiffAdded:
+			fmt.Fprintf(w, "+ %s\n", d.Path)
+			continue
+		case zk.DiffRemoved:
+			fmt.Fprintf(w, "- %s\n", d.Path)
+			continue
+		}
+
+		var what []string
+		if d.Data {
+			what = append(what, "data")
+		}
+		if d.ACL {
+			what = append(what, "acl")
+		}
+		if d.Ephemeral {
+			what = append(what, "ephemeral")
+		}
+		fmt.Fprintf(w, "~ %s (%s)\n", d.Path, strings.Join(what, ", "))
+		if d.Data {
+			if text, ok := d.TextDiff(); ok {
+				for _, line := range strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n") {
+					fmt.Fprintf(w, "    %s", line)
+				}
+				fmt.Fprintln(w)
+			} else {
+				fmt.Fprintf(w, "    binary data: %d -> %d bytes\n", len(d.Old.Data), len(d.New.Data))
+			}
+		}
+		if d.ACL {
+			fmt.Fprintf(w, "    acl: %s -> %s\n", formatACL(d.Old.ACL), formatACL(d.New.ACL))
+		}
+		if d.Ephemeral {
+			fmt.Fprintf(w, "    owner: %s -> %s\n", ephemeralOwner(d.Old), ephemeralOwner(d.New))
+		}
+	}
+}
+
+func formatACL(acl []zk.ACL) string {
+	entries := make([]string, len(acl))
+	for i, a := range acl {
+		entries[i] = aclEntry(a)
+	}
+	return strings.Join(entries, ",")
+}
+
+func ephemeralOwner(n *zk.ExportedNode) string {
+	if !n.Ephemeral {
+		return "persistent"
+	}
+	return fmt.Sprintf("0x%x", n.Stat.EphemeralOwner)
+}
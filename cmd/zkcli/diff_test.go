@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// unclosedConn ignores Close.
+type unclosedConn struct {
+	fakeConn
+}
+
+func (unclosedConn) Close() {}
+
+func TestDiff(t *testing.T) {
+	cl, f, _ := newTestCLI("/cfg", "/cfg/a", "/cfg/b", "/cfg/old")
+	other := zk.NewFakeClient()
+	for _, path := range []string{"/cfg", "/cfg/a", "/cfg/new"} {
+		other.Create(path, []byte(path), 0, zk.WorldACL(zk.PermAll))
+	}
+	other.Create("/cfg/b", []byte("changed"), zk.FlagEphemeral, zk.WorldACL(zk.PermRead))
+	cl.dial = func(server string) (conn, error) {
+		if server == "other:2181" {
+			// diff closes it, but the tree has to outlive the connection.
+			return unclosedConn{fakeConn{other}}, nil
+		}
+		return fakeConn{f}, nil
+	}
+
+	got, err := runCommand(t, cl, "diff -with other:2181 /cfg")
+	if !errors.Is(err, errDiffer) {
+		t.Errorf("diff of different trees returned %v; want errDiffer", err)
+	}
+	want := `~ /b (data, acl, ephemeral)
+    @@ -1 +1 @@
+    -/cfg/b
+    \ No newline at end of data
+    +changed
+    \ No newline at end of data
+    acl: world:anyone:cdrwa -> world:anyone:r
+    owner: persistent -> 0x1
++ /new
+- /old
+`
+	if got != want {
+		t.Errorf("diff printed\n%s\nwant\n%s", got, want)
+	}
+
+	if got, err := runCommand(t, cl, "diff -q -with other:2181 /cfg"); got != "" || !errors.Is(err, errDiffer) {
+		t.Errorf("diff -q printed %q, %v", got, err)
+	}
+
+	got, _ = runCommand(t, cl, "diff -json -with other:2181 -ignore-acl -ignore-ephemeral /cfg")
+	var changes []string
+	for _, line := range strings.Split(strings.TrimSpace(got), "\n") {
+		var d struct {
+			Path     string `json:"path"`
+			Change   string `json:"change"`
+			TextDiff string `json:"textDiff"`
+		}
+		if err := json.Unmarshal([]byte(line), &d); err != nil {
+			t.Fatalf("diff -json printed %q: %v", line, err)
+		}
+		changes = append(changes, d.Change+" "+d.Path)
+	}
+	if want := "removed /b,added /new,removed /old"; strings.Join(changes, ",") != want {
+		t.Errorf("diff -json found %q; want %q", changes, want)
+	}
+
+	// Paths on the same servers, one of them relative.
+	f.Create("/copy", nil, 0, zk.WorldACL(zk.PermAll))
+	f.Create("/copy/a", []byte("/cfg/a"), 0, zk.WorldACL(zk.PermAll))
+	cl.cwd = "/cfg"
+	if got, err := runCommand(t, cl, "diff a /copy/a"); got != "" || err != nil {
+		t.Errorf("diff of equal trees printed %q, %v", got, err)
+	}
+}
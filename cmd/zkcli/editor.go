@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxHistory is the number of lines the history keeps.
+const maxHistory = 1000
+
+// completeFunc returns the candidates for the word of line that ends at pos
+// and where that word starts. Candidates replace the whole word.
+type completeFunc func(line []rune, pos int) (start int, candidates []string)
+
+// lineEditor reads lines from a terminal in raw mode, with emacs-like key
+// bindings, history and completion.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	complete completeFunc
+	history  []string
+
+	prompt string
+	buf    []rune
+	pos    int // cursor position in buf
+}
+
+func newLineEditor(in io.Reader, out io.Writer, complete completeFunc) *lineEditor {
+	return &lineEditor{in: bufio.NewReader(in), out: out, complete: complete}
+}
+
+// addHistory appends line to the history, unless it repeats the last line.
+func (e *lineEditor) addHistory(line string) {
+	if line == "" || len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// readLine reads a line. It returns io.EOF when Ctrl-D is typed on an empty
+// line. Ctrl-C discards the line and starts a new one.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	e.prompt, e.buf, e.pos = prompt, nil, 0
+	hist := len(e.history) // index of the shown history entry
+	var edited []rune      // the line being typed, while browsing the history
+	e.refresh()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			return string(e.buf), nil
+		case 1: // Ctrl-A
+			e.pos = 0
+		case 2: // Ctrl-B
+			e.move(-1)
+		case 3: // Ctrl-C
+			io.WriteString(e.out, "^C\r\n")
+			e.buf, e.pos = nil, 0
+			hist = len(e.history)
+		case 4: // Ctrl-D
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteRange(e.pos, e.pos+1)
+		case 5: // Ctrl-E
+			e.pos = len(e.buf)
+		case 6: // Ctrl-F
+			e.move(1)
+		case '\t':
+			e.completeWord()
+		case 11: // Ctrl-K
+			e.deleteRange(e.pos, len(e.buf))
+		case 12: // Ctrl-L
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case 14, 16: // Ctrl-N, Ctrl-P
+			hist, edited = e.browse(hist, edited, r == 16)
+		case 21: // Ctrl-U
+			e.deleteRange(0, e.pos)
+		case 23: // Ctrl-W
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.deleteRange(start, e.pos)
+		case 8, 127: // Ctrl-H, Backspace
+			if e.pos > 0 {
+				e.deleteRange(e.pos-1, e.pos)
+			}
+		case 27: // escape sequence
+			switch e.readEscape() {
+			case "[A", "OA":
+				hist, edited = e.browse(hist, edited, true)
+			case "[B", "OB":
+				hist, edited = e.browse(hist, edited, false)
+			case "[C", "OC":
+				e.move(1)
+			case "[D", "OD":
+				e.move(-1)
+			case "[H", "OH", "[1~", "[7~":
+				e.pos = 0
+			case "[F", "OF", "[4~", "[8~":
+				e.pos = len(e.buf)
+			case "[3~":
+				e.deleteRange(e.pos, e.pos+1)
+			}
+		default:
+			if r >= ' ' {
+				e.insert(string(r))
+			}
+		}
+		e.refresh()
+	}
+}
+
+// readEscape reads the rest of an escape sequence.
+func (e *lineEditor) readEscape() string {
+	var seq []rune
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return string(seq)
+		}
+		seq = append(seq, r)
+		// The sequences start with [ or O and end with a letter or ~.
+		if len(seq) > 1 && (r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r == '~') || len(seq) == 1 && r != '[' && r != 'O' {
+			return string(seq)
+		}
+	}
+}
+
+func (e *lineEditor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+	if n := len(e.buf) - e.pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
+
+func (e *lineEditor) move(n int) {
+	if p := e.pos + n; p >= 0 && p <= len(e.buf) {
+		e.pos = p
+	}
+}
+
+func (e *lineEditor) insert(s string) {
+	rs := []rune(s)
+	e.buf = append(e.buf[:e.pos], append(rs, e.buf[e.pos:]...)...)
+	e.pos += len(rs)
+}
+
+func (e *lineEditor) deleteRange(from, to int) {
+	if to > len(e.buf) {
+		to = len(e.buf)
+	}
+	if from >= to {
+		return
+	}
+	e.buf = append(e.buf[:from], e.buf[to:]...)
+	if e.pos > to {
+		e.pos -= to - from
+	} else if e.pos > from {
+		e.pos = from
+	}
+}
+
+// browse shows the previous or next history entry. edited keeps the line
+// typed before browsing, shown again after the last entry.
+func (e *lineEditor) browse(hist int, edited []rune, back bool) (int, []rune) {
+	if hist == len(e.history) {
+		edited = append([]rune(nil), e.buf...)
+	}
+	if back && hist > 0 {
+		hist--
+	} else if !back && hist < len(e.history) {
+		hist++
+	} else {
+		return hist, edited
+	}
+	if hist == len(e.history) {
+		e.buf = append([]rune(nil), edited...)
+	} else {
+		e.buf = []rune(e.history[hist])
+	}
+	e.pos = len(e.buf)
+	return hist, edited
+}
+
+// completeWord completes the word before the cursor. With several
+// candidates it inserts their common prefix, or lists them if there is none
+// to insert.
+func (e *lineEditor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	start, candidates := e.complete(e.buf, e.pos)
+	if len(candidates) == 0 {
+		return
+	}
+	word := string(e.buf[start:e.pos])
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	if len(candidates) == 1 || len(prefix) > len(word) {
+		e.deleteRange(start, e.pos)
+		e.insert(prefix)
+		return
+	}
+	io.WriteString(e.out, "\r\n")
+	for i, c := range candidates {
+		if i > 0 {
+			io.WriteString(e.out, "  ")
+		}
+		io.WriteString(e.out, displayName(c))
+	}
+	io.WriteString(e.out, "\r\n")
+}
+
+// displayName returns the last element of a candidate path, which is all
+// that differs between the listed candidates.
+func displayName(candidate string) string {
+	trimmed := strings.TrimSuffix(candidate, "/")
+	if i := strings.LastIndex(trimmed, "/"); i >= 0 && i < len(trimmed)-1 {
+		return candidate[i+1:]
+	}
+	return candidate
+}
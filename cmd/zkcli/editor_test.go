@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLineEditor(t *testing.T) {
+	tests := []struct {
+		name, keys, want string
+	}{
+		{"plain", "ls /a\r", "ls /a"},
+		{"backspace", "ls /ab\x7f\r", "ls /a"},
+		{"cursor", "ls a\x1b[D/\x1b[C/b\r", "ls /a/b"},
+		{"home and end", "s /a\x01get\x05 x\r", "gets /a x"},
+		{"kill to start", "junk\x15ls\r", "ls"},
+		{"kill to end", "ls /a/b\x02\x02\x0b\r", "ls /a"},
+		{"delete word", "get /a /b \x17\r", "get /a "},
+		{"delete key", "lss\x1b[D\x1b[3~\r", "ls"},
+		{"ctrl-c", "junk\x03ls\r", "ls"},
+		{"unicode", "get /é\x7fe\r", "get /e"},
+	}
+	for _, tt := range tests {
+		e := newLineEditor(strings.NewReader(tt.keys), io.Discard, nil)
+		if got, err := e.readLine("> "); err != nil || got != tt.want {
+			t.Errorf("%s: readLine = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestLineEditorEOF(t *testing.T) {
+	e := newLineEditor(strings.NewReader("ab\x04\x01\x04\r\x04"), io.Discard, nil)
+	// Ctrl-D deletes the character under the cursor on a non-empty line.
+	if got, err := e.readLine("> "); err != nil || got != "b" {
+		t.Errorf("readLine = %q, %v; want \"b\"", got, err)
+	}
+	if _, err := e.readLine("> "); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line returned %v; want io.EOF", err)
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	e := newLineEditor(strings.NewReader("new\x1b[A\x1b[A\x1b[A\r"+"x\x10\x0e\x0e\r"), io.Discard, nil)
+	for _, line := range []string{"first", "second", "second", ""} {
+		e.addHistory(line)
+	}
+	if len(e.history) != 2 {
+		t.Fatalf("history = %q; want repeated and empty lines left out", e.history)
+	}
+	// Going up past the first entry stays on it.
+	if got, _ := e.readLine("> "); got != "first" {
+		t.Errorf("up three times gave %q; want \"first\"", got)
+	}
+	// Going down past the last entry restores the typed line.
+	if got, _ := e.readLine("> "); got != "x" {
+		t.Errorf("up and down twice gave %q; want \"x\"", got)
+	}
+}
+
+func TestLineEditorCompletion(t *testing.T) {
+	complete := func(line []rune, pos int) (int, []string) {
+		start := strings.LastIndex(string(line[:pos]), " ") + 1
+		var candidates []string
+		for _, c := range []string{"/app/config", "/app/cache", "/apps"} {
+			if strings.HasPrefix(c, string(line[start:pos])) {
+				candidates = append(candidates, c)
+			}
+		}
+		if len(candidates) == 1 {
+			candidates[0] += " "
+		}
+		return start, candidates
+	}
+	tests := []struct {
+		keys, want, listed string
+	}{
+		{"get /app/co\t\r", "get /app/config ", ""},
+		{"get /app/c\t\r", "get /app/c", "config  cache"},
+		{"get /app\t\r", "get /app", "config  cache  apps"},
+		{"get /x\t\r", "get /x", ""},
+		{"get /ap\tx\r", "get /appx", ""},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := newLineEditor(strings.NewReader(tt.keys), &out, complete)
+		if got, _ := e.readLine("> "); got != tt.want {
+			t.Errorf("%q: readLine = %q; want %q", tt.keys, got, tt.want)
+		}
+		if tt.listed != "" && !strings.Contains(out.String(), "\r\n"+tt.listed+"\r\n") {
+			t.Errorf("%q: output %q doesn't list %q", tt.keys, out.String(), tt.listed)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Command zkcli runs ZooKeeper commands from the command line.
+//
+// Usage:
+//
+//	zkcli [-server connstring] [flags] command [arguments]
+//
+// The server is a connection string such as "host1:2181,host2:2181/chroot"
+// or a zk:// URL (see zk.ParseURL). It defaults to $ZOOKEEPER, or to
+// 127.0.0.1:2181.
+//
+// Without a command, commands are read from standard input, one per line, and
+// run in a single session. Arguments may be quoted as in a shell. Reading
+// stops at the first command that fails.
+//
+// If standard input is a terminal, zkcli runs an interactive shell instead:
+// paths are relative to the node changed with cd, Tab completes commands and
+// paths, the arrow keys browse the history kept in ~/.zkcli_history, and the
+// prompt shows the server, the state and the session. Failed commands don't
+// end the shell; Ctrl-D or exit does, and Ctrl-C stops a watch.
+//
+// The output is meant for scripts: one item per line, without decoration,
+// and JSON lines where items have several fields. Errors go to standard
+// error, and the exit status is 1 if a command failed and 2 if it was
+// misused. When the compared trees differ, diff exits with status 1 without
+// an error message, so that it can serve as a check in CI pipelines:
+//
+//	zkcli -server old:2181 diff -with new:2181 -ignore-owner /config
+//
+// Run "zkcli help" for the list of commands.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+func main() {
+	server := flag.String("server", defaultServer(), "connection string or zk:// URL")
+	sessionTimeout := flag.Duration("timeout", 10*time.Second, "session timeout")
+	connectTimeout := flag.Duration("connect-timeout", 10*time.Second, "how long to wait for a session")
+	verbose := flag.Bool("v", false, "log connection events to standard error")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: zkcli [flags] [command [arguments]]\n\nflags:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\ncommands:\n")
+		printCommands(os.Stderr)
+	}
+	flag.Parse()
+
+	servers, err := serverAddrs(*server)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "zkcli: %v\n", err)
+		os.Exit(2)
+	}
+	logger := log.New(io.Discard, "", 0)
+	if *verbose {
+		logger = log.New(os.Stderr, "zkcli: ", log.LstdFlags)
+	}
+
+	cl := &cli{
+		server:     *server,
+		servers:    servers,
+		flwTimeout: *connectTimeout,
+		dial: func(server string) (conn, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), *connectTimeout)
+			defer cancel()
+			c, err := connect(ctx, server, *sessionTimeout, logger)
+			if err != nil {
+				return nil, fmt.Errorf("connecting to %s: %w", server, err)
+			}
+			return c, nil
+		},
+		out:    os.Stdout,
+		errOut: os.Stderr,
+	}
+	defer cl.close()
+
+	if flag.NArg() > 0 {
+		// Commands given as arguments read data from standard input.
+		cl.stdin = os.Stdin
+		err = cl.run(flag.Args())
+	} else if isTerminal(int(os.Stdin.Fd())) {
+		err = runShell(cl)
+	} else {
+		err = cl.runScript(os.Stdin)
+	}
+	if err != nil {
+		if !errors.Is(err, errDiffer) {
+			fmt.Fprintf(os.Stderr, "zkcli: %v\n", err)
+		}
+		cl.close()
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func defaultServer() string {
+	if s := os.Getenv("ZOOKEEPER"); s != "" {
+		return s
+	}
+	return "127.0.0.1:2181"
+}
+
+// serverAddrs returns the addresses of the servers in a connection string
+// or a zk:// URL.
+func serverAddrs(server string) ([]string, error) {
+	if strings.HasPrefix(server, "zk://") {
+		servers, _, _, err := zk.ParseURL(server)
+		return servers, err
+	}
+	servers, _, err := zk.ParseConnectString(server)
+	return servers, err
+}
+
+// connect connects to the servers of a connection string or a zk:// URL and
+// waits for a session. The session timeout of a URL overrides
+// sessionTimeout.
+func connect(ctx context.Context, server string, sessionTimeout time.Duration, logger zk.Logger) (*zk.Conn, error) {
+	if strings.HasPrefix(server, "zk://") {
+		servers, timeout, options, err := zk.ParseURL(server)
+		if err != nil {
+			return nil, err
+		}
+		c, _, err := zk.ConnectContext(ctx, servers, timeout, append(options, zk.WithLogger(logger))...)
+		return c, err
+	}
+	servers, chroot, err := zk.ParseConnectString(server)
+	if err != nil {
+		return nil, err
+	}
+	c, _, err := zk.ConnectContext(ctx, servers, sessionTimeout, zk.WithChroot(chroot), zk.WithLogger(logger))
+	return c, err
+}
+
+// runScript runs the commands read from r, one per line. Empty lines and
+// lines starting with # are skipped.
+func (cl *cli) runScript(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		args, err := splitArgs(text)
+		if err == nil {
+			err = cl.run(args)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return sc.Err()
+}
+
+// splitArgs splits a command line into arguments like a shell does, without
+// expansions: arguments are separated by spaces, single quotes keep
+// everything up to the next single quote, and a backslash escapes the next
+// character, except between single quotes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("%w: unterminated quote or escape in %q", errUsage, line)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
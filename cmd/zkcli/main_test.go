@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"ls  /a\t/b ", []string{"ls", "/a", "/b"}},
+		{`set /a 'two words'`, []string{"set", "/a", "two words"}},
+		{`set /a "say \"hi\"" ''`, []string{"set", "/a", `say "hi"`, ""}},
+		{`set /a it\'s 'a\b'`, []string{"set", "/a", "it's", `a\b`}},
+	}
+	for _, tt := range tests {
+		if got, err := splitArgs(tt.line); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, %v; want %q", tt.line, got, err, tt.want)
+		}
+	}
+	for _, line := range []string{`set /a 'open`, `set /a end\`} {
+		if _, err := splitArgs(line); !errors.Is(err, errUsage) {
+			t.Errorf("splitArgs(%q) returned %v; want a usage error", line, err)
+		}
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	cl, f, out := newTestCLI("/a")
+	script := `
+# Comments and empty lines are skipped.
+set /a "new data"
+create /a/b
+get /a
+rm /missing
+create /a/c
+`
+	err := cl.runScript(strings.NewReader(script))
+	if !errors.Is(err, zk.ErrNoNode) || !strings.HasPrefix(err.Error(), "line 6:") {
+		t.Errorf("runScript returned %v; want ErrNoNode on line 6", err)
+	}
+	if got := out.String(); got != "/a/b\nnew data\n" {
+		t.Errorf("runScript printed %q", got)
+	}
+	if ok, _, _ := f.Exists("/a/c"); ok {
+		t.Error("runScript went on after a failure")
+	}
+}
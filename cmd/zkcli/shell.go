@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// historyFileName is the file in the home directory that keeps the history
+// of the shell across runs.
+const historyFileName = ".zkcli_history"
+
+// shell runs the commands typed at a terminal in a single session. Paths
+// are completed with Tab, and Stats are printed for people.
+type shell struct {
+	cl      *cli
+	ed      *lineEditor
+	history io.Writer // the history file, or nil
+	// raw puts the terminal into raw mode while a line is edited, if set.
+	raw func() (restore func() error, err error)
+}
+
+// runShell runs the interactive shell on the terminal of the process.
+func runShell(cl *cli) error {
+	if _, err := cl.conn(); err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	cl.interrupt = interrupt
+	cl.human = true
+
+	sh := &shell{cl: cl, raw: func() (func() error, error) { return makeRaw(int(os.Stdin.Fd())) }}
+	sh.ed = newLineEditor(os.Stdin, os.Stdout, sh.complete)
+	if home, err := os.UserHomeDir(); err == nil {
+		f, err := loadHistory(sh.ed, filepath.Join(home, historyFileName))
+		if err != nil {
+			fmt.Fprintf(cl.errOut, "zkcli: history: %v\n", err)
+		} else {
+			defer f.Close()
+			sh.history = f
+		}
+	}
+	return sh.run()
+}
+
+// loadHistory reads the history file into the editor and opens it for
+// appending. The file is trimmed to the lines the editor keeps.
+func loadHistory(ed *lineEditor, name string) (*os.File, error) {
+	if f, err := os.Open(name); err == nil {
+		sc := bufio.NewScanner(f)
+		lines := 0
+		for ; sc.Scan(); lines++ {
+			ed.addHistory(sc.Text())
+		}
+		f.Close()
+		if lines > maxHistory {
+			kept := strings.Join(ed.history, "\n") + "\n"
+			if err := os.WriteFile(name, []byte(kept), 0600); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+}
+
+func (sh *shell) run() error {
+	for {
+		line, err := sh.readLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sh.ed.addHistory(line)
+		// Credentials stay out of the history file.
+		if sh.history != nil && !strings.HasPrefix(line, "addauth") {
+			fmt.Fprintln(sh.history, line)
+		}
+
+		args, err := splitArgs(line)
+		if err == nil {
+			if args[0] == "exit" || args[0] == "quit" {
+				return nil
+			}
+			// Forget an interrupt that came while no watch was running.
+			select {
+			case <-sh.cl.interrupt:
+			default:
+			}
+			err = sh.cl.run(args)
+		}
+		if err != nil {
+			fmt.Fprintf(sh.cl.errOut, "error: %v\n", err)
+		}
+	}
+}
+
+func (sh *shell) readLine() (string, error) {
+	if sh.raw != nil {
+		restore, err := sh.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+	return sh.ed.readLine(sh.prompt())
+}
+
+// prompt shows the server, the state and the session of the connection,
+// and the current node.
+func (sh *shell) prompt() string {
+	c := sh.cl.c
+	if c == nil {
+		return fmt.Sprintf("[not connected] %s> ", sh.cl.wd())
+	}
+	state := strings.TrimPrefix(c.State().String(), "State")
+	return fmt.Sprintf("[%s %s 0x%x] %s> ", c.Server(), state, c.SessionID(), sh.cl.wd())
+}
+
+// complete completes command names, and paths from the children of the
+// nodes on the server. A path that is the only candidate gets a slash if the
+// node has children, so that Tab completes the next level.
+func (sh *shell) complete(line []rune, pos int) (int, []string) {
+	start := pos
+	for start > 0 && line[start-1] != ' ' {
+		start--
+	}
+	word := string(line[start:pos])
+	var candidates []string
+	if strings.TrimSpace(string(line[:start])) == "" {
+		for _, name := range append(commandNames(), "exit", "quit") {
+			if strings.HasPrefix(name, word) {
+				candidates = append(candidates, name+" ")
+			}
+		}
+		sort.Strings(candidates)
+		return start, candidates
+	}
+
+	c := sh.cl.c
+	if c == nil || strings.HasPrefix(word, "-") {
+		return start, nil
+	}
+	dir, prefix := "", word
+	if i := strings.LastIndex(word, "/"); i >= 0 {
+		dir, prefix = word[:i+1], word[i+1:]
+	}
+	children, _, err := c.Children(sh.cl.resolve(dir))
+	if err != nil {
+		return start, nil
+	}
+	sort.Strings(children)
+	for _, name := range children {
+		if strings.HasPrefix(name, prefix) {
+			candidates = append(candidates, dir+name)
+		}
+	}
+	if len(candidates) == 1 {
+		if _, stat, err := c.Exists(sh.cl.resolve(candidates[0])); err == nil && stat != nil && stat.NumChildren > 0 {
+			candidates[0] += "/"
+		} else {
+			candidates[0] += " "
+		}
+	}
+	return start, candidates
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+func newTestShell(keys string, paths ...string) (*shell, *syncBuffer, *bytes.Buffer) {
+	cl, _, out := newTestCLI(paths...)
+	cl.human = true
+	cl.errOut = &bytes.Buffer{}
+	if _, err := cl.conn(); err != nil {
+		panic(err)
+	}
+	sh := &shell{cl: cl}
+	term := &bytes.Buffer{}
+	sh.ed = newLineEditor(strings.NewReader(keys), term, sh.complete)
+	return sh, out, term
+}
+
+func TestShell(t *testing.T) {
+	keys := "cd /a\rpwd\rls\rget b\rget nope\raddauth digest u:p\rcd b\rpwd\rcd ..\r\x1b[A\x1b[A\rexit\rpwd\r"
+	sh, out, term := newTestShell(keys, "/a", "/a/b", "/a/b/c", "/a/config")
+	var history bytes.Buffer
+	sh.history = &history
+	if err := sh.run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := out.String(), "/a\nb\nconfig\n/a/b\n/a/b\n/a\n"; got != want {
+		t.Errorf("shell printed %q; want %q", got, want)
+	}
+	if errs := sh.cl.errOut.(*bytes.Buffer).String(); errs != "error: "+zk.ErrNoNode.Error()+"\n" {
+		t.Errorf("shell reported %q; want the missing node only", errs)
+	}
+	for _, prompt := range []string{"[fake:2181 HasSession 0x1] /> ", "[fake:2181 HasSession 0x1] /a/b> "} {
+		if !strings.Contains(term.String(), prompt) {
+			t.Errorf("terminal output doesn't show the prompt %q", prompt)
+		}
+	}
+	if strings.Contains(history.String(), "addauth") {
+		t.Error("credentials were written to the history file")
+	}
+	if want := "cd /a\npwd\nls\nget b\nget nope\ncd b\npwd\ncd ..\npwd\nexit\n"; history.String() != want {
+		t.Errorf("history file = %q; want %q", history.String(), want)
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	sh, _, _ := newTestShell("", "/a", "/a/b", "/a/b/c", "/a/config", "/apps")
+	tests := []struct {
+		cwd, line string
+		start     int
+		want      []string
+	}{
+		{"/", "st", 0, []string{"stat "}},
+		{"/", "get /a/c", 4, []string{"/a/config "}},
+		{"/", "get /a", 4, []string{"/a", "/apps"}},
+		{"/", "get /a/", 4, []string{"/a/b", "/a/config"}},
+		{"/a", "cd b", 3, []string{"b/"}},
+		{"/a", "ls -", 3, nil},
+		{"/", "get /missing/", 4, nil},
+	}
+	for _, tt := range tests {
+		sh.cl.cwd = tt.cwd
+		start, got := sh.complete([]rune(tt.line), len(tt.line))
+		if start != tt.start || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("complete(%q) in %s = %d, %q; want %d, %q", tt.line, tt.cwd, start, got, tt.start, tt.want)
+		}
+	}
+}
+
+func TestLoadHistory(t *testing.T) {
+	name := filepath.Join(t.TempDir(), historyFileName)
+	var lines strings.Builder
+	for i := 0; i < maxHistory+5; i++ {
+		fmt.Fprintf(&lines, "get /n%d\n", i)
+	}
+	if err := os.WriteFile(name, []byte(lines.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ed := newLineEditor(strings.NewReader(""), &bytes.Buffer{}, nil)
+	f, err := loadHistory(ed, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(f, "ls /")
+	f.Close()
+	if len(ed.history) != maxHistory || ed.history[0] != "get /n5" {
+		t.Errorf("loaded %d lines starting with %q; want %d starting with \"get /n5\"", len(ed.history), ed.history[0], maxHistory)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(kept) != maxHistory+1 || kept[0] != "get /n5" || kept[maxHistory] != "ls /" {
+		t.Errorf("history file has %d lines from %q to %q", len(kept), kept[0], kept[len(kept)-1])
+	}
+}
+
+func TestPrintStatHuman(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	stat := &zk.Stat{
+		Czxid:          0x100000002,
+		Ctime:          now.Add(-72*time.Hour).UnixNano() / int64(time.Millisecond),
+		Mtime:          now.Add(-90*time.Minute).UnixNano() / int64(time.Millisecond),
+		EphemeralOwner: 0x1234,
+		DataLength:     1536,
+		NumChildren:    2,
+	}
+	var out bytes.Buffer
+	printStatHuman(&out, stat, 0x1234, now)
+	for _, line := range []string{
+		"czxid:          0x100000002\n",
+		"ctime:          " + now.Add(-72*time.Hour).Format("2006-01-02 15:04:05.000 MST") + " (3 days ago)\n",
+		"mtime:          " + now.Add(-90*time.Minute).Format("2006-01-02 15:04:05.000 MST") + " (1h30m0s ago)\n",
+		"ephemeralOwner: 0x1234 (this session)\n",
+		"dataLength:     1.5 KiB (1536 bytes)\n",
+		"numChildren:    2\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("printStatHuman printed\n%s\nwithout %q", out.String(), line)
+		}
+	}
+
+	for n, want := range map[int32]string{0: "0 B", 1023: "1023 B", 3 << 20: "3.0 MiB (3145728 bytes)"} {
+		if got := humanSize(n); got != want {
+			t.Errorf("humanSize(%d) = %q; want %q", n, got, want)
+		}
+	}
+}
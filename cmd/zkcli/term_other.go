@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import "errors"
+
+// The interactive shell needs a terminal in raw mode, which is only
+// supported on Unix. Elsewhere commands are read as a script.
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (restore func() error, err error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
@@ -0,0 +1,255 @@
+package zk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// AuthProvider supplies credentials that change over time, such as
+// short-lived tokens. Unlike credentials added with AddAuth, which are
+// replayed as they are, a provider is asked for fresh credentials every
+// time they are submitted.
+type AuthProvider interface {
+	// Credentials returns the scheme and the current credentials. It is
+	// called whenever a session is established, with a context bounded by
+	// the session timeout, and by RefreshAuth. An error is handled like
+	// rejected credentials, see AuthFailurePolicy.
+	Credentials(ctx context.Context) (scheme string, auth []byte, err error)
+}
+
+// AuthProviderFunc adapts a function to the AuthProvider interface.
+type AuthProviderFunc func(ctx context.Context) (scheme string, auth []byte, err error)
+
+// Credentials calls f(ctx).
+func (f AuthProviderFunc) Credentials(ctx context.Context) (string, []byte, error) {
+	return f(ctx)
+}
+
+// WithAuthProvider returns a connection option registering an AuthProvider
+// whose credentials are submitted as soon as a session is established, and
+// again after every reconnect. It may be given several times, and combined
+// with WithAuth and AddAuth.
+func WithAuthProvider(p AuthProvider) connOption {
+	return func(c *Conn) {
+		c.authProviders = append(c.authProviders, p)
+	}
+}
+
+// RefreshAuth asks the registered AuthProviders for fresh credentials and
+// submits them, e.g. shortly before a token expires. While the connection
+// holds requests after rejected credentials (see AuthFailureBlock) it makes
+// the connection re-submit all credentials instead.
+func (c *Conn) RefreshAuth(ctx context.Context) error {
+	err := c.fetchProviderCreds(ctx)
+	c.credsMu.Lock()
+	creds := c.providerAuth
+	blocked := c.authBlocked
+	c.credsMu.Unlock()
+
+	if blocked {
+		select {
+		case c.credsChanged <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, cred := range creds {
+		zxid, err := c.request(opSetAuth, &setAuthRequest{Type: 0, Scheme: cred.scheme, Auth: cred.auth}, &setAuthResponse{}, nil)
+		if err != nil {
+			return c.opError(opSetAuth, "", zxid, err)
+		}
+	}
+	return nil
+}
+
+// fetchProviderCreds asks the registered AuthProviders for credentials and
+// keeps them, or the error, for the next submission.
+func (c *Conn) fetchProviderCreds(ctx context.Context) error {
+	if len(c.authProviders) == 0 {
+		return nil
+	}
+	var creds []authCreds
+	var err error
+	for _, p := range c.authProviders {
+		scheme, auth, perr := p.Credentials(ctx)
+		if perr != nil {
+			creds, err = nil, fmt.Errorf("zk: auth provider: %w", perr)
+			break
+		}
+		creds = append(creds, authCreds{scheme: scheme, auth: auth})
+	}
+
+	c.credsMu.Lock()
+	c.providerAuth, c.providerErr = creds, err
+	c.credsMu.Unlock()
+	return err
+}
+
+// AuthFailurePolicy tells a Conn what to do when the server rejects the
+// stored credentials as they are re-submitted after a reconnect.
+type AuthFailurePolicy int
+
+const (
+	// AuthFailureIgnore logs the failure and carries on with the requests,
+	// which then run without the rejected identity and may fail with
+	// ErrNoAuth. This is the default.
+	AuthFailureIgnore AuthFailurePolicy = iota
+	// AuthFailureBlock emits StateAuthFailed and holds the queued requests
+	// until the credentials are replaced with ReplaceAuth or RefreshAuth,
+	// keeping the session alive meanwhile.
+	AuthFailureBlock
+	// AuthFailureClose emits StateAuthFailed and closes the Conn. Queued
+	// and later requests fail with ErrClosing.
+	AuthFailureClose
+)
+
+// WithAuthFailurePolicy returns a connection option setting what happens
+// when re-submitted credentials are rejected. See AuthFailurePolicy.
+func WithAuthFailurePolicy(policy AuthFailurePolicy) connOption {
+	return func(c *Conn) {
+		c.authFailurePolicy = policy
+	}
+}
+
+// ReplaceAuth replaces the stored credentials old of scheme with auth, or
+// stores auth if old isn't stored. Other credentials, including those of the
+// same scheme, are kept. The connection holding requests after a rejected
+// credential (see AuthFailureBlock) re-submits the stored credentials and
+// resumes once they are accepted. Otherwise auth is submitted right away, as
+// with AddAuth.
+//
+// A server never forgets an identity added to a session, so the replaced
+// credentials stay in effect until the next reconnect.
+func (c *Conn) ReplaceAuth(scheme string, old, auth []byte) error {
+	c.credsMu.Lock()
+	creds := c.creds[:0:0]
+	for _, cred := range c.creds {
+		if cred.scheme != scheme || !bytes.Equal(cred.auth, old) {
+			creds = append(creds, cred)
+		}
+	}
+	c.creds = creds
+	c.addCreds(scheme, auth)
+	blocked := c.authBlocked
+	c.credsMu.Unlock()
+
+	select {
+	case c.credsChanged <- struct{}{}:
+	default:
+	}
+	if blocked {
+		return nil
+	}
+	zxid, err := c.request(opSetAuth, &setAuthRequest{Type: 0, Scheme: scheme, Auth: auth}, &setAuthResponse{}, nil)
+	return c.opError(opSetAuth, "", zxid, err)
+}
+
+// addCreds stores credentials to re-submit on reconnect, ignoring exact
+// duplicates. It must be called with c.credsMu held.
+func (c *Conn) addCreds(scheme string, auth []byte) {
+	for _, cred := range c.creds {
+		if cred.scheme == scheme && bytes.Equal(cred.auth, auth) {
+			return
+		}
+	}
+	c.creds = append(c.creds, authCreds{scheme: scheme, auth: auth})
+}
+
+// reauthenticate re-submits the stored credentials after a (re)connect and
+// applies the AuthFailurePolicy if they are rejected. The send loop must
+// not run yet. It returns the outcome to report to WaitForSession.
+func (c *Conn) reauthenticate() error {
+	c.fetchSessionCreds()
+	err := c.resendZkAuth()
+	if err == nil || IsConnectionLoss(err) || c.authFailurePolicy == AuthFailureIgnore {
+		return err
+	}
+
+	c.setAuthBlocked(true)
+	defer c.setAuthBlocked(false)
+	c.setState(StateAuthFailed)
+	c.session.notify(err)
+
+	if c.authFailurePolicy == AuthFailureBlock {
+		for c.awaitCredentials() {
+			if err = c.resendZkAuth(); err == nil {
+				c.logger.Printf("Replacement credentials accepted id=0x%x", c.SessionID())
+				c.setState(StateHasSession)
+				return nil
+			}
+			if IsConnectionLoss(err) {
+				return err
+			}
+			c.logger.Printf("Replacement credentials rejected id=0x%x: %s", c.SessionID(), err)
+		}
+	} else {
+		c.quit()
+	}
+
+	// Drop the connection before the send loop starts, so that the queued
+	// requests aren't sent without the rejected identity.
+	c.conn.Close()
+	<-c.closeChan
+	return err
+}
+
+func (c *Conn) setAuthBlocked(blocked bool) {
+	c.credsMu.Lock()
+	defer c.credsMu.Unlock()
+	c.authBlocked = blocked
+}
+
+// fetchSessionCreds fetches the provider credentials for a session that was
+// just established, right before they are submitted, so that short-lived
+// tokens are fresh. The fetch is bounded by the session timeout, and the
+// session is kept alive with pings meanwhile. The send loop must not run yet.
+func (c *Conn) fetchSessionCreds() {
+	if len(c.authProviders) == 0 {
+		return
+	}
+	timeout := time.Duration(atomic.LoadInt32(&c.sessionTimeoutMs)) * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		c.fetchProviderCreds(ctx)
+		close(done)
+	}()
+	if !c.keepAlive(done) {
+		cancel()
+		<-done
+	}
+}
+
+// awaitCredentials keeps the session alive with pings until the credentials
+// are replaced. It returns false if the connection was lost or closed first.
+func (c *Conn) awaitCredentials() bool {
+	return c.keepAlive(c.credsChanged)
+}
+
+// keepAlive sends pings until done is ready. It returns false if the
+// connection was lost or closed first.
+func (c *Conn) keepAlive(done <-chan struct{}) bool {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return true
+		case <-ticker.C:
+			if err := c.sendPing(); err != nil {
+				return false
+			}
+		case <-c.closeChan:
+			return false
+		case <-c.shouldQuit:
+			return false
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package zk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// authServer accepts the digest credentials "user:good" and "other:good"
+// only.
+func authServer() *testServer {
+	return &testServer{handle: func(opcode int32, req interface{}) (interface{}, ErrCode) {
+		switch r := req.(type) {
+		case *setAuthRequest:
+			if !strings.HasSuffix(string(r.Auth), ":good") {
+				return nil, errAuthFailed
+			}
+		case *getDataRequest:
+			return &getDataResponse{}, 0
+		}
+		return nil, 0
+	}}
+}
+
+func waitForState(t *testing.T, events <-chan Event, state State) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type == EventSession && ev.State == state {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no %v event", state)
+		}
+	}
+}
+
+func TestAuthFailureBlock(t *testing.T) {
+	t.Parallel()
+	srv := authServer()
+	c, events, err := Connect([]string{"127.0.0.1:2181"}, time.Second, WithDialer(srv.dial),
+		WithAuth("digest", []byte("other:good")), WithAuth("digest", []byte("user:wrong")),
+		WithAuthFailurePolicy(AuthFailureBlock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitForState(t, events, StateAuthFailed)
+
+	getDone := make(chan error, 1)
+	go func() {
+		_, _, err := c.Get("/foo")
+		getDone <- err
+	}()
+	select {
+	case err := <-getDone:
+		t.Fatalf("Get returned %v while the credentials were rejected", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := c.ReplaceAuth("digest", []byte("user:wrong"), []byte("user:good")); err != nil {
+		t.Fatalf("ReplaceAuth returned error: %+v", err)
+	}
+	waitForState(t, events, StateHasSession)
+	select {
+	case err := <-getDone:
+		if err != nil {
+			t.Errorf("Get returned error: %+v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get did not complete after the credentials were replaced")
+	}
+	want := []int32{opSetAuth, opSetAuth, opSetAuth, opSetAuth, opGetData}
+	if got := srv.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("server received ops %v; want %v", got, want)
+	}
+	c.credsMu.Lock()
+	creds := c.creds
+	c.credsMu.Unlock()
+	if len(creds) != 2 || string(creds[0].auth) != "other:good" || string(creds[1].auth) != "user:good" {
+		t.Errorf("stored credentials = %q; want other:good and user:good", creds)
+	}
+}
+
+func TestAuthFailureClose(t *testing.T) {
+	t.Parallel()
+	srv := authServer()
+	c, events, err := Connect([]string{"127.0.0.1:2181"}, time.Second, WithDialer(srv.dial),
+		WithAuth("digest", []byte("user:wrong")), WithAuthFailurePolicy(AuthFailureClose))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, events, StateAuthFailed)
+	for range events {
+	}
+	if _, _, err := c.Get("/foo"); !errors.Is(err, ErrClosing) {
+		t.Errorf("Get returned %v; want ErrClosing", err)
+	}
+	if got := srv.received(); !reflect.DeepEqual(got, []int32{opSetAuth}) {
+		t.Errorf("server received ops %v; want only the rejected setAuth", got)
+	}
+}
+
+func TestAuthFailureIgnore(t *testing.T) {
+	t.Parallel()
+	srv := authServer()
+	// AuthFailureIgnore is the default.
+	c, _, err := Connect([]string{"127.0.0.1:2181"}, time.Second, WithDialer(srv.dial),
+		WithAuth("digest", []byte("user:wrong")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, _, err := c.Get("/foo"); err != nil {
+		t.Errorf("Get returned error: %+v", err)
+	}
+}
+
+func TestAddAuthDeduplicates(t *testing.T) {
+	t.Parallel()
+	srv := authServer()
+	c, _, err := Connect([]string{"127.0.0.1:2181"}, time.Second, WithDialer(srv.dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i := 0; i < 2; i++ {
+		if err := c.AddAuth("digest", []byte("user:good")); err != nil {
+			t.Fatalf("AddAuth returned error: %+v", err)
+		}
+	}
+	if s := c.Stats().AuthSchemes; len(s) != 1 {
+		t.Errorf("stored credential schemes = %v; want a single entry", s)
+	}
+}
+
+func TestAuthProvider(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var submitted []string
+	srv := &testServer{handle: func(opcode int32, req interface{}) (interface{}, ErrCode) {
+		if r, ok := req.(*setAuthRequest); ok {
+			mu.Lock()
+			submitted = append(submitted, r.Scheme+" "+string(r.Auth))
+			mu.Unlock()
+		}
+		return nil, 0
+	}}
+	conns := make(chan net.Conn, 4)
+	var dials int32
+	dial := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		conn, err := srv.dial(network, address, timeout)
+		conns <- conn
+		return conn, err
+	}
+	var tokens int32
+	provider := AuthProviderFunc(func(ctx context.Context) (string, []byte, error) {
+		n := atomic.AddInt32(&tokens, 1)
+		// The credentials for a session are fetched once it is established;
+		// t2 comes from RefreshAuth.
+		if want, ok := map[int32]int32{1: 1, 3: 2}[n]; ok && atomic.LoadInt32(&dials) != want {
+			t.Errorf("credentials t%d fetched after %d dials; want %d", n, atomic.LoadInt32(&dials), want)
+		}
+		return "token", []byte(fmt.Sprintf("t%d", n)), nil
+	})
+
+	c, _, err := ConnectContext(context.Background(), []string{"127.0.0.1:2181"}, time.Second,
+		WithDialer(dial), WithAuth("digest", []byte("user:pass")), WithAuthProvider(provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.RefreshAuth(context.Background()); err != nil {
+		t.Fatalf("RefreshAuth returned error: %+v", err)
+	}
+
+	(<-conns).Close()
+	for atomic.LoadInt32(&tokens) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.WaitForSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"digest user:pass", "token t1", "token t2", "digest user:pass", "token t3"}
+	if !reflect.DeepEqual(submitted, want) {
+		t.Errorf("submitted credentials %q; want %q", submitted, want)
+	}
+	if s := c.Stats().AuthSchemes; !reflect.DeepEqual(s, []string{"digest", "token"}) {
+		t.Errorf("AuthSchemes = %v; want [digest token]", s)
+	}
+}
+
+func TestAuthProviderError(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var submitted []string
+	srv := &testServer{handle: func(opcode int32, req interface{}) (interface{}, ErrCode) {
+		if r, ok := req.(*setAuthRequest); ok {
+			mu.Lock()
+			submitted = append(submitted, r.Scheme+" "+string(r.Auth))
+			mu.Unlock()
+		}
+		return nil, 0
+	}}
+	provider := AuthProviderFunc(func(ctx context.Context) (string, []byte, error) {
+		return "", nil, errors.New("token service unavailable")
+	})
+	c, _, err := ConnectContext(context.Background(), []string{"127.0.0.1:2181"}, time.Second,
+		WithDialer(srv.dial), WithAuth("digest", []byte("user:pass")), WithAuthProvider(provider))
+	if err == nil || !strings.Contains(err.Error(), "token service unavailable") {
+		t.Errorf("ConnectContext returned %v; want the provider error", err)
+	}
+	if c != nil {
+		c.Close()
+	}
+
+	// The static credentials are submitted regardless.
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"digest user:pass"}; !reflect.DeepEqual(submitted, want) {
+		t.Errorf("submitted credentials %q; want %q", submitted, want)
+	}
+}
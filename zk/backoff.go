@@ -0,0 +1,89 @@
+package zk
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// BackoffState describes the reconnection attempts made since the last
+// successful connection.
+type BackoffState struct {
+	Attempts   int  // Number of servers dialed so far.
+	Rotations  int  // Number of full rotations through the server list so far.
+	RetryStart bool // Whether the next dial starts a new rotation.
+}
+
+// BackoffPolicy decides how long a Conn waits before dialing the next server.
+// It is consulted before every dial except the first one after a successful
+// connection. Returning false makes the Conn give up: it moves to
+// StateDisconnected, fails pending requests with ErrNoServer and stops.
+type BackoffPolicy interface {
+	Delay(state BackoffState) (delay time.Duration, ok bool)
+}
+
+// defaultBackoff waits one second after every full rotation and never
+// gives up.
+type defaultBackoff struct{}
+
+func (defaultBackoff) Delay(state BackoffState) (time.Duration, bool) {
+	if state.RetryStart {
+		return time.Second, true
+	}
+	return 0, true
+}
+
+// ExponentialBackoff waits DialDelay between servers of a rotation and an
+// exponentially growing delay after each full rotation. Both delays are
+// randomized by Jitter so that clients disconnected at the same time do not
+// reconnect in lockstep.
+type ExponentialBackoff struct {
+	DialDelay   time.Duration // Delay between dials within a rotation.
+	BaseDelay   time.Duration // Delay after the first full rotation. 1s if zero.
+	MaxDelay    time.Duration // Upper bound of the delay. Unbounded if zero.
+	Multiplier  float64       // Growth factor per rotation. 2 if zero.
+	Jitter      float64       // Fraction of each delay that is randomized, in [0, 1].
+	MaxAttempts int           // Number of dials before giving up. Unlimited if zero.
+}
+
+// Delay implements BackoffPolicy.
+func (b ExponentialBackoff) Delay(state BackoffState) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && state.Attempts >= b.MaxAttempts {
+		return 0, false
+	}
+
+	delay := b.DialDelay
+	if state.RetryStart {
+		base := b.BaseDelay
+		if base <= 0 {
+			base = time.Second
+		}
+		mult := b.Multiplier
+		if mult <= 0 {
+			mult = 2
+		}
+		d := float64(base) * math.Pow(mult, float64(state.Rotations-1))
+		if b.MaxDelay > 0 && d > float64(b.MaxDelay) {
+			d = float64(b.MaxDelay)
+		}
+		// Converting a float beyond the range of Duration is undefined, and
+		// may give a negative delay.
+		if d >= math.MaxInt64 {
+			delay = math.MaxInt64
+		} else {
+			delay = time.Duration(d)
+		}
+	}
+	if b.MaxDelay > 0 && delay > b.MaxDelay {
+		delay = b.MaxDelay
+	}
+
+	if b.Jitter > 0 && delay > 0 {
+		j := b.Jitter
+		if j > 1 {
+			j = 1
+		}
+		delay -= time.Duration(rand.Float64() * j * float64(delay))
+	}
+	return delay, true
+}
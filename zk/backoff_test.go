@@ -0,0 +1,93 @@
+package zk
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	t.Parallel()
+	b := ExponentialBackoff{
+		DialDelay:   10 * time.Millisecond,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+		MaxAttempts: 10,
+	}
+	tests := []struct {
+		state BackoffState
+		delay time.Duration
+		ok    bool
+	}{
+		{BackoffState{Attempts: 1}, 10 * time.Millisecond, true},
+		{BackoffState{Attempts: 3, Rotations: 1, RetryStart: true}, 100 * time.Millisecond, true},
+		{BackoffState{Attempts: 6, Rotations: 2, RetryStart: true}, 200 * time.Millisecond, true},
+		{BackoffState{Attempts: 9, Rotations: 5, RetryStart: true}, time.Second, true},
+		{BackoffState{Attempts: 10, Rotations: 5}, 0, false},
+	}
+	for _, tt := range tests {
+		delay, ok := b.Delay(tt.state)
+		if delay != tt.delay || ok != tt.ok {
+			t.Errorf("Delay(%+v) = %v, %v; want %v, %v", tt.state, delay, ok, tt.delay, tt.ok)
+		}
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay, _ := b.Delay(BackoffState{Attempts: 3, Rotations: 1, RetryStart: true})
+		if delay < 50*time.Millisecond || delay > 100*time.Millisecond {
+			t.Fatalf("jittered delay %v out of range", delay)
+		}
+	}
+}
+
+func TestExponentialBackoffUnbounded(t *testing.T) {
+	t.Parallel()
+	b := ExponentialBackoff{}
+	prev := time.Duration(0)
+	for _, rotations := range []int{1, 30, 40, 100, 2000} {
+		delay, _ := b.Delay(BackoffState{Rotations: rotations, RetryStart: true})
+		if delay < prev {
+			t.Errorf("delay after %d rotations = %v; want at least %v", rotations, delay, prev)
+		}
+		prev = delay
+	}
+	if prev != math.MaxInt64 {
+		t.Errorf("delay = %v; want the largest Duration", prev)
+	}
+}
+
+func TestBackoffPolicyGivesUp(t *testing.T) {
+	t.Parallel()
+	var dials int32
+	dialer := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return nil, errors.New("connection refused")
+	}
+
+	_, events, err := Connect([]string{"127.0.0.1:2181", "127.0.0.2:2181"}, time.Second,
+		WithDialer(dialer),
+		WithBackoffPolicy(ExponentialBackoff{BaseDelay: time.Millisecond, MaxAttempts: 5}))
+	if err != nil {
+		t.Fatalf("Connect returned error: %+v", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if ok {
+				continue
+			}
+		case <-timeout:
+			t.Fatal("connection did not give up")
+		}
+		break
+	}
+	if n := atomic.LoadInt32(&dials); n != 5 {
+		t.Errorf("dialed %d times; want 5", n)
+	}
+}
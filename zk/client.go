@@ -0,0 +1,35 @@
+package zk
+
+import "time"
+
+// Client is the set of operations provided by Conn. Code that only needs to
+// talk to ZooKeeper should depend on Client rather than *Conn so that it can
+// be exercised against a FakeClient in unit tests.
+type Client interface {
+	AddAuth(scheme string, auth []byte) error
+	Children(path string) ([]string, *Stat, error)
+	ChildrenW(path string) ([]string, *Stat, <-chan Event, error)
+	Get(path string) ([]byte, *Stat, error)
+	GetW(path string) ([]byte, *Stat, <-chan Event, error)
+	Set(path string, data []byte, version int32) (*Stat, error)
+	Create(path string, data []byte, flags int32, acl []ACL) (string, error)
+	Create2(path string, data []byte, flags int32, acl []ACL) (string, *Stat, error)
+	CreateContainer(path string, data []byte, acl []ACL) (string, *Stat, error)
+	CreateTTL(path string, data []byte, flags int32, acl []ACL, ttl time.Duration) (string, *Stat, error)
+	CreateProtectedEphemeralSequential(path string, data []byte, acl []ACL) (string, error)
+	Delete(path string, version int32) error
+	Exists(path string) (bool, *Stat, error)
+	ExistsW(path string) (bool, *Stat, <-chan Event, error)
+	GetACL(path string) ([]ACL, *Stat, error)
+	SetACL(path string, acl []ACL, version int32) (*Stat, error)
+	Sync(path string) (string, error)
+	Multi(ops ...interface{}) ([]MultiResponse, error)
+
+	State() State
+	SessionID() int64
+	Server() string
+	SetLogger(l Logger)
+	Close()
+}
+
+var _ Client = &Conn{}
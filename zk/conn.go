@@ -1,10 +1,10 @@
 // Package zk is a native Go client library for the ZooKeeper orchestration service.
+//
+// The operations of Conn return errors of type *OpError wrapping the Err*
+// variables. Check for them with errors.Is, not ==.
 package zk
 
 /*
-TODO:
-* make sure a ping response comes back in a reasonable time
-
 Possible watcher events:
 * Event{Type: EventNotWatching, State: StateDisconnected, Path: path, Err: err}
 */
@@ -16,7 +16,6 @@ import (
 	"fmt"
 	"io"
 	"net"
-	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -39,6 +38,11 @@ const (
 	eventChanSize     = 6
 	sendChanSize      = 16
 	protectedPrefix   = "_c_"
+
+	// Bounds of the delay between rounds of probing for a read-write server
+	// while connected to a read-only one.
+	minRWProbeDelay = 100 * time.Millisecond
+	maxRWProbeDelay = 60 * time.Second
 )
 
 type watchType int
@@ -69,26 +73,56 @@ type authCreds struct {
 type Conn struct {
 	lastZxid         int64
 	sessionID        int64
-	state            State // must be 32-bit aligned
+	droppedEvents    uint64 // events discarded because a channel was full
+	connects         int64  // sessions established or re-established
+	expirations      int64  // sessions expired by the server
+	failedDials      int64  // connection attempts that failed
+	state            State  // must be 32-bit aligned
 	xid              uint32
 	sessionTimeoutMs int32 // session timeout in milliseconds
 	passwd           []byte
 
 	dialer         Dialer
 	hostProvider   HostProvider
-	serverMu       sync.Mutex // protects server
+	serverMu       sync.Mutex // protects server and rwServer
 	server         string     // remember the address/port of the current server
+	rwServer       string     // read-write server to connect to next, found while read-only
+	servers        []string   // servers given to the HostProvider
+	seenRWServer   bool       // a read-write server has accepted a session
 	conn           net.Conn
 	eventChan      chan Event
 	eventCallback  EventCallback // may be nil
+	connState      connStateTracker
+	session        sessionNotifier
+	subsMu         sync.Mutex // protects subs and subsClosed
+	subs           map[*subscriber]struct{}
+	subsClosed     bool
 	shouldQuit     chan struct{}
+	quitOnce       sync.Once     // closes shouldQuit
+	loopDone       chan struct{} // closed once eventChan has been closed
 	pingInterval   time.Duration
+	pingTimeout    time.Duration // close the connection if a ping is not answered in time, 0 to disable
+	pings          pingTracker
 	recvTimeout    time.Duration
 	connectTimeout time.Duration
 	allowReadOnly  bool
+	chroot         string // path prefix applied to every request, or "" for none
+
+	// rwProbe reports whether a server accepts writes. It is used to leave
+	// read-only servers when allowReadOnly is set.
+	rwProbe func(server string, timeout time.Duration) (bool, error)
 
-	creds   []authCreds
-	credsMu sync.Mutex // protects server
+	backoff      BackoffPolicy
+	backoffState BackoffState // reset on every successful connection
+
+	creds             []authCreds
+	credsMu           sync.Mutex    // protects creds and authBlocked
+	credsChanged      chan struct{} // signalled by ReplaceAuth and RefreshAuth
+	authBlocked       bool          // requests are held after rejected credentials
+	authFailurePolicy AuthFailurePolicy
+	authProviders     []AuthProvider
+	providerAuth      []authCreds // credentials last returned by authProviders
+	providerErr       error       // error of the last call to authProviders
 
 	sendChan     chan *request
 	requests     map[int32]*request // Xid -> pending request
@@ -97,6 +131,14 @@ type Conn struct {
 	watchersLock sync.Mutex
 	closeChan    chan struct{} // channel to tell send loop stop
 
+	inflightMu sync.Mutex // protects inflight, draining and drained
+	inflight   int        // requests from the API waiting for a response
+	draining   bool       // set by Shutdown, new requests fail with ErrClosing
+	drained    chan struct{}
+
+	ephemeralsMu sync.Mutex
+	ephemerals   map[string]struct{} // ephemeral nodes created by the current session
+
 	// Debug (used by unit tests)
 	reconnectDelay time.Duration
 
@@ -115,6 +157,7 @@ type request struct {
 	pkt        interface{}
 	recvStruct interface{}
 	recvChan   chan response
+	sent       time.Time // when the request was written to the server
 
 	// Because sending and receiving happen in separate go routines, there's
 	// a possible race condition when creating watches from outside the read
@@ -154,6 +197,17 @@ type HostProvider interface {
 	Connected()
 }
 
+// A HostProvider that also implements io.Closer is closed once the Conn
+// using it has shut down, so that it can release background resources.
+
+// serverLister is implemented by HostProviders that can list their servers
+// without moving on to the next one. While connected to a read-only server,
+// Conn probes that list for a read-write server; for other HostProviders it
+// probes the servers given to Init.
+type serverLister interface {
+	Servers() []string
+}
+
 // ConnectWithDialer establishes a new connection to a pool of zookeeper servers
 // using a custom Dialer. See Connect for further information about session timeout.
 // This method is deprecated and provided for compatibility: use the WithDialer option instead.
@@ -167,19 +221,23 @@ func ConnectWithDialer(servers []string, sessionTimeout time.Duration, dialer Di
 // the session timeout it's possible to reestablish a connection to a different
 // server and keep the same session. This is means any ephemeral nodes and
 // watches are maintained.
+//
+// A server address may carry a chroot suffix (e.g. "host:2181/apps/foo"). All
+// paths used with the returned Conn are then relative to that node.
 func Connect(servers []string, sessionTimeout time.Duration, options ...connOption) (*Conn, <-chan Event, error) {
 	if len(servers) == 0 {
 		return nil, nil, errors.New("zk: server list must not be empty")
 	}
 
+	servers, chroot, err := splitChroot(servers)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	srvs := make([]string, len(servers))
 
 	for i, addr := range servers {
-		if strings.Contains(addr, ":") {
-			srvs[i] = addr
-		} else {
-			srvs[i] = addr + ":" + strconv.Itoa(DefaultPort)
-		}
+		srvs[i] = formatServer(addr)
 	}
 
 	// Randomize the order of the servers to avoid creating hotspots
@@ -193,12 +251,17 @@ func Connect(servers []string, sessionTimeout time.Duration, options ...connOpti
 		state:        StateDisconnected,
 		eventChan:    ec,
 		shouldQuit:   make(chan struct{}),
+		loopDone:     make(chan struct{}),
 		sendChan:     make(chan *request, sendChanSize),
+		credsChanged: make(chan struct{}, 1),
 		requests:     make(map[int32]*request),
 		watchers:     make(map[watchPathType][]chan Event),
 		passwd:       emptyPassword,
 		logger:       DefaultLogger,
 		bufferSize:   defaultBufferSize,
+		chroot:       chroot,
+		rwProbe:      isReadWriteServer,
+		backoff:      defaultBackoff{},
 
 		// Debug
 		reconnectDelay: 0,
@@ -209,11 +272,18 @@ func Connect(servers []string, sessionTimeout time.Duration, options ...connOpti
 		option(conn)
 	}
 
+	if conn.chroot != "" {
+		if err := validatePath(conn.chroot, false); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	conn.buf = make([]byte, conn.bufferSize)
 
 	if err := conn.hostProvider.Init(srvs); err != nil {
 		return nil, nil, err
 	}
+	conn.servers = srvs
 
 	conn.setTimeouts(int32(sessionTimeout / time.Millisecond))
 
@@ -221,7 +291,13 @@ func Connect(servers []string, sessionTimeout time.Duration, options ...connOpti
 		conn.loop()
 		conn.flushRequests(ErrClosing)
 		conn.invalidateWatches(ErrClosing)
+		conn.connState.close()
+		conn.closeSubscribers()
+		if closer, ok := conn.hostProvider.(io.Closer); ok {
+			closer.Close()
+		}
 		close(conn.eventChan)
+		close(conn.loopDone)
 	}()
 	return conn, ec, nil
 }
@@ -247,7 +323,48 @@ func WithHostProvider(hostProvider HostProvider) connOption {
 	}
 }
 
-// Returns a connection option allowing the session to become read-only..
+// WithBackoffPolicy returns a connection option specifying how long to wait
+// between reconnection attempts. By default the connection waits one second
+// after each full rotation through the servers and retries forever.
+func WithBackoffPolicy(policy BackoffPolicy) connOption {
+	return func(c *Conn) {
+		c.backoff = policy
+	}
+}
+
+// WithLogger returns a connection option specifying the logger, which is
+// then in place before the connection starts logging. See SetLogger.
+func WithLogger(l Logger) connOption {
+	return func(c *Conn) {
+		c.logger = l
+	}
+}
+
+// WithChroot returns a connection option specifying a chroot path. It
+// overrides any chroot suffix given with the server addresses. Connect fails
+// with ErrInvalidPath if chroot isn't a valid absolute path.
+func WithChroot(chroot string) connOption {
+	return func(c *Conn) {
+		if chroot == "/" {
+			chroot = ""
+		}
+		c.chroot = chroot
+	}
+}
+
+// WithAuth returns a connection option registering credentials that are
+// submitted as soon as a session is established, and again after every
+// reconnect, just like credentials added with AddAuth.
+func WithAuth(scheme string, auth []byte) connOption {
+	return func(c *Conn) {
+		c.addCreds(scheme, auth)
+	}
+}
+
+// Returns a connection option allowing the session to become read-only.
+// While connected to a read-only server the client keeps probing the other
+// servers with the "isro" four letter word and moves the session to the first
+// read-write server it finds.
 func AllowReadOnly(b bool) connOption {
 	return func(c *Conn) {
 		c.allowReadOnly = b
@@ -266,11 +383,15 @@ func WithEventCallback(cb EventCallback) connOption {
 	}
 }
 
+// Close closes the session and the connection right away, failing the
+// outstanding requests with ErrClosing. See Shutdown for a graceful
+// alternative.
 func (c *Conn) Close() {
-	close(c.shouldQuit)
+	c.quit()
 
 	select {
 	case <-c.queueRequest(opClose, &closeRequest{}, &closeResponse{}, nil):
+	case <-c.loopDone:
 	case <-time.After(time.Second):
 	}
 }
@@ -297,7 +418,7 @@ const (
 )
 
 func (c *Conn) setTimeouts(sessionTimeoutMs int32) {
-	c.sessionTimeoutMs = sessionTimeoutMs
+	atomic.StoreInt32(&c.sessionTimeoutMs, sessionTimeoutMs)
 	sessionTimeout := time.Duration(sessionTimeoutMs) * time.Millisecond
 	c.connectTimeout = sessionTimeout / time.Duration(c.hostProvider.Len())
 	c.recvTimeout = sessionTimeout * 2 / 3
@@ -307,6 +428,7 @@ func (c *Conn) setTimeouts(sessionTimeoutMs int32) {
 func (c *Conn) setState(state State) {
 	atomic.StoreInt32((*int32)(&c.state), int32(state))
 	c.sendEvent(Event{Type: EventSession, State: state, Server: c.Server()})
+	c.connState.update(state, time.Duration(c.sessionTimeoutMs)*time.Millisecond)
 }
 
 func (c *Conn) sendEvent(evt Event) {
@@ -317,28 +439,51 @@ func (c *Conn) sendEvent(evt Event) {
 	select {
 	case c.eventChan <- evt:
 	default:
-		// panic("zk: event channel full - it must be monitored and never allowed to be full")
+		atomic.AddUint64(&c.droppedEvents, 1)
 	}
+
+	c.publishEvent(evt)
 }
 
 func (c *Conn) connect() error {
 	var retryStart bool
 	for {
 		c.serverMu.Lock()
-		c.server, retryStart = c.hostProvider.Next()
+		if c.rwServer != "" {
+			c.server, retryStart = c.rwServer, false
+			c.rwServer = ""
+		} else {
+			c.server, retryStart = c.hostProvider.Next()
+		}
 		c.serverMu.Unlock()
 		c.setState(StateConnecting)
 		if retryStart {
+			c.session.notify(ErrNoServer)
 			c.flushUnsentRequests(ErrNoServer)
-			select {
-			case <-time.After(time.Second):
-				// pass
-			case <-c.shouldQuit:
+			c.backoffState.Rotations++
+		}
+
+		if c.backoffState.Attempts > 0 {
+			c.backoffState.RetryStart = retryStart
+			delay, ok := c.backoff.Delay(c.backoffState)
+			if !ok {
+				c.logger.Printf("Giving up after %d connection attempts", c.backoffState.Attempts)
 				c.setState(StateDisconnected)
-				c.flushUnsentRequests(ErrClosing)
-				return ErrClosing
+				c.flushUnsentRequests(ErrNoServer)
+				return ErrNoServer
+			}
+			if delay > 0 {
+				select {
+				case <-time.After(delay):
+					// pass
+				case <-c.shouldQuit:
+					c.setState(StateDisconnected)
+					c.flushUnsentRequests(ErrClosing)
+					return ErrClosing
+				}
 			}
 		}
+		c.backoffState.Attempts++
 
 		zkConn, err := c.dialer("tcp", c.Server(), c.connectTimeout)
 		if err == nil {
@@ -348,21 +493,82 @@ func (c *Conn) connect() error {
 			return nil
 		}
 
+		atomic.AddInt64(&c.failedDials, 1)
 		c.logger.Printf("Failed to connect to %s: %+v", c.Server(), err)
 	}
 }
 
-func (c *Conn) resendZkAuth(reauthReadyChan chan struct{}) {
-	c.credsMu.Lock()
-	defer c.credsMu.Unlock()
+// seekReadWriteServer probes the other servers until one of them accepts
+// writes, then closes the current connection so that the session is moved
+// there. It returns early when closeChan is closed.
+func (c *Conn) seekReadWriteServer(closeChan <-chan struct{}) {
+	current := c.Server()
+	delay := minRWProbeDelay
+	for {
+		select {
+		case <-closeChan:
+			return
+		case <-c.shouldQuit:
+			return
+		case <-time.After(delay):
+		}
+
+		// Probe a snapshot of the servers: moving the HostProvider on would
+		// count as failed connection attempts.
+		servers := c.servers
+		if lister, ok := c.hostProvider.(serverLister); ok {
+			servers = lister.Servers()
+		}
+		for _, server := range servers {
+			select {
+			case <-closeChan:
+				return
+			default:
+			}
+
+			if server == current {
+				continue
+			}
+			if rw, err := c.rwProbe(server, c.connectTimeout); err != nil || !rw {
+				continue
+			}
+
+			c.logger.Printf("Found read-write server %s, leaving read-only server %s", server, current)
+			c.serverMu.Lock()
+			c.rwServer = server
+			c.serverMu.Unlock()
+			c.conn.Close()
+			return
+		}
+
+		delay *= 2
+		if delay > maxRWProbeDelay {
+			delay = maxRWProbeDelay
+		}
+	}
+}
 
-	defer close(reauthReadyChan)
+// resendZkAuth re-submits the stored credentials, followed by the ones last
+// fetched from the AuthProviders, and returns the first error, if any.
+func (c *Conn) resendZkAuth() error {
+	// The lock isn't held while waiting for the server, so that AddAuth and
+	// ReplaceAuth don't wait for it. Their credentials are sent after these.
+	c.credsMu.Lock()
+	creds := append(c.creds[:len(c.creds):len(c.creds)], c.providerAuth...)
+	providerErr := c.providerErr
+	c.credsMu.Unlock()
+	if providerErr != nil {
+		// The other credentials are still submitted, so that a failing
+		// provider doesn't drop identities it has nothing to do with.
+		c.logger.Printf("Failed to get credentials from auth provider: %s", providerErr)
+	}
 
-	if len(c.creds) > 0 {
+	if len(creds) > 0 {
 		c.logger.Printf("Re-submitting %d credentials id=0x%x after reconnect",
-			c.SessionID(), len(c.creds))
+			len(creds), c.SessionID())
 	}
-	for _, cred := range c.creds {
+	var firstErr error
+	for _, cred := range creds {
 		resChan, err := c.sendRequest(
 			opSetAuth,
 			&setAuthRequest{Type: 0,
@@ -374,17 +580,31 @@ func (c *Conn) resendZkAuth(reauthReadyChan chan struct{}) {
 
 		if err != nil {
 			c.logger.Printf("Call to sendRequest failed during credential resubmit: %s", err)
-			// FIXME(prozlach): lets ignore errors for now
+			if firstErr == nil {
+				firstErr = err
+			}
 			continue
 		}
 
-		res := <-resChan
+		var res response
+		select {
+		case res = <-resChan:
+		case <-c.closeChan:
+			// The connection was lost before the server answered.
+			return ErrConnectionClosed
+		}
 		if res.err != nil {
 			c.logger.Printf("Credential re-submit failed: %s", res.err)
-			// FIXME(prozlach): lets ignore errors for now
+			if firstErr == nil {
+				firstErr = c.opError(opSetAuth, "", res.zxid, res.err)
+			}
 			continue
 		}
 	}
+	if providerErr != nil {
+		return providerErr
+	}
+	return firstErr
 }
 
 func (c *Conn) sendRequest(
@@ -415,7 +635,7 @@ func (c *Conn) sendRequest(
 func (c *Conn) loop() {
 	for {
 		if err := c.connect(); err != nil {
-			// c.Close() was called
+			// c.Close() was called or the backoff policy gave up
 			return
 		}
 
@@ -430,7 +650,10 @@ func (c *Conn) loop() {
 		case err == nil:
 			c.logger.Printf("Authenticated: id=0x%x, timeout=%d", c.SessionID(), c.sessionTimeoutMs)
 			c.hostProvider.Connected()        // mark success
+			c.backoffState = BackoffState{}   // reset reconnect backoff
 			c.closeChan = make(chan struct{}) // channel to tell send loop stop
+			c.pings.reset()
+			atomic.AddInt64(&c.connects, 1)
 			reauthChan := make(chan struct{}) // channel to tell send loop that authdata has been resubmitted
 
 			var wg sync.WaitGroup
@@ -454,10 +677,20 @@ func (c *Conn) loop() {
 				wg.Done()
 			}()
 
-			c.resendZkAuth(reauthChan)
+			if c.State() == StateConnectedReadOnly {
+				wg.Add(1)
+				go func(closeChan <-chan struct{}) {
+					c.seekReadWriteServer(closeChan)
+					wg.Done()
+				}(c.closeChan)
+			}
+
+			c.session.notify(c.reauthenticate())
+			close(reauthChan)
 
 			c.sendSetWatches()
 			wg.Wait()
+			c.session.reset()
 		}
 
 		c.setState(StateDisconnected)
@@ -513,7 +746,7 @@ func (c *Conn) invalidateWatches(err error) {
 
 	if len(c.watchers) >= 0 {
 		for pathType, watchers := range c.watchers {
-			ev := Event{Type: EventNotWatching, State: StateDisconnected, Path: pathType.path, Err: err}
+			ev := Event{Type: EventNotWatching, State: StateDisconnected, Path: c.stripChroot(pathType.path), Err: err}
 			for _, ch := range watchers {
 				ch <- ev
 				close(ch)
@@ -532,7 +765,7 @@ func (c *Conn) sendSetWatches() {
 	}
 
 	req := &setWatchesRequest{
-		RelativeZxid: c.lastZxid,
+		RelativeZxid: atomic.LoadInt64(&c.lastZxid),
 		DataWatches:  make([]string, 0),
 		ExistWatches: make([]string, 0),
 		ChildWatches: make([]string, 0),
@@ -568,13 +801,21 @@ func (c *Conn) sendSetWatches() {
 func (c *Conn) authenticate() error {
 	buf := make([]byte, 256)
 
+	// A session created by a read-only server is unknown to the read-write
+	// servers, which would report it as expired. Like the Java client, ask
+	// for a new session until a read-write server has been seen.
+	sessionID, passwd := c.SessionID(), c.passwd
+	if !c.seenRWServer {
+		sessionID, passwd = 0, emptyPassword
+	}
+
 	// Encode and send a connect request.
 	n, err := encodePacket(buf[4:], &connectRequest{
 		ProtocolVersion: protocolVersion,
-		LastZxidSeen:    c.lastZxid,
+		LastZxidSeen:    atomic.LoadInt64(&c.lastZxid),
 		TimeOut:         c.sessionTimeoutMs,
-		SessionID:       c.SessionID(),
-		Passwd:          c.passwd,
+		SessionID:       sessionID,
+		Passwd:          passwd,
 		ReadOnly:        c.allowReadOnly,
 	})
 	if err != nil {
@@ -616,7 +857,9 @@ func (c *Conn) authenticate() error {
 	if r.SessionID == 0 {
 		atomic.StoreInt64(&c.sessionID, int64(0))
 		c.passwd = emptyPassword
-		c.lastZxid = 0
+		atomic.StoreInt64(&c.lastZxid, 0)
+		atomic.AddInt64(&c.expirations, 1)
+		c.resetEphemerals()
 		c.setState(StateExpired)
 		return ErrSessionExpired
 	}
@@ -627,6 +870,7 @@ func (c *Conn) authenticate() error {
 	if r.ReadOnly {
 		c.setState(StateConnectedReadOnly)
 	} else {
+		c.seenRWServer = true
 		// FIXME(msolo) This doesn't make much sense and has no analog in
 		// any other client (Java, C)
 		c.setState(StateHasSession)
@@ -661,6 +905,7 @@ func (c *Conn) sendData(req *request) error {
 		return ErrConnectionClosed
 	default:
 	}
+	req.sent = time.Now()
 	c.requests[req.xid] = req
 	c.requestsLock.Unlock()
 
@@ -680,6 +925,24 @@ func (c *Conn) sendLoop() error {
 	pingTicker := time.NewTicker(c.pingInterval)
 	defer pingTicker.Stop()
 
+	var livenessC <-chan time.Time
+	if c.pingTimeout > 0 {
+		interval := c.pingTimeout / 4
+		if interval < 10*time.Millisecond {
+			interval = 10 * time.Millisecond
+		}
+		livenessTicker := time.NewTicker(interval)
+		defer livenessTicker.Stop()
+		livenessC = livenessTicker.C
+	}
+
+	select {
+	case <-c.closeChan:
+		// The connection was dropped before the credentials were accepted.
+		return nil
+	default:
+	}
+
 	for {
 		select {
 		case req := <-c.sendChan:
@@ -687,19 +950,14 @@ func (c *Conn) sendLoop() error {
 				return err
 			}
 		case <-pingTicker.C:
-			n, err := encodePacket(c.buf[4:], &requestHeader{Xid: -2, Opcode: opPing})
-			if err != nil {
-				panic("zk: opPing should never fail to serialize")
+			if err := c.sendPing(); err != nil {
+				return err
 			}
-
-			binary.BigEndian.PutUint32(c.buf[:4], uint32(n))
-
-			c.conn.SetWriteDeadline(time.Now().Add(c.recvTimeout))
-			_, err = c.conn.Write(c.buf[:n+4])
-			c.conn.SetWriteDeadline(time.Time{})
-			if err != nil {
+		case now := <-livenessC:
+			if c.pings.expired(now, c.pingTimeout) {
+				c.logger.Printf("No ping response from %s within %v", c.Server(), c.pingTimeout)
 				c.conn.Close()
-				return err
+				return errPingTimeout
 			}
 		case <-c.closeChan:
 			return nil
@@ -707,6 +965,26 @@ func (c *Conn) sendLoop() error {
 	}
 }
 
+// sendPing writes a ping. Only one goroutine may write to c.conn at a time.
+func (c *Conn) sendPing() error {
+	n, err := encodePacket(c.buf[4:], &requestHeader{Xid: -2, Opcode: opPing})
+	if err != nil {
+		panic("zk: opPing should never fail to serialize")
+	}
+
+	binary.BigEndian.PutUint32(c.buf[:4], uint32(n))
+
+	c.pings.sent(time.Now())
+	c.conn.SetWriteDeadline(time.Now().Add(c.recvTimeout))
+	_, err = c.conn.Write(c.buf[:n+4])
+	c.conn.SetWriteDeadline(time.Time{})
+	if err != nil {
+		c.conn.Close()
+		return err
+	}
+	return nil
+}
+
 func (c *Conn) recvLoop(conn net.Conn) error {
 	buf := make([]byte, c.bufferSize)
 	for {
@@ -743,7 +1021,7 @@ func (c *Conn) recvLoop(conn net.Conn) error {
 			ev := Event{
 				Type:  res.Type,
 				State: res.State,
-				Path:  res.Path,
+				Path:  c.stripChroot(res.Path),
 				Err:   nil,
 			}
 			c.sendEvent(ev)
@@ -769,12 +1047,12 @@ func (c *Conn) recvLoop(conn net.Conn) error {
 			}
 			c.watchersLock.Unlock()
 		} else if res.Xid == -2 {
-			// Ping response. Ignore.
+			c.pings.received(time.Now())
 		} else if res.Xid < 0 {
 			c.logger.Printf("Xid < 0 (%d) but not ping or watcher event", res.Xid)
 		} else {
 			if res.Zxid > 0 {
-				c.lastZxid = res.Zxid
+				atomic.StoreInt64(&c.lastZxid, res.Zxid)
 			}
 
 			c.requestsLock.Lock()
@@ -827,36 +1105,43 @@ func (c *Conn) queueRequest(opcode int32, req interface{}, res interface{}, recv
 		recvChan:   make(chan response, 1),
 		recvFunc:   recvFunc,
 	}
-	c.sendChan <- rq
+	select {
+	case <-c.loopDone:
+		// Nothing reads sendChan anymore.
+		rq.recvChan <- response{-1, ErrClosing}
+		return rq.recvChan
+	default:
+	}
+	select {
+	case c.sendChan <- rq:
+	case <-c.loopDone:
+		rq.recvChan <- response{-1, ErrClosing}
+	}
 	return rq.recvChan
 }
 
 func (c *Conn) request(opcode int32, req interface{}, res interface{}, recvFunc func(*request, *responseHeader, error)) (int64, error) {
+	if !c.beginRequest() {
+		return 0, ErrClosing
+	}
+	defer c.endRequest()
 	r := <-c.queueRequest(opcode, req, res, recvFunc)
 	return r.zxid, r.err
 }
 
 func (c *Conn) AddAuth(scheme string, auth []byte) error {
-	_, err := c.request(opSetAuth, &setAuthRequest{Type: 0, Scheme: scheme, Auth: auth}, &setAuthResponse{}, nil)
+	zxid, err := c.request(opSetAuth, &setAuthRequest{Type: 0, Scheme: scheme, Auth: auth}, &setAuthResponse{}, nil)
 
 	if err != nil {
-		return err
-	}
-
-	// Remember authdata so that it can be re-submitted on reconnect
-	//
-	// FIXME(prozlach): For now we treat "userfoo:passbar" and "userfoo:passbar2"
-	// as two different entries, which will be re-submitted on reconnet. Some
-	// research is needed on how ZK treats these cases and
-	// then maybe switch to something like "map[username] = password" to allow
-	// only single password for given user with users being unique.
-	obj := authCreds{
-		scheme: scheme,
-		auth:   auth,
+		return c.opError(opSetAuth, "", zxid, err)
 	}
 
+	// Remember authdata so that it can be re-submitted on reconnect.
+	// "userfoo:passbar" and "userfoo:passbar2" are distinct identities to
+	// the server, so both are kept; only exact duplicates are dropped. Use
+	// ReplaceAuth to swap credentials instead.
 	c.credsMu.Lock()
-	c.creds = append(c.creds, obj)
+	c.addCreds(scheme, auth)
 	c.credsMu.Unlock()
 
 	return nil
@@ -864,41 +1149,43 @@ func (c *Conn) AddAuth(scheme string, auth []byte) error {
 
 func (c *Conn) Children(path string) ([]string, *Stat, error) {
 	res := &getChildren2Response{}
-	_, err := c.request(opGetChildren2, &getChildren2Request{Path: path, Watch: false}, res, nil)
-	return res.Children, &res.Stat, err
+	zxid, err := c.request(opGetChildren2, &getChildren2Request{Path: c.prefixChroot(path), Watch: false}, res, nil)
+	return res.Children, &res.Stat, c.opError(opGetChildren2, path, zxid, err)
 }
 
 func (c *Conn) ChildrenW(path string) ([]string, *Stat, <-chan Event, error) {
 	var ech <-chan Event
+	serverPath := c.prefixChroot(path)
 	res := &getChildren2Response{}
-	_, err := c.request(opGetChildren2, &getChildren2Request{Path: path, Watch: true}, res, func(req *request, res *responseHeader, err error) {
+	zxid, err := c.request(opGetChildren2, &getChildren2Request{Path: serverPath, Watch: true}, res, func(req *request, res *responseHeader, err error) {
 		if err == nil {
-			ech = c.addWatcher(path, watchTypeChild)
+			ech = c.addWatcher(serverPath, watchTypeChild)
 		}
 	})
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, c.opError(opGetChildren2, path, zxid, err)
 	}
 	return res.Children, &res.Stat, ech, err
 }
 
 func (c *Conn) Get(path string) ([]byte, *Stat, error) {
 	res := &getDataResponse{}
-	_, err := c.request(opGetData, &getDataRequest{Path: path, Watch: false}, res, nil)
-	return res.Data, &res.Stat, err
+	zxid, err := c.request(opGetData, &getDataRequest{Path: c.prefixChroot(path), Watch: false}, res, nil)
+	return res.Data, &res.Stat, c.opError(opGetData, path, zxid, err)
 }
 
 // GetW returns the contents of a znode and sets a watch
 func (c *Conn) GetW(path string) ([]byte, *Stat, <-chan Event, error) {
 	var ech <-chan Event
+	serverPath := c.prefixChroot(path)
 	res := &getDataResponse{}
-	_, err := c.request(opGetData, &getDataRequest{Path: path, Watch: true}, res, func(req *request, res *responseHeader, err error) {
+	zxid, err := c.request(opGetData, &getDataRequest{Path: serverPath, Watch: true}, res, func(req *request, res *responseHeader, err error) {
 		if err == nil {
-			ech = c.addWatcher(path, watchTypeData)
+			ech = c.addWatcher(serverPath, watchTypeData)
 		}
 	})
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, c.opError(opGetData, path, zxid, err)
 	}
 	return res.Data, &res.Stat, ech, err
 }
@@ -908,24 +1195,66 @@ func (c *Conn) Set(path string, data []byte, version int32) (*Stat, error) {
 		return nil, ErrInvalidPath
 	}
 	res := &setDataResponse{}
-	_, err := c.request(opSetData, &SetDataRequest{path, data, version}, res, nil)
-	return &res.Stat, err
+	zxid, err := c.request(opSetData, &SetDataRequest{c.prefixChroot(path), data, version}, res, nil)
+	return &res.Stat, c.opError(opSetData, path, zxid, err)
 }
 
 func (c *Conn) Create(path string, data []byte, flags int32, acl []ACL) (string, error) {
 	res := &createResponse{}
-	_, err := c.request(opCreate, &CreateRequest{path, data, acl, flags}, res, nil)
-	return res.Path, err
+	zxid, err := c.request(opCreate, &CreateRequest{c.prefixChroot(path), data, acl, flags}, res, nil)
+	if err != nil {
+		return "", c.opError(opCreate, path, zxid, err)
+	}
+	if flags&FlagEphemeral != 0 {
+		c.trackEphemeral(res.Path)
+	}
+	return c.stripChroot(res.Path), err
 }
 
 // Return Stat data for the created node.
 func (c *Conn) Create2(path string, data []byte, flags int32, acl []ACL) (string, *Stat, error) {
 	res := &create2Response{}
-	_, err := c.request(opCreate2, &CreateRequest{path, data, acl, flags}, res, nil)
+	zxid, err := c.request(opCreate2, &CreateRequest{c.prefixChroot(path), data, acl, flags}, res, nil)
+	if err != nil {
+		return "", nil, c.opError(opCreate2, path, zxid, err)
+	}
+	if flags&FlagEphemeral != 0 {
+		c.trackEphemeral(res.Path)
+	}
+	return c.stripChroot(res.Path), &res.Stat, err
+}
+
+// CreateContainer creates a container node: a persistent node that the
+// server deletes some time after its last child was deleted. It requires
+// ZooKeeper 3.5.3 or later.
+func (c *Conn) CreateContainer(path string, data []byte, acl []ACL) (string, *Stat, error) {
+	res := &create2Response{}
+	zxid, err := c.request(opCreateContainer, &CreateRequest{c.prefixChroot(path), data, acl, createModeContainer}, res, nil)
+	if err != nil {
+		return "", nil, c.opError(opCreateContainer, path, zxid, err)
+	}
+	return c.stripChroot(res.Path), &res.Stat, nil
+}
+
+// CreateTTL creates a persistent node, sequential if flags has
+// FlagSequence, that the server deletes once it has had no children and no
+// changes for ttl. It requires ZooKeeper 3.5.3 or later with
+// zookeeper.extendedTypesEnabled set.
+func (c *Conn) CreateTTL(path string, data []byte, flags int32, acl []ACL, ttl time.Duration) (string, *Stat, error) {
+	if flags&FlagEphemeral != 0 {
+		return "", nil, ErrBadArguments
+	}
+	mode := int32(createModePersistentTTL)
+	if flags&FlagSequence != 0 {
+		mode = createModePersistentSequentialTTL
+	}
+	req := &createTTLRequest{c.prefixChroot(path), data, acl, mode, int64(ttl / time.Millisecond)}
+	res := &create2Response{}
+	zxid, err := c.request(opCreateTTL, req, res, nil)
 	if err != nil {
-		return "", nil, err
+		return "", nil, c.opError(opCreateTTL, path, zxid, err)
 	}
-	return res.Path, &res.Stat, err
+	return c.stripChroot(res.Path), &res.Stat, nil
 }
 
 // CreateProtectedEphemeralSequential fixes a race condition if the server crashes
@@ -933,38 +1262,39 @@ func (c *Conn) Create2(path string, data []byte, flags int32, acl []ACL) (string
 // ephemeral node still exists. Therefore, on reconnect we need to check if a node
 // with a GUID generated on create exists.
 func (c *Conn) CreateProtectedEphemeralSequential(path string, data []byte, acl []ACL) (string, error) {
-	var guid [16]byte
-	_, err := io.ReadFull(rand.Reader, guid[:16])
+	return createProtectedEphemeralSequential(c, path, data, acl)
+}
+
+// ephemeralAdopter is implemented by the Clients that track the ephemeral
+// nodes of their session for Shutdown.
+type ephemeralAdopter interface {
+	adoptEphemeral(path string)
+}
+
+func createProtectedEphemeralSequential(c Client, path string, data []byte, acl []ACL) (string, error) {
+	protectedPath, rootPath, guid, err := protectedName(path)
 	if err != nil {
 		return "", err
 	}
-	guidStr := fmt.Sprintf("%x", guid)
-
-	parts := strings.Split(path, "/")
-	parts[len(parts)-1] = fmt.Sprintf("%s%s-%s", protectedPrefix, guidStr, parts[len(parts)-1])
-	rootPath := strings.Join(parts[:len(parts)-1], "/")
-	protectedPath := strings.Join(parts, "/")
 
 	var newPath string
 	for i := 0; i < 3; i++ {
 		newPath, err = c.Create(protectedPath, data, FlagEphemeral|FlagSequence, acl)
-		switch err {
-		case ErrSessionExpired:
+		switch {
+		case errors.Is(err, ErrSessionExpired):
 			// No need to search for the node since it can't exist. Just try again.
-		case ErrConnectionClosed:
-			children, _, err := c.Children(rootPath)
+		case errors.Is(err, ErrConnectionClosed):
+			found, err := findProtected(c, rootPath, guid)
 			if err != nil {
 				return "", err
 			}
-			for _, p := range children {
-				parts := strings.Split(p, "/")
-				if pth := parts[len(parts)-1]; strings.HasPrefix(pth, protectedPrefix) {
-					if g := pth[len(protectedPrefix) : len(protectedPrefix)+32]; g == guidStr {
-						return rootPath + "/" + p, nil
-					}
+			if found != "" {
+				if a, ok := c.(ephemeralAdopter); ok {
+					a.adoptEphemeral(found)
 				}
+				return found, nil
 			}
-		case nil:
+		case err == nil:
 			return newPath, nil
 		default:
 			return "", err
@@ -973,30 +1303,71 @@ func (c *Conn) CreateProtectedEphemeralSequential(path string, data []byte, acl
 	return "", err
 }
 
+// protectedName prefixes the last element of path with a random GUID so
+// that the node can be recognized after a connection loss. It returns the
+// new path, its parent and the GUID.
+func protectedName(path string) (protectedPath, rootPath, guid string, err error) {
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[:16]); err != nil {
+		return "", "", "", err
+	}
+	guid = fmt.Sprintf("%x", b)
+
+	parts := strings.Split(path, "/")
+	parts[len(parts)-1] = fmt.Sprintf("%s%s-%s", protectedPrefix, guid, parts[len(parts)-1])
+	rootPath = strings.Join(parts[:len(parts)-1], "/")
+	protectedPath = strings.Join(parts, "/")
+	return protectedPath, rootPath, guid, nil
+}
+
+// findProtected looks for a child of rootPath created by protectedName with
+// the given GUID and returns its path, or "" if there is none.
+func findProtected(c Client, rootPath, guid string) (string, error) {
+	parent := rootPath
+	if parent == "" {
+		parent = "/"
+	}
+	children, _, err := c.Children(parent)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range children {
+		if strings.HasPrefix(p, protectedPrefix+guid) {
+			return rootPath + "/" + p, nil
+		}
+	}
+	return "", nil
+}
+
 func (c *Conn) Delete(path string, version int32) error {
-	_, err := c.request(opDelete, &DeleteRequest{path, version}, &deleteResponse{}, nil)
-	return err
+	serverPath := c.prefixChroot(path)
+	zxid, err := c.request(opDelete, &DeleteRequest{serverPath, version}, &deleteResponse{}, nil)
+	if err == nil {
+		c.untrackEphemeral(serverPath)
+	}
+	return c.opError(opDelete, path, zxid, err)
 }
 
 func (c *Conn) Exists(path string) (bool, *Stat, error) {
 	res := &existsResponse{}
-	_, err := c.request(opExists, &existsRequest{Path: path, Watch: false}, res, nil)
+	zxid, err := c.request(opExists, &existsRequest{Path: c.prefixChroot(path), Watch: false}, res, nil)
 	exists := true
 	if err == ErrNoNode {
 		exists = false
 		err = nil
 	}
-	return exists, &res.Stat, err
+	return exists, &res.Stat, c.opError(opExists, path, zxid, err)
 }
 
 func (c *Conn) ExistsW(path string) (bool, *Stat, <-chan Event, error) {
 	var ech <-chan Event
+	serverPath := c.prefixChroot(path)
 	res := &existsResponse{}
-	_, err := c.request(opExists, &existsRequest{Path: path, Watch: true}, res, func(req *request, res *responseHeader, err error) {
+	zxid, err := c.request(opExists, &existsRequest{Path: serverPath, Watch: true}, res, func(req *request, res *responseHeader, err error) {
 		if err == nil {
-			ech = c.addWatcher(path, watchTypeData)
+			ech = c.addWatcher(serverPath, watchTypeData)
 		} else if err == ErrNoNode {
-			ech = c.addWatcher(path, watchTypeExist)
+			ech = c.addWatcher(serverPath, watchTypeExist)
 		}
 	})
 	exists := true
@@ -1005,26 +1376,26 @@ func (c *Conn) ExistsW(path string) (bool, *Stat, <-chan Event, error) {
 		err = nil
 	}
 	if err != nil {
-		return false, nil, nil, err
+		return false, nil, nil, c.opError(opExists, path, zxid, err)
 	}
 	return exists, &res.Stat, ech, err
 }
 
 func (c *Conn) GetACL(path string) ([]ACL, *Stat, error) {
 	res := &getAclResponse{}
-	_, err := c.request(opGetAcl, &getAclRequest{Path: path}, res, nil)
-	return res.Acl, &res.Stat, err
+	zxid, err := c.request(opGetAcl, &getAclRequest{Path: c.prefixChroot(path)}, res, nil)
+	return res.Acl, &res.Stat, c.opError(opGetAcl, path, zxid, err)
 }
 func (c *Conn) SetACL(path string, acl []ACL, version int32) (*Stat, error) {
 	res := &setAclResponse{}
-	_, err := c.request(opSetAcl, &setAclRequest{Path: path, Acl: acl, Version: version}, res, nil)
-	return &res.Stat, err
+	zxid, err := c.request(opSetAcl, &setAclRequest{Path: c.prefixChroot(path), Acl: acl, Version: version}, res, nil)
+	return &res.Stat, c.opError(opSetAcl, path, zxid, err)
 }
 
 func (c *Conn) Sync(path string) (string, error) {
 	res := &syncResponse{}
-	_, err := c.request(opSync, &syncRequest{Path: path}, res, nil)
-	return res.Path, err
+	zxid, err := c.request(opSync, &syncRequest{Path: c.prefixChroot(path)}, res, nil)
+	return c.stripChroot(res.Path), c.opError(opSync, path, zxid, err)
 }
 
 type MultiResponse struct {
@@ -1043,27 +1414,88 @@ func (c *Conn) Multi(ops ...interface{}) ([]MultiResponse, error) {
 	}
 	for _, op := range ops {
 		var opCode int32
-		switch op.(type) {
+		// Copy the ops so that the caller's requests are not modified when
+		// the chroot prefix is applied.
+		switch o := op.(type) {
 		case *CreateRequest:
 			opCode = opCreate
+			r := *o
+			r.Path = c.prefixChroot(r.Path)
+			op = &r
 		case *SetDataRequest:
 			opCode = opSetData
+			r := *o
+			r.Path = c.prefixChroot(r.Path)
+			op = &r
 		case *DeleteRequest:
 			opCode = opDelete
+			r := *o
+			r.Path = c.prefixChroot(r.Path)
+			op = &r
 		case *CheckVersionRequest:
 			opCode = opCheck
+			r := *o
+			r.Path = c.prefixChroot(r.Path)
+			op = &r
 		default:
 			return nil, fmt.Errorf("unknown operation type %T", op)
 		}
 		req.Ops = append(req.Ops, multiRequestOp{multiHeader{opCode, false, -1}, op})
 	}
 	res := &multiResponse{}
-	_, err := c.request(opMulti, req, res, nil)
+	zxid, err := c.request(opMulti, req, res, nil)
+	if err == nil {
+		for i, op := range req.Ops {
+			switch o := op.Op.(type) {
+			case *CreateRequest:
+				if o.Flags&FlagEphemeral != 0 && i < len(res.Ops) {
+					c.trackEphemeral(res.Ops[i].String)
+				}
+			case *DeleteRequest:
+				c.untrackEphemeral(o.Path)
+			}
+		}
+	}
 	mr := make([]MultiResponse, len(res.Ops))
 	for i, op := range res.Ops {
-		mr[i] = MultiResponse{Stat: op.Stat, String: op.String, Error: op.Err.toError()}
+		str := op.String
+		if str != "" {
+			str = c.stripChroot(str)
+		}
+		mr[i] = MultiResponse{Stat: op.Stat, String: str, Error: op.Err.toError()}
+	}
+	return mr, c.opError(opMulti, "", zxid, err)
+}
+
+// Chroot returns the path prefix applied to every request, or "" if the
+// connection string had no chroot suffix.
+func (c *Conn) Chroot() string {
+	return c.chroot
+}
+
+// prefixChroot converts a client path into the path sent to the server.
+func (c *Conn) prefixChroot(path string) string {
+	if c.chroot == "" {
+		return path
+	}
+	if path == "/" {
+		return c.chroot
+	}
+	return c.chroot + path
+}
+
+// stripChroot converts a path returned by the server into a client path.
+func (c *Conn) stripChroot(path string) string {
+	if c.chroot == "" {
+		return path
+	}
+	if path == c.chroot {
+		return "/"
+	}
+	if strings.HasPrefix(path, c.chroot+"/") {
+		return path[len(c.chroot):]
 	}
-	return mr, err
+	return path
 }
 
 // Server returns the current or last-connected server name.
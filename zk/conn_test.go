@@ -0,0 +1,300 @@
+package zk
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSeekReadWriteServer(t *testing.T) {
+	t.Parallel()
+
+	hp := &DNSHostProvider{lookupHost: func(host string) ([]string, error) {
+		return []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}, nil
+	}}
+	if err := hp.Init([]string{"foo.example.com:2181"}); err != nil {
+		t.Fatal(err)
+	}
+	current, _ := hp.Next()
+	hp.Connected()
+	target := "192.0.2.3:2181"
+	if current == target {
+		target = "192.0.2.2:2181"
+	}
+	hp.mu.Lock()
+	curr, last := hp.curr, hp.last
+	hp.mu.Unlock()
+
+	client, server := net.Pipe()
+	defer server.Close()
+
+	probed := make(chan string, 10)
+	c := &Conn{
+		hostProvider: hp,
+		server:       current,
+		conn:         client,
+		shouldQuit:   make(chan struct{}),
+		logger:       DefaultLogger,
+		rwProbe: func(s string, timeout time.Duration) (bool, error) {
+			probed <- s
+			return s == target, nil
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.seekReadWriteServer(make(chan struct{}))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("seekReadWriteServer did not find the read-write server")
+	}
+	close(probed)
+	for s := range probed {
+		if s == current {
+			t.Errorf("the current server %s should not be probed", s)
+		}
+	}
+	if c.rwServer != target {
+		t.Errorf("rwServer = %q; want %q", c.rwServer, target)
+	}
+	hp.mu.Lock()
+	if hp.curr != curr || hp.last != last {
+		t.Errorf("probing moved the host provider from %d/%d to %d/%d", curr, last, hp.curr, hp.last)
+	}
+	hp.mu.Unlock()
+	if _, err := server.Write([]byte{0}); err == nil {
+		t.Error("connection to the read-only server should be closed")
+	}
+}
+
+func TestReadOnlySessionNotResumed(t *testing.T) {
+	t.Parallel()
+
+	hp := &DNSHostProvider{lookupHost: func(host string) ([]string, error) {
+		return []string{"192.0.2.1"}, nil
+	}}
+	if err := hp.Init([]string{"foo.example.com:2181"}); err != nil {
+		t.Fatal(err)
+	}
+	c := &Conn{hostProvider: hp, logger: DefaultLogger, passwd: emptyPassword, recvTimeout: time.Second}
+
+	// handshake runs authenticate against a server answering with the given
+	// session and returns the session ID of the connect request.
+	handshake := func(sessionID int64, readOnly bool) int64 {
+		client, server := net.Pipe()
+		defer client.Close()
+		c.conn = client
+		got := make(chan int64, 1)
+		go func() {
+			defer server.Close()
+			buf := make([]byte, 256)
+			if _, err := io.ReadFull(server, buf[:4]); err != nil {
+				return
+			}
+			n := int(binary.BigEndian.Uint32(buf[:4]))
+			if _, err := io.ReadFull(server, buf[:n]); err != nil {
+				return
+			}
+			var req connectRequest
+			decodePacket(buf[:n], &req)
+			got <- req.SessionID
+			n, _ = encodePacket(buf[4:], &connectResponse{TimeOut: 30000, SessionID: sessionID, Passwd: make([]byte, 16), ReadOnly: readOnly})
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			server.Write(buf[:n+4])
+		}()
+		if err := c.authenticate(); err != nil {
+			t.Fatal(err)
+		}
+		return <-got
+	}
+
+	if id := handshake(0x10, true); id != 0 {
+		t.Errorf("first connect request has session 0x%x; want 0", id)
+	}
+	if id := handshake(0x20, false); id != 0 {
+		t.Errorf("connect request after a read-only session has session 0x%x; want 0", id)
+	}
+	if s := c.State(); s != StateHasSession {
+		t.Errorf("state = %v; want StateHasSession", s)
+	}
+	if id := handshake(0x20, true); id != 0x20 {
+		t.Errorf("connect request after a read-write session has session 0x%x; want 0x20", id)
+	}
+}
+
+// testServer is a minimal in-process ZooKeeper server, reached through its
+// dial method. Pings are answered automatically; every other request is
+// passed to handle, which returns the response struct (nil for none) and an
+// error code. Requests are handled concurrently, so a handler may block
+// without stalling pings.
+type testServer struct {
+	handle func(opcode int32, req interface{}) (interface{}, ErrCode)
+
+	mu        sync.Mutex
+	sessionID int64
+	zxid      int64
+	ops       []int32 // opcodes received, in order
+}
+
+func (s *testServer) dial(network, address string, timeout time.Duration) (net.Conn, error) {
+	client, server := net.Pipe()
+	go s.serve(server)
+	return client, nil
+}
+
+func (s *testServer) received() []int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int32(nil), s.ops...)
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 1<<16)
+	read := func() ([]byte, error) {
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			return nil, err
+		}
+		n := int(binary.BigEndian.Uint32(buf[:4]))
+		_, err := io.ReadFull(conn, buf[:n])
+		return buf[:n], err
+	}
+	var writeMu sync.Mutex
+	write := func(parts ...interface{}) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		out := make([]byte, 1<<16)
+		n := 4
+		for _, p := range parts {
+			m, err := encodePacket(out[n:], p)
+			if err != nil {
+				return err
+			}
+			n += m
+		}
+		binary.BigEndian.PutUint32(out[:4], uint32(n-4))
+		_, err := conn.Write(out[:n])
+		return err
+	}
+
+	b, err := read()
+	if err != nil {
+		return
+	}
+	var creq connectRequest
+	if _, err := decodePacket(b, &creq); err != nil {
+		return
+	}
+	s.mu.Lock()
+	if s.sessionID == 0 {
+		s.sessionID = 0x1234
+	}
+	cres := &connectResponse{TimeOut: creq.TimeOut, SessionID: s.sessionID, Passwd: make([]byte, 16)}
+	s.mu.Unlock()
+	if write(cres) != nil {
+		return
+	}
+
+	for {
+		b, err := read()
+		if err != nil {
+			return
+		}
+		var hdr requestHeader
+		n, err := decodePacket(b, &hdr)
+		if err != nil {
+			return
+		}
+		if hdr.Opcode == opPing {
+			if write(&responseHeader{Xid: -2}) != nil {
+				return
+			}
+			continue
+		}
+		req := requestStructForOp(hdr.Opcode)
+		if _, err := decodePacket(b[n:], req); err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.ops = append(s.ops, hdr.Opcode)
+		s.zxid++
+		rhdr := &responseHeader{Xid: hdr.Xid, Zxid: s.zxid}
+		s.mu.Unlock()
+
+		if hdr.Opcode == opClose {
+			write(rhdr)
+			return
+		}
+		go func(opcode int32, req interface{}) {
+			var res interface{}
+			if s.handle != nil {
+				res, rhdr.Err = s.handle(opcode, req)
+			}
+			if res != nil && rhdr.Err == 0 {
+				write(rhdr, res)
+			} else {
+				write(rhdr)
+			}
+		}(hdr.Opcode, req)
+	}
+}
+
+func TestCreateContainerAndTTL(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var reqs []interface{}
+	srv := &testServer{handle: func(opcode int32, req interface{}) (interface{}, ErrCode) {
+		switch r := req.(type) {
+		case *CreateRequest:
+			mu.Lock()
+			reqs = append(reqs, r)
+			mu.Unlock()
+			return &create2Response{Path: r.Path}, 0
+		case *createTTLRequest:
+			mu.Lock()
+			reqs = append(reqs, r)
+			mu.Unlock()
+			return &create2Response{Path: r.Path + "0000000001"}, 0
+		}
+		return nil, 0
+	}}
+	c, _, err := Connect([]string{"127.0.0.1:2181/chroot"}, time.Second, WithDialer(srv.dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if path, _, err := c.CreateContainer("/c", nil, WorldACL(PermAll)); err != nil || path != "/c" {
+		t.Errorf("CreateContainer returned %q, %v", path, err)
+	}
+	if path, _, err := c.CreateTTL("/t-", nil, FlagSequence, WorldACL(PermAll), 90*time.Second); err != nil || path != "/t-0000000001" {
+		t.Errorf("CreateTTL returned %q, %v", path, err)
+	}
+	if _, _, err := c.CreateTTL("/e", nil, FlagEphemeral, WorldACL(PermAll), time.Second); err != ErrBadArguments {
+		t.Errorf("ephemeral CreateTTL returned %v; want ErrBadArguments", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reqs) != 2 {
+		t.Fatalf("server got %d create requests; want 2", len(reqs))
+	}
+	if r := reqs[0].(*CreateRequest); r.Path != "/chroot/c" || r.Flags != createModeContainer {
+		t.Errorf("container request = %+v", r)
+	}
+	if r := reqs[1].(*createTTLRequest); r.Path != "/chroot/t-" || r.Flags != createModePersistentSequentialTTL || r.Ttl != 90000 {
+		t.Errorf("TTL request = %+v", r)
+	}
+	ops := srv.received()
+	if ops[len(ops)-2] != opCreateContainer || ops[len(ops)-1] != opCreateTTL {
+		t.Errorf("opcodes = %v", ops)
+	}
+}
@@ -0,0 +1,261 @@
+package zk
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ConnectionState is a higher-level view of the State of a Conn, meant for
+// recipes that have to react to connection problems. Unlike State it only
+// changes when a session is gained or lost, not on every step of a
+// (re)connection attempt:
+//
+//	ConnectionNone -> ConnectionConnected or ConnectionReadOnly
+//	ConnectionConnected/ConnectionReconnected/ConnectionReadOnly -> ConnectionSuspended
+//	ConnectionSuspended -> ConnectionReconnected, ConnectionReadOnly or ConnectionLost
+//	any -> ConnectionLost
+//	ConnectionLost -> ConnectionConnected or ConnectionReadOnly
+//
+// A recipe should pause on ConnectionSuspended, since the state it holds on
+// the server (ephemeral nodes, watches) may already be gone, resume on
+// ConnectionReconnected and abort on ConnectionLost.
+type ConnectionState int
+
+const (
+	// ConnectionNone means no session has been established yet.
+	ConnectionNone ConnectionState = iota
+	// ConnectionConnected means a new session has been established.
+	ConnectionConnected
+	// ConnectionSuspended means the connection to the server was lost but
+	// the session may still be alive.
+	ConnectionSuspended
+	// ConnectionReconnected means the session was re-established after
+	// being suspended.
+	ConnectionReconnected
+	// ConnectionLost means the session expired, the connection was down for
+	// longer than the session timeout or the Conn was closed.
+	ConnectionLost
+	// ConnectionReadOnly means the session is connected to a read-only
+	// server. See AllowReadOnly.
+	ConnectionReadOnly
+)
+
+var connectionStateNames = map[ConnectionState]string{
+	ConnectionNone:        "None",
+	ConnectionConnected:   "Connected",
+	ConnectionSuspended:   "Suspended",
+	ConnectionReconnected: "Reconnected",
+	ConnectionLost:        "Lost",
+	ConnectionReadOnly:    "ReadOnly",
+}
+
+func (s ConnectionState) String() string {
+	if name := connectionStateNames[s]; name != "" {
+		return name
+	}
+	return "Unknown"
+}
+
+// IsConnected returns true if the session is usable.
+func (s ConnectionState) IsConnected() bool {
+	return s == ConnectionConnected || s == ConnectionReconnected || s == ConnectionReadOnly
+}
+
+// ConnectionStateListener is a function that is called on every
+// ConnectionState transition.
+type ConnectionStateListener func(ConnectionState)
+
+// WithConnectionStateListener returns a connection option that registers a
+// ConnectionStateListener. It may be given several times.
+// The listener must not block - doing so would delay the ZK go routines. It
+// may call ConnectionState and SessionContext.
+func WithConnectionStateListener(l ConnectionStateListener) connOption {
+	return func(c *Conn) {
+		c.connState.listeners = append(c.connState.listeners, l)
+	}
+}
+
+// ConnectionState returns the current ConnectionState of the connection.
+func (c *Conn) ConnectionState() ConnectionState {
+	return c.connState.get()
+}
+
+// connStateTracker derives ConnectionState transitions from State changes.
+type connStateTracker struct {
+	mu        sync.Mutex
+	state     ConnectionState
+	timer     *time.Timer // fires ConnectionLost while suspended
+	closed    bool
+	listeners []ConnectionStateListener
+	pending   []ConnectionState // transitions not yet passed to the listeners
+
+	// notifyMu keeps the listeners called in the order of the transitions.
+	// It is taken without mu, so that listeners may read the state.
+	notifyMu sync.Mutex
+
+	// ctx is cancelled when the session it belongs to is lost. It is
+	// created lazily, so that it is available before the first session.
+	ctx *sessionCtx
+}
+
+func (t *connStateTracker) get() ConnectionState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// update is called on every State change. sessionTimeout is the negotiated
+// session timeout, after which a suspended session is considered lost.
+func (t *connStateTracker) update(state State, sessionTimeout time.Duration) {
+	defer t.notify()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+
+	switch state {
+	case StateHasSession:
+		if t.state == ConnectionSuspended || t.state == ConnectionReadOnly {
+			t.set(ConnectionReconnected)
+		} else {
+			t.set(ConnectionConnected)
+		}
+	case StateConnectedReadOnly:
+		t.set(ConnectionReadOnly)
+	case StateDisconnected:
+		if !t.state.IsConnected() {
+			return
+		}
+		t.set(ConnectionSuspended)
+		var timer *time.Timer
+		timer = time.AfterFunc(sessionTimeout, func() {
+			defer t.notify()
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.timer == timer && t.state == ConnectionSuspended {
+				t.lose(ErrConnectionClosed)
+			}
+		})
+		t.timer = timer
+	case StateExpired:
+		if t.state != ConnectionNone {
+			t.lose(ErrSessionExpired)
+		}
+	case StateAuthFailed:
+		if t.state != ConnectionNone {
+			t.lose(ErrAuthFailed)
+		}
+	}
+}
+
+// close moves the tracker to ConnectionLost once the Conn has shut down.
+func (t *connStateTracker) close() {
+	defer t.notify()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state != ConnectionNone {
+		t.set(ConnectionLost)
+	}
+	t.sessionContext().cancel(ErrClosing)
+	t.closed = true
+}
+
+// lose moves the tracker to ConnectionLost and cancels the session context
+// with cause. It must be called with t.mu held.
+func (t *connStateTracker) lose(cause error) {
+	t.set(ConnectionLost)
+	t.sessionContext().cancel(cause)
+}
+
+// sessionContext returns the context of the current session, creating it if
+// needed. It must be called with t.mu held.
+func (t *connStateTracker) sessionContext() *sessionCtx {
+	if t.ctx == nil {
+		t.ctx = &sessionCtx{Context: context.Background(), done: make(chan struct{})}
+	}
+	return t.ctx
+}
+
+// sessionCtx is the context of a session. Once the session is lost, its Err
+// matches context.Canceled and wraps the reason.
+type sessionCtx struct {
+	context.Context // never cancelled, provides Deadline and Value
+
+	done chan struct{}
+	mu   sync.Mutex
+	err  error
+}
+
+func (s *sessionCtx) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *sessionCtx) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *sessionCtx) cancel(cause error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = &sessionLostError{cause: cause}
+		close(s.done)
+	}
+}
+
+// sessionLostError is the Err of a cancelled session context.
+type sessionLostError struct {
+	cause error
+}
+
+func (e *sessionLostError) Error() string {
+	return context.Canceled.Error() + ": " + e.cause.Error()
+}
+
+func (e *sessionLostError) Unwrap() error {
+	return e.cause
+}
+
+func (e *sessionLostError) Is(target error) bool {
+	return target == context.Canceled
+}
+
+// set must be called with t.mu held. The listeners are called by notify once
+// t.mu is released.
+func (t *connStateTracker) set(state ConnectionState) {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if state == t.state {
+		return
+	}
+	if t.state == ConnectionLost && t.ctx != nil {
+		// A new session: the context of the lost one stays cancelled.
+		t.ctx = nil
+	}
+	t.state = state
+	if len(t.listeners) > 0 {
+		t.pending = append(t.pending, state)
+	}
+}
+
+// notify calls the listeners with the pending transitions. It must be called
+// without t.mu held.
+func (t *connStateTracker) notify() {
+	t.notifyMu.Lock()
+	defer t.notifyMu.Unlock()
+	t.mu.Lock()
+	pending, listeners := t.pending, t.listeners
+	t.pending = nil
+	t.mu.Unlock()
+	for _, state := range pending {
+		for _, l := range listeners {
+			l(state)
+		}
+	}
+}
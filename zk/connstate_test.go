@@ -0,0 +1,90 @@
+package zk
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConnStateTracker(t *testing.T) {
+	t.Parallel()
+	ch := make(chan ConnectionState, 16)
+	tr := &connStateTracker{listeners: []ConnectionStateListener{func(s ConnectionState) { ch <- s }}}
+	timeout := 50 * time.Millisecond
+
+	for _, s := range []State{StateConnecting, StateConnected, StateHasSession, StateDisconnected,
+		StateConnecting, StateConnected, StateHasSession, StateDisconnected, StateConnecting, StateConnected, StateExpired,
+		StateDisconnected, StateConnecting, StateConnected, StateConnectedReadOnly} {
+		tr.update(s, timeout)
+	}
+	tr.update(StateDisconnected, timeout)
+	time.Sleep(2 * timeout)
+	tr.close()
+	tr.update(StateHasSession, timeout)
+	close(ch)
+
+	var got []ConnectionState
+	for s := range ch {
+		got = append(got, s)
+	}
+	want := []ConnectionState{
+		ConnectionConnected, ConnectionSuspended, ConnectionReconnected, ConnectionSuspended, ConnectionLost,
+		ConnectionReadOnly, ConnectionSuspended, ConnectionLost,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transitions = %v; want %v", got, want)
+	}
+}
+
+func TestConnStateTrackerReconnectInTime(t *testing.T) {
+	t.Parallel()
+	tr := &connStateTracker{}
+	tr.update(StateHasSession, 20*time.Millisecond)
+	tr.update(StateDisconnected, 20*time.Millisecond)
+	if s := tr.get(); s != ConnectionSuspended {
+		t.Fatalf("state = %v; want Suspended", s)
+	}
+	tr.update(StateHasSession, 20*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if s := tr.get(); s != ConnectionReconnected {
+		t.Errorf("state = %v; want Reconnected", s)
+	}
+	tr.close()
+	if s := tr.get(); s != ConnectionLost {
+		t.Errorf("state after close = %v; want Lost", s)
+	}
+}
+
+func TestConnStateListenerReadsState(t *testing.T) {
+	t.Parallel()
+	c := &Conn{}
+	ch := make(chan ConnectionState, 16)
+	c.connState.listeners = []ConnectionStateListener{func(s ConnectionState) {
+		// Both take the lock of the tracker.
+		c.SessionContext()
+		ch <- c.ConnectionState()
+	}}
+	timeout := 20 * time.Millisecond
+	c.connState.update(StateHasSession, timeout)
+	c.connState.update(StateDisconnected, timeout)
+	// The timer moves the state to Lost.
+	select {
+	case s := <-ch:
+		if s != ConnectionConnected {
+			t.Errorf("first listener call read %v; want Connected", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listener deadlocked")
+	}
+	for _, want := range []ConnectionState{ConnectionSuspended, ConnectionLost} {
+		select {
+		case s := <-ch:
+			if s != want && s != ConnectionLost {
+				t.Errorf("listener read %v; want %v", s, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("listener not called for %v", want)
+		}
+	}
+	c.connState.close()
+}
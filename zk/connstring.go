@@ -0,0 +1,175 @@
+package zk
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSessionTimeout is used by ParseURL when the URL does not specify a
+// sessionTimeout parameter.
+const defaultSessionTimeout = 10 * time.Second
+
+// ParseConnectString parses a ZooKeeper connection string of the form
+// "host1:2181,[::1]:2182,host3/apps/foo" into a list of <addr>:<port>
+// servers and an optional chroot. Hosts without a port get DefaultPort.
+// IPv6 literals may be given bare or in brackets.
+func ParseConnectString(s string) (servers []string, chroot string, err error) {
+	hosts := s
+	if idx := strings.Index(s, "/"); idx >= 0 {
+		hosts, chroot = s[:idx], s[idx:]
+		if chroot == "/" {
+			chroot = ""
+		} else if err := validatePath(chroot, false); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, h := range strings.Split(hosts, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		addr, err := parseServer(h)
+		if err != nil {
+			return nil, "", err
+		}
+		servers = append(servers, addr)
+	}
+	if len(servers) == 0 {
+		return nil, "", fmt.Errorf("zk: no servers in connection string %q", s)
+	}
+	return servers, chroot, nil
+}
+
+// parseServer validates a single server address and adds DefaultPort if no
+// port was given.
+func parseServer(s string) (string, error) {
+	host, port := s, ""
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return "", fmt.Errorf("zk: missing ']' in address %q", s)
+		}
+		host = s[1:end]
+		if rest := s[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return "", fmt.Errorf("zk: unexpected %q after address %q", rest, host)
+			}
+			port = rest[1:]
+		}
+	case strings.Count(s, ":") == 1:
+		idx := strings.Index(s, ":")
+		host, port = s[:idx], s[idx+1:]
+	}
+	if host == "" {
+		return "", fmt.Errorf("zk: missing host in address %q", s)
+	}
+	if port == "" {
+		port = strconv.Itoa(DefaultPort)
+	} else if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return "", fmt.Errorf("zk: invalid port in address %q", s)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// formatServer adds DefaultPort to addr if it has none, leaving malformed
+// addresses untouched so that the dialer reports them.
+func formatServer(addr string) string {
+	if s, err := parseServer(addr); err == nil {
+		return s
+	}
+	return addr
+}
+
+// ParseURL parses a URL of the form
+//
+//	zk://user:pass@host1:2181,host2/chroot?sessionTimeout=10s&readonly=true
+//
+// into the arguments of Connect. Credentials are registered with the
+// "digest" scheme and submitted as soon as a session is established. The
+// supported query parameters are sessionTimeout (a time.Duration string,
+// default 10s), readonly (a boolean) and bufferSize (in bytes).
+func ParseURL(rawurl string) (servers []string, sessionTimeout time.Duration, options []connOption, err error) {
+	const scheme = "zk://"
+	if !strings.HasPrefix(rawurl, scheme) {
+		return nil, 0, nil, fmt.Errorf("zk: URL %q must start with %q", rawurl, scheme)
+	}
+	rest := rawurl[len(scheme):]
+
+	query := ""
+	if idx := strings.Index(rest, "?"); idx >= 0 {
+		rest, query = rest[:idx], rest[idx+1:]
+	}
+
+	hostEnd := strings.Index(rest, "/")
+	if hostEnd < 0 {
+		hostEnd = len(rest)
+	}
+	if idx := strings.LastIndex(rest[:hostEnd], "@"); idx >= 0 {
+		user, pass := rest[:idx], ""
+		if i := strings.Index(user, ":"); i >= 0 {
+			user, pass = user[:i], user[i+1:]
+		}
+		if user, err = url.PathUnescape(user); err != nil {
+			return nil, 0, nil, err
+		}
+		if pass, err = url.PathUnescape(pass); err != nil {
+			return nil, 0, nil, err
+		}
+		options = append(options, WithAuth("digest", []byte(user+":"+pass)))
+		rest = rest[idx+1:]
+	}
+
+	servers, chroot, err := ParseConnectString(rest)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if chroot != "" {
+		options = append(options, WithChroot(chroot))
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	sessionTimeout = defaultSessionTimeout
+	for key, vals := range values {
+		v := vals[len(vals)-1]
+		switch key {
+		case "sessionTimeout":
+			if sessionTimeout, err = time.ParseDuration(v); err != nil {
+				return nil, 0, nil, fmt.Errorf("zk: invalid sessionTimeout %q: %v", v, err)
+			}
+		case "readonly":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, 0, nil, fmt.Errorf("zk: invalid readonly %q: %v", v, err)
+			}
+			options = append(options, AllowReadOnly(b))
+		case "bufferSize":
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, 0, nil, fmt.Errorf("zk: invalid bufferSize %q", v)
+			}
+			options = append(options, WithBufferSize(n))
+		default:
+			return nil, 0, nil, fmt.Errorf("zk: unknown URL parameter %q", key)
+		}
+	}
+	return servers, sessionTimeout, options, nil
+}
+
+// ConnectURL establishes a new connection described by a zk:// URL. See
+// ParseURL for the URL format. The provided options are applied after the
+// ones derived from the URL.
+func ConnectURL(rawurl string, options ...connOption) (*Conn, <-chan Event, error) {
+	servers, sessionTimeout, urlOptions, err := ParseURL(rawurl)
+	if err != nil {
+		return nil, nil, err
+	}
+	return Connect(servers, sessionTimeout, append(urlOptions, options...)...)
+}
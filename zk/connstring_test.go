@@ -0,0 +1,76 @@
+package zk
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseConnectString(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in      string
+		servers []string
+		chroot  string
+	}{
+		{"host1", []string{"host1:2181"}, ""},
+		{"host1:2182,host2", []string{"host1:2182", "host2:2181"}, ""},
+		{"::1", []string{"[::1]:2181"}, ""},
+		{"[::1],[fe80::1]:2182", []string{"[::1]:2181", "[fe80::1]:2182"}, ""},
+		{"host1:2181, host2:2181/apps/foo", []string{"host1:2181", "host2:2181"}, "/apps/foo"},
+		{"[2001:db8::1]:2181/", []string{"[2001:db8::1]:2181"}, ""},
+	}
+	for _, tt := range tests {
+		servers, chroot, err := ParseConnectString(tt.in)
+		if err != nil {
+			t.Errorf("ParseConnectString(%q) returned error: %+v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(servers, tt.servers) || chroot != tt.chroot {
+			t.Errorf("ParseConnectString(%q) = %q, %q; want %q, %q", tt.in, servers, chroot, tt.servers, tt.chroot)
+		}
+	}
+
+	for _, in := range []string{"", "[::1", "[::1]x", "host:port", "host:99999", "host/bad/"} {
+		if _, _, err := ParseConnectString(in); err == nil {
+			t.Errorf("ParseConnectString(%q) should fail", in)
+		}
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	t.Parallel()
+	servers, timeout, options, err := ParseURL("zk://user:p%40ss@h1,[::1]:2182/chroot?sessionTimeout=5s&readonly=true")
+	if err != nil {
+		t.Fatalf("ParseURL returned error: %+v", err)
+	}
+	if want := []string{"h1:2181", "[::1]:2182"}; !reflect.DeepEqual(servers, want) {
+		t.Errorf("servers = %q; want %q", servers, want)
+	}
+	if timeout != 5*time.Second {
+		t.Errorf("sessionTimeout = %v; want 5s", timeout)
+	}
+
+	c := &Conn{}
+	for _, option := range options {
+		option(c)
+	}
+	if c.chroot != "/chroot" {
+		t.Errorf("chroot = %q; want /chroot", c.chroot)
+	}
+	if !c.allowReadOnly {
+		t.Error("readonly option was not applied")
+	}
+	if len(c.creds) != 1 || c.creds[0].scheme != "digest" || string(c.creds[0].auth) != "user:p@ss" {
+		t.Errorf("unexpected credentials %+v", c.creds)
+	}
+
+	if _, timeout, _, err := ParseURL("zk://h1"); err != nil || timeout != defaultSessionTimeout {
+		t.Errorf("ParseURL without parameters returned %v, %v", timeout, err)
+	}
+	for _, in := range []string{"http://h1", "zk://h1?foo=bar", "zk://h1?sessionTimeout=x"} {
+		if _, _, _, err := ParseURL(in); err == nil {
+			t.Errorf("ParseURL(%q) should fail", in)
+		}
+	}
+}
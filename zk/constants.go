@@ -32,6 +32,7 @@ const (
 	opRemoveWatches   = 18
 	opCreateContainer = 19
 	opDeleteContainer = 20
+	opCreateTTL       = 21
 	opSetAuth         = 100
 	opSetWatches      = 101
 	sasl              = 102
@@ -82,6 +83,13 @@ const (
 	FlagSequence  = 2
 )
 
+// Create modes of the server that aren't expressed with flags.
+const (
+	createModeContainer               = 4
+	createModePersistentTTL           = 5
+	createModePersistentSequentialTTL = 6
+)
+
 var (
 	stateNames = map[State]string{
 		StateUnknown:           "StateUnknown",
@@ -131,6 +139,13 @@ var (
 	ErrEphemeralOnLocalSession = errors.New("zk: ephemeral on local session")
 	ErrNoWatcher               = errors.New("zk: no such watcher")
 	ErrUnimplemented           = errors.New("zk: unimplemented")
+	ErrSystemError             = errors.New("zk: system error")
+	ErrRuntimeInconsistency    = errors.New("zk: runtime inconsistency")
+	ErrDataInconsistency       = errors.New("zk: data inconsistency")
+	ErrMarshallingError        = errors.New("zk: error while marshalling or unmarshalling data")
+	ErrOperationTimeout        = errors.New("zk: operation timeout")
+	ErrBadArguments            = errors.New("zk: invalid arguments")
+	ErrInvalidState            = errors.New("zk: invalid state")
 
 	// ErrInvalidCallback         = errors.New("zk: invalid callback specified")
 	errCodeToError = map[ErrCode]error{
@@ -153,6 +168,14 @@ var (
 		errEphemeralOnLocalSession: ErrEphemeralOnLocalSession,
 		errNotReadOnly:             ErrNotReadOnly,
 		errUnimplemented:           ErrUnimplemented,
+		errSystemError:             ErrSystemError,
+		errRuntimeInconsistency:    ErrRuntimeInconsistency,
+		errDataInconsistency:       ErrDataInconsistency,
+		errConnectionLoss:          ErrConnectionClosed,
+		errMarshallingError:        ErrMarshallingError,
+		errOperationTimeout:        ErrOperationTimeout,
+		errBadArguments:            ErrBadArguments,
+		errInvalidState:            ErrInvalidState,
 	}
 )
 
@@ -160,7 +183,7 @@ func (e ErrCode) toError() error {
 	if err, ok := errCodeToError[e]; ok {
 		return err
 	}
-	return fmt.Errorf("%v: %v", ErrUnknown, e)
+	return fmt.Errorf("%w: %v", ErrUnknown, e)
 }
 
 const (
@@ -208,23 +231,26 @@ const (
 var (
 	emptyPassword = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
 	opNames       = map[int32]string{
-		opNotify:       "notify",
-		opCreate:       "create",
-		opDelete:       "delete",
-		opExists:       "exists",
-		opGetData:      "getData",
-		opSetData:      "setData",
-		opGetAcl:       "getACL",
-		opSetAcl:       "setACL",
-		opGetChildren:  "getChildren",
-		opSync:         "sync",
-		opPing:         "ping",
-		opGetChildren2: "getChildren2",
-		opCheck:        "check",
-		opMulti:        "multi",
-		opClose:        "close",
-		opSetAuth:      "setAuth",
-		opSetWatches:   "setWatches",
+		opNotify:          "notify",
+		opCreate:          "create",
+		opCreate2:         "create2",
+		opCreateContainer: "createContainer",
+		opCreateTTL:       "createTTL",
+		opDelete:          "delete",
+		opExists:          "exists",
+		opGetData:         "getData",
+		opSetData:         "setData",
+		opGetAcl:          "getACL",
+		opSetAcl:          "setACL",
+		opGetChildren:     "getChildren",
+		opSync:            "sync",
+		opPing:            "ping",
+		opGetChildren2:    "getChildren2",
+		opCheck:           "check",
+		opMulti:           "multi",
+		opClose:           "close",
+		opSetAuth:         "setAuth",
+		opSetWatches:      "setWatches",
 
 		opWatcherEvent: "watcherEvent",
 	}
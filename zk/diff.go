@@ -0,0 +1,353 @@
+package zk
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// diffContext is the number of unchanged lines around the changes of a
+	// text diff.
+	diffContext = 3
+	// maxDiffCells bounds the memory of a text diff: above that many pairs of
+	// differing lines, all old lines are shown as removed and all new lines
+	// as added.
+	maxDiffCells = 1 << 22
+)
+
+// DiffChange tells how a node differs between two trees.
+type DiffChange int
+
+const (
+	// DiffAdded nodes are only in the new tree.
+	DiffAdded DiffChange = iota + 1
+	// DiffRemoved nodes are only in the old tree.
+	DiffRemoved
+	// DiffChanged nodes are in both trees, with different data, ACLs or
+	// ephemeral owners.
+	DiffChanged
+)
+
+var diffChangeNames = map[DiffChange]string{
+	DiffAdded:   "added",
+	DiffRemoved: "removed",
+	DiffChanged: "changed",
+}
+
+func (c DiffChange) String() string {
+	if name := diffChangeNames[c]; name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the change as its name.
+func (c DiffChange) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// DiffOptions modifies the behaviour of DiffTrees and DiffExports.
+type DiffOptions struct {
+	// IgnoreACL doesn't compare ACLs.
+	IgnoreACL bool
+	// IgnoreEphemeral leaves ephemeral nodes out, for trees where they come
+	// and go with their clients.
+	IgnoreEphemeral bool
+	// IgnoreOwner doesn't compare the sessions owning ephemeral nodes, which
+	// always differ between ensembles. Whether nodes are ephemeral is still
+	// compared.
+	IgnoreOwner bool
+}
+
+// NodeDiff is a node that differs between two trees.
+type NodeDiff struct {
+	// Path relative to the compared roots, "/" for the roots themselves.
+	Path   string     `json:"path"`
+	Change DiffChange `json:"change"`
+	// What differs, for changed nodes.
+	Data      bool `json:"data,omitempty"`
+	ACL       bool `json:"acl,omitempty"`
+	Ephemeral bool `json:"ephemeral,omitempty"` // whether it is ephemeral, or its owner
+	// The node in each tree, nil where it is missing.
+	Old *ExportedNode `json:"old,omitempty"`
+	New *ExportedNode `json:"new,omitempty"`
+}
+
+// TextDiff returns a unified diff of the old and new data, without file
+// headers. ok is false if the data of either side isn't UTF-8 text.
+func (d *NodeDiff) TextDiff() (diff string, ok bool) {
+	var a, b []byte
+	if d.Old != nil {
+		a = d.Old.Data
+	}
+	if d.New != nil {
+		b = d.New.Data
+	}
+	if !isText(a) || !isText(b) {
+		return "", false
+	}
+	return unifiedDiff(splitLines(a), splitLines(b)), true
+}
+
+// DiffTrees compares the subtree at oldRoot, read with a, with the subtree
+// at newRoot, read with b. a and b may be connections to different
+// ensembles, or the same connection. The differences are sorted by path and
+// empty if the trees are the same. opts may be nil.
+func DiffTrees(a Client, oldRoot string, b Client, newRoot string, opts *DiffOptions) ([]NodeDiff, error) {
+	var newTree *Export
+	var newErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		newTree, newErr = exportTree(b, newRoot)
+	}()
+	oldTree, err := exportTree(a, oldRoot)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	if newErr != nil {
+		return nil, newErr
+	}
+	return DiffExports(oldTree, newTree, opts), nil
+}
+
+// DiffExports is like DiffTrees, but compares two exports, such as one saved
+// earlier with a tree exported now.
+func DiffExports(oldTree, newTree *Export, opts *DiffOptions) []NodeDiff {
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+	index := func(e *Export) map[string]*ExportedNode {
+		nodes := make(map[string]*ExportedNode, len(e.Nodes))
+		for i := range e.Nodes {
+			if n := &e.Nodes[i]; !n.Ephemeral || !opts.IgnoreEphemeral {
+				nodes[n.Path] = n
+			}
+		}
+		return nodes
+	}
+	oldNodes, newNodes := index(oldTree), index(newTree)
+
+	paths := make([]string, 0, len(oldNodes))
+	for path := range oldNodes {
+		paths = append(paths, path)
+	}
+	for path := range newNodes {
+		if oldNodes[path] == nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var diffs []NodeDiff
+	for _, path := range paths {
+		d := NodeDiff{Path: path, Old: oldNodes[path], New: newNodes[path]}
+		switch {
+		case d.Old == nil:
+			d.Change = DiffAdded
+		case d.New == nil:
+			d.Change = DiffRemoved
+		default:
+			d.Data = !bytes.Equal(d.Old.Data, d.New.Data)
+			d.ACL = !opts.IgnoreACL && !sameACL(d.Old.ACL, d.New.ACL)
+			d.Ephemeral = d.Old.Ephemeral != d.New.Ephemeral ||
+				!opts.IgnoreOwner && d.Old.Stat.EphemeralOwner != d.New.Stat.EphemeralOwner
+			if !d.Data && !d.ACL && !d.Ephemeral {
+				continue
+			}
+			d.Change = DiffChanged
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+// sameACL reports whether two ACLs hold the same entries, in any order.
+func sameACL(a, b []ACL) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sorted := func(acl []ACL) []ACL {
+		s := append([]ACL(nil), acl...)
+		sort.Slice(s, func(i, j int) bool {
+			if s[i].Scheme != s[j].Scheme {
+				return s[i].Scheme < s[j].Scheme
+			}
+			if s[i].ID != s[j].ID {
+				return s[i].ID < s[j].ID
+			}
+			return s[i].Perms < s[j].Perms
+		})
+		return s
+	}
+	a, b = sorted(a), sorted(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
+
+// splitLines splits data into lines. A last line without a newline is
+// marked as such, so that adding the newline shows in the diff.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.Split(string(data), "\n")
+	if last := len(lines) - 1; lines[last] == "" {
+		lines = lines[:last]
+	} else {
+		lines[last] += "\n\\ No newline at end of data"
+	}
+	return lines
+}
+
+// diffLine is a line of a diff: kept (' '), removed ('-') or added ('+').
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// lineDiff returns the lines of a turned into b, keeping the longest common
+// subsequence of lines.
+func lineDiff(a, b []string) []diffLine {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	var lines []diffLine
+	for _, l := range a[:pre] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	common := a[len(a)-suf:]
+	a, b = a[pre:len(a)-suf], b[pre:len(b)-suf]
+	n, m := len(a), len(b)
+	if n*m > maxDiffCells {
+		for _, l := range a {
+			lines = append(lines, diffLine{'-', l})
+		}
+		for _, l := range b {
+			lines = append(lines, diffLine{'+', l})
+		}
+	} else {
+		// lcs[i*(m+1)+j] is the length of the longest common subsequence
+		// of a[i:] and b[j:].
+		lcs := make([]int32, (n+1)*(m+1))
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+				} else if down, right := lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1]; down >= right {
+					lcs[i*(m+1)+j] = down
+				} else {
+					lcs[i*(m+1)+j] = right
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n && j < m {
+			switch {
+			case a[i] == b[j]:
+				lines = append(lines, diffLine{' ', a[i]})
+				i++
+				j++
+			case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+				lines = append(lines, diffLine{'-', a[i]})
+				i++
+			default:
+				lines = append(lines, diffLine{'+', b[j]})
+				j++
+			}
+		}
+		for ; i < n; i++ {
+			lines = append(lines, diffLine{'-', a[i]})
+		}
+		for ; j < m; j++ {
+			lines = append(lines, diffLine{'+', b[j]})
+		}
+	}
+	for _, l := range common {
+		lines = append(lines, diffLine{' ', l})
+	}
+	return lines
+}
+
+// unifiedDiff formats the differences between a and b as hunks of a unified
+// diff.
+func unifiedDiff(a, b []string) string {
+	lines := lineDiff(a, b)
+	// oldBefore[k] and newBefore[k] count the lines of a and b before
+	// lines[k].
+	oldBefore, newBefore := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for k, l := range lines {
+		oldBefore[k+1], newBefore[k+1] = oldBefore[k], newBefore[k]
+		if l.op != '+' {
+			oldBefore[k+1]++
+		}
+		if l.op != '-' {
+			newBefore[k+1]++
+		}
+	}
+
+	var out strings.Builder
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			k++
+			continue
+		}
+		// A hunk takes in the following changes separated by at most twice
+		// the context.
+		end := k + 1
+		for next := end; next < len(lines) && next-end <= 2*diffContext; next++ {
+			if lines[next].op != ' ' {
+				end = next + 1
+			}
+		}
+		start, stop := k-diffContext, end+diffContext
+		if start < 0 {
+			start = 0
+		}
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(oldBefore[start], oldBefore[stop]-oldBefore[start]),
+			hunkRange(newBefore[start], newBefore[stop]-newBefore[start]))
+		for _, l := range lines[start:stop] {
+			out.WriteByte(l.op)
+			out.WriteString(l.text)
+			out.WriteByte('\n')
+		}
+		k = stop
+	}
+	return out.String()
+}
+
+// hunkRange formats the range of a hunk from the number of lines before it
+// and its length.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
@@ -0,0 +1,150 @@
+package zk
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiffTrees(t *testing.T) {
+	t.Parallel()
+	acl := WorldACL(PermAll)
+	both := []ACL{{PermRead, "world", "anyone"}, {PermAll, "digest", "admin:x"}}
+	old := NewFakeClient()
+	for _, n := range []struct {
+		path, data string
+		flags      int32
+		acl        []ACL
+	}{
+		{"/cfg", "", 0, acl},
+		{"/cfg/same", "v1", 0, acl},
+		{"/cfg/data", "a\nb\n", 0, acl},
+		{"/cfg/removed", "", 0, acl},
+		{"/cfg/reordered", "", 0, both},
+		{"/cfg/acl", "", 0, acl},
+		{"/cfg/lock", "", 0, acl},
+	} {
+		if _, err := old.Create(n.path, []byte(n.data), n.flags, n.acl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cur := NewFakeClient()
+	for _, n := range []struct {
+		path, data string
+		flags      int32
+		acl        []ACL
+	}{
+		{"/new", "", 0, acl},
+		{"/new/cfg", "", 0, acl},
+		{"/new/cfg/same", "v1", 0, acl},
+		{"/new/cfg/data", "a\nc\n", 0, acl},
+		{"/new/cfg/added", "", 0, acl},
+		{"/new/cfg/reordered", "", 0, []ACL{both[1], both[0]}},
+		{"/new/cfg/acl", "", 0, WorldACL(PermRead)},
+		{"/new/cfg/lock", "", FlagEphemeral, acl},
+	} {
+		if _, err := cur.Create(n.path, []byte(n.data), n.flags, n.acl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diffs, err := DiffTrees(old, "/cfg", cur, "/new/cfg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diffs {
+		s := d.Change.String() + " " + d.Path
+		if d.Data {
+			s += " data"
+		}
+		if d.ACL {
+			s += " acl"
+		}
+		if d.Ephemeral {
+			s += " ephemeral"
+		}
+		got = append(got, s)
+	}
+	want := []string{"changed /acl acl", "added /added", "changed /data data", "changed /lock ephemeral", "removed /removed"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("DiffTrees found\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if diffs[1].Old != nil || diffs[1].New == nil || diffs[4].Old == nil || diffs[4].New != nil {
+		t.Error("added and removed nodes don't have their node on one side only")
+	}
+	if text, ok := diffs[2].TextDiff(); !ok || text != "@@ -1,2 +1,2 @@\n a\n-b\n+c\n" {
+		t.Errorf("TextDiff = %q, %v", text, ok)
+	}
+
+	diffs, err = DiffTrees(old, "/cfg", cur, "/new/cfg", &DiffOptions{IgnoreACL: true, IgnoreEphemeral: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The ephemeral /lock is left out of the new tree.
+	if len(diffs) != 4 || diffs[1].Path != "/data" || diffs[2].Path != "/lock" || diffs[2].Change != DiffRemoved {
+		t.Errorf("with IgnoreACL and IgnoreEphemeral, DiffTrees found %+v", diffs)
+	}
+
+	if diffs, err := DiffTrees(old, "/cfg", old, "/cfg", nil); err != nil || len(diffs) != 0 {
+		t.Errorf("diffing a tree with itself found %+v, %v", diffs, err)
+	}
+	if _, err := DiffTrees(old, "/cfg", cur, "/missing", nil); err != ErrNoNode {
+		t.Errorf("diffing a missing tree returned %v; want ErrNoNode", err)
+	}
+
+	b, err := json.Marshal(diffs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), `{"path":"/added","change":"added","new":{`) {
+		t.Errorf("JSON encoding = %s", b)
+	}
+}
+
+func TestDiffOwner(t *testing.T) {
+	t.Parallel()
+	node := func(owner int64) *Export {
+		return &Export{Nodes: []ExportedNode{{Path: "/", Ephemeral: true, Stat: ExportedStat{EphemeralOwner: owner}}}}
+	}
+	if diffs := DiffExports(node(1), node(2), nil); len(diffs) != 1 || !diffs[0].Ephemeral {
+		t.Errorf("a new owner gave %+v", diffs)
+	}
+	if diffs := DiffExports(node(1), node(2), &DiffOptions{IgnoreOwner: true}); len(diffs) != 0 {
+		t.Errorf("with IgnoreOwner, a new owner gave %+v", diffs)
+	}
+}
+
+func TestTextDiff(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name, old, new, want string
+	}{
+		{
+			"hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n",
+			"1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\nfourteen\n15\n",
+			"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n@@ -11,5 +11,5 @@\n 11\n 12\n 13\n-14\n+fourteen\n 15\n",
+		},
+		{
+			"merged hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n",
+			"one\n2\n3\n4\n5\n6\n7\neight\n",
+			"@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+		{"added", "", "a\nb\n", "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"no newline", "x", "x\n", "@@ -1 +1 @@\n-x\n\\ No newline at end of data\n+x\n"},
+		{"same", "x\n", "x\n", ""},
+	}
+	for _, tt := range tests {
+		d := NodeDiff{Old: &ExportedNode{Data: []byte(tt.old)}, New: &ExportedNode{Data: []byte(tt.new)}}
+		if got, ok := d.TextDiff(); !ok || got != tt.want {
+			t.Errorf("%s: TextDiff =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	d := NodeDiff{Old: &ExportedNode{Data: []byte{0xff, 0x00}}, New: &ExportedNode{Data: []byte("text")}}
+	if _, ok := d.TextDiff(); ok {
+		t.Error("TextDiff of binary data succeeded")
+	}
+}
@@ -4,17 +4,28 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"time"
 )
 
-// DNSHostProvider is the default HostProvider. It currently matches
-// the Java StaticHostProvider, resolving hosts from DNS once during
-// the call to Init.  It could be easily extended to re-query DNS
-// periodically or if there is trouble connecting.
+// DNSHostProvider is the default HostProvider. It resolves hosts from DNS
+// during the call to Init, and again whenever a full rotation through the
+// servers fails to connect. If RefreshInterval is set the hosts are also
+// re-resolved periodically, so that clients follow servers whose addresses
+// change (e.g. after a pod restart).
+//
+// Refreshing keeps the server currently in use and the rotation state, so
+// retryStart semantics are unaffected by address changes.
 type DNSHostProvider struct {
-	mu         sync.Mutex // Protects everything, so we can add asynchronous updates later.
+	RefreshInterval time.Duration // How often to re-resolve hosts; zero disables periodic refreshes.
+	Logger          Logger        // Receives resolution errors; DefaultLogger if nil.
+
+	mu         sync.Mutex // Protects everything below, as refreshes happen asynchronously.
+	hosts      []string   // servers as passed to Init
 	servers    []string
 	curr       int
 	last       int
+	refreshing bool
+	quit       chan struct{}
 	lookupHost func(string) ([]string, error) // Override of net.LookupHost, for testing.
 }
 
@@ -25,7 +36,129 @@ func (hp *DNSHostProvider) Init(servers []string) error {
 	hp.mu.Lock()
 	defer hp.mu.Unlock()
 
-	lookupHost := hp.lookupHost
+	found, err := lookupServers(servers, hp.lookupHost)
+	if err != nil {
+		return err
+	}
+
+	// Randomize the order of the servers to avoid creating hotspots
+	stringShuffle(found)
+
+	hp.hosts = servers
+	hp.servers = found
+	hp.curr = -1
+	hp.last = -1
+
+	if hp.RefreshInterval > 0 && hp.quit == nil {
+		hp.quit = make(chan struct{})
+		go hp.refreshLoop(hp.RefreshInterval, hp.quit)
+	}
+
+	return nil
+}
+
+// Close stops periodic refreshes. It is called by Conn when the connection
+// is closed.
+func (hp *DNSHostProvider) Close() error {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	if hp.quit != nil {
+		close(hp.quit)
+		hp.quit = nil
+	}
+	return nil
+}
+
+func (hp *DNSHostProvider) refreshLoop(interval time.Duration, quit chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			hp.refresh()
+		}
+	}
+}
+
+// refresh resolves the hosts again and merges the result into the server
+// list. On failure the current list is kept and the error is logged.
+func (hp *DNSHostProvider) refresh() error {
+	hp.mu.Lock()
+	hosts := hp.hosts
+	logger := hp.Logger
+	hp.mu.Unlock()
+	if logger == nil {
+		logger = DefaultLogger
+	}
+
+	found, err := lookupServers(hosts, hp.lookupHost)
+	if err != nil {
+		logger.Printf("Failed to re-resolve servers %q: %v", hosts, err)
+		return err
+	}
+
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	hp.update(found)
+	return nil
+}
+
+// update replaces the server list with found. Servers present in both lists
+// keep their relative order and new ones are appended in random order; curr
+// and last are moved along so that the rotation continues where it was. The
+// server in use is kept until the next refresh even if it wasn't found, so
+// that its removal doesn't look like a failed rotation. It must be called
+// with hp.mu held.
+func (hp *DNSHostProvider) update(found []string) {
+	present := make(map[string]bool, len(found))
+	for _, s := range found {
+		present[s] = true
+	}
+
+	servers := make([]string, 0, len(found))
+	known := make(map[string]bool, len(hp.servers))
+	curr, last := -1, -1
+	for i, s := range hp.servers {
+		known[s] = true
+		kept := present[s] || i == hp.curr
+		if kept {
+			servers = append(servers, s)
+		}
+		if i == hp.curr {
+			curr = len(servers) - 1
+		}
+		if i == hp.last {
+			last = len(servers) - 1
+			if !kept {
+				// Coming back to the server after a removed one ends
+				// the rotation, as coming back to the removed one would
+				// have.
+				last++
+			}
+		}
+	}
+	var added []string
+	for _, s := range found {
+		if !known[s] {
+			added = append(added, s)
+			known[s] = true
+		}
+	}
+	stringShuffle(added)
+
+	hp.servers = append(servers, added...)
+	if last >= len(hp.servers) {
+		last = 0
+	}
+	hp.curr = curr
+	hp.last = last
+}
+
+// lookupServers resolves the host of every host:port in servers, using
+// net.LookupHost if lookupHost is nil, and returns the resolved addresses.
+func lookupServers(servers []string, lookupHost func(string) ([]string, error)) ([]string, error) {
 	if lookupHost == nil {
 		lookupHost = net.LookupHost
 	}
@@ -34,11 +167,11 @@ func (hp *DNSHostProvider) Init(servers []string) error {
 	for _, server := range servers {
 		host, port, err := net.SplitHostPort(server)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		addrs, err := lookupHost(host)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		for _, addr := range addrs {
 			found = append(found, net.JoinHostPort(addr, port))
@@ -46,17 +179,9 @@ func (hp *DNSHostProvider) Init(servers []string) error {
 	}
 
 	if len(found) == 0 {
-		return fmt.Errorf("No hosts found for addresses %q", servers)
+		return nil, fmt.Errorf("No hosts found for addresses %q", servers)
 	}
-
-	// Randomize the order of the servers to avoid creating hotspots
-	stringShuffle(found)
-
-	hp.servers = found
-	hp.curr = -1
-	hp.last = -1
-
-	return nil
+	return found, nil
 }
 
 // Len returns the number of servers available
@@ -66,6 +191,13 @@ func (hp *DNSHostProvider) Len() int {
 	return len(hp.servers)
 }
 
+// Servers returns the resolved addresses of the servers.
+func (hp *DNSHostProvider) Servers() []string {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	return append([]string(nil), hp.servers...)
+}
+
 // Next returns the next server to connect to. retryStart will be true
 // if we've looped through all known servers without Connected() being
 // called.
@@ -77,6 +209,17 @@ func (hp *DNSHostProvider) Next() (server string, retryStart bool) {
 	if hp.last == -1 {
 		hp.last = 0
 	}
+	if retryStart && !hp.refreshing {
+		// None of the servers could be reached; their addresses may have
+		// changed.
+		hp.refreshing = true
+		go func() {
+			hp.refresh()
+			hp.mu.Lock()
+			hp.refreshing = false
+			hp.mu.Unlock()
+		}()
+	}
 	return hp.servers[hp.curr], retryStart
 }
 
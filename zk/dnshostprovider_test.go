@@ -1,8 +1,11 @@
 package zk
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"sync"
 	"testing"
 	"time"
 )
@@ -33,7 +36,7 @@ func TestDNSHostProviderCreate(t *testing.T) {
 
 	path := "/gozk-test"
 
-	if err := zk.Delete(path, -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete(path, -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 	if p, err := zk.Create(path, []byte{1, 2, 3, 4}, 0, WorldACL(PermAll)); err != nil {
@@ -121,7 +124,7 @@ func TestDNSHostProviderReconnect(t *testing.T) {
 	path := "/gozk-test"
 
 	// Initial operation to force connection.
-	if err := zk.Delete(path, -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete(path, -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 
@@ -222,3 +225,138 @@ func TestDNSHostProviderRetryStart(t *testing.T) {
 		}
 	}
 }
+
+// TestDNSHostProviderRefresh tests that re-resolving the servers keeps the
+// current server and the retryStart rotation intact.
+func TestDNSHostProviderRefresh(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	addrs := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	hp := &DNSHostProvider{lookupHost: func(host string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return addrs, nil
+	}}
+	if err := hp.Init([]string{"foo.example.com:12345"}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := hp.Next()
+	current, _ := hp.Next()
+	hp.Connected()
+
+	// Replace the server that hasn't been used yet.
+	mu.Lock()
+	addrs = []string{"192.0.2.4"}
+	for _, s := range []string{first, current} {
+		host, _, _ := net.SplitHostPort(s)
+		addrs = append(addrs, host)
+	}
+	mu.Unlock()
+	if err := hp.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if hp.Len() != 3 {
+		t.Fatalf("Len() = %d; want 3", hp.Len())
+	}
+	testdata := []struct {
+		server     string
+		retryStart bool
+	}{
+		{"192.0.2.4:12345", false},
+		{first, false},
+		{current, true},
+	}
+	for i, td := range testdata {
+		server, retryStart := hp.Next()
+		if server != td.server || retryStart != td.retryStart {
+			t.Errorf("%d: Next() = %q, %v; want %q, %v", i, server, retryStart, td.server, td.retryStart)
+		}
+	}
+}
+
+func TestDNSHostProviderRefreshRemovesFirst(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	addrs := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	hp := &DNSHostProvider{lookupHost: func(host string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return addrs, nil
+	}}
+	if err := hp.Init([]string{"foo.example.com:12345"}); err != nil {
+		t.Fatal(err)
+	}
+	current, _ := hp.Next()
+	hp.Connected()
+	if hp.curr != 0 {
+		t.Fatalf("curr = %d; want 0", hp.curr)
+	}
+
+	// The server in use, at index 0, is no longer resolved.
+	mu.Lock()
+	addrs = nil
+	for _, s := range hp.servers[1:] {
+		host, _, _ := net.SplitHostPort(s)
+		addrs = append(addrs, host)
+	}
+	mu.Unlock()
+	if err := hp.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if hp.Len() != 3 || hp.servers[hp.curr] != current {
+		t.Errorf("the server in use was dropped: servers %v, curr %d", hp.servers, hp.curr)
+	}
+	for i := 0; i < 2; i++ {
+		if server, retryStart := hp.Next(); retryStart || server == current {
+			t.Errorf("%d: Next() = %q, %v; want another server without retryStart", i, server, retryStart)
+		}
+	}
+
+	// It is dropped once no longer in use, without a rotation start.
+	if err := hp.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if hp.Len() != 2 {
+		t.Errorf("servers = %v; want the two resolved ones", hp.servers)
+	}
+	if server, retryStart := hp.Next(); !retryStart || server == current {
+		t.Errorf("Next() = %q, %v; want a full rotation to end", server, retryStart)
+	}
+}
+
+func TestDNSHostProviderRefreshError(t *testing.T) {
+	t.Parallel()
+
+	fail := false
+	hp := &DNSHostProvider{
+		Logger: testLogger{t},
+		lookupHost: func(host string) ([]string, error) {
+			if fail {
+				return nil, fmt.Errorf("lookup %s: no such host", host)
+			}
+			return []string{"192.0.2.1"}, nil
+		},
+	}
+	if err := hp.Init([]string{"foo.example.com:12345"}); err != nil {
+		t.Fatal(err)
+	}
+	fail = true
+	if err := hp.refresh(); err == nil {
+		t.Fatal("refresh should report the lookup error")
+	}
+	if server, _ := hp.Next(); server != "192.0.2.1:12345" {
+		t.Errorf("servers should be kept after a failed refresh, got %q", server)
+	}
+}
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Printf(format string, a ...interface{}) {
+	l.t.Logf(format, a...)
+}
@@ -0,0 +1,88 @@
+package zk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OpError is the error returned by the operations of Conn. It records which
+// operation failed and where, and wraps one of the Err* sentinels, so
+// callers should use errors.Is rather than == to check for a specific error:
+//
+//	if _, _, err := conn.Get(path); errors.Is(err, zk.ErrNoNode) {
+//		...
+//	}
+type OpError struct {
+	Op        string // Operation, e.g. "getData" or "create".
+	Path      string // Path the operation was applied to, as given by the caller.
+	Server    string // Server the connection was established with.
+	SessionID int64  // Session the operation was sent on, 0 if none.
+	Zxid      int64  // Zxid of the server response, 0 if none was received.
+	Err       error  // Underlying error, usually one of the Err* variables.
+}
+
+func (e *OpError) Error() string {
+	var b strings.Builder
+	b.WriteString("zk: ")
+	b.WriteString(e.Op)
+	if e.Path != "" {
+		fmt.Fprintf(&b, " %q", e.Path)
+	}
+	fmt.Fprintf(&b, " (server %s, session 0x%x, zxid 0x%x): ", e.Server, e.SessionID, e.Zxid)
+	b.WriteString(strings.TrimPrefix(e.Err.Error(), "zk: "))
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// opError wraps a non-nil err returned by a request in an *OpError.
+func (c *Conn) opError(opcode int32, path string, zxid int64, err error) error {
+	if err == nil {
+		return nil
+	}
+	if zxid < 0 {
+		zxid = 0 // the request was failed locally
+	}
+	op := opNames[opcode]
+	if op == "" {
+		op = fmt.Sprintf("op%d", opcode)
+	}
+	return &OpError{
+		Op:        op,
+		Path:      path,
+		Server:    c.Server(),
+		SessionID: c.SessionID(),
+		Zxid:      zxid,
+		Err:       err,
+	}
+}
+
+// IsConnectionLoss reports whether err means that the connection to the
+// server was lost before a response was received. The operation may or may
+// not have been applied.
+func IsConnectionLoss(err error) bool {
+	return errors.Is(err, ErrConnectionClosed) || errors.Is(err, ErrNoServer)
+}
+
+// IsRetryable reports whether err is transient, so that the operation may
+// succeed if it is sent again on the same session. Whether retrying is safe
+// depends on the operation; see RetryClient.
+func IsRetryable(err error) bool {
+	return IsConnectionLoss(err) ||
+		errors.Is(err, ErrOperationTimeout) ||
+		errors.Is(err, ErrSessionMoved)
+}
+
+// IsSessionFatal reports whether err means that the session can no longer be
+// used: it has expired, failed to authenticate or the connection was closed.
+// Ephemeral nodes and watches of the session are gone and a new connection
+// is required.
+func IsSessionFatal(err error) bool {
+	return errors.Is(err, ErrSessionExpired) ||
+		errors.Is(err, ErrAuthFailed) ||
+		errors.Is(err, ErrClosing)
+}
@@ -0,0 +1,80 @@
+package zk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOpError(t *testing.T) {
+	t.Parallel()
+	c := &Conn{server: "127.0.0.1:2181", sessionID: 0x1234}
+	if err := c.opError(opGetData, "/foo", 0, nil); err != nil {
+		t.Fatalf("opError(nil) = %v; want nil", err)
+	}
+
+	err := c.opError(opGetData, "/foo", 0x10, ErrNoNode)
+	if !errors.Is(err, ErrNoNode) {
+		t.Errorf("errors.Is(%v, ErrNoNode) = false", err)
+	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("errors.As(%v, *OpError) = false", err)
+	}
+	want := OpError{Op: "getData", Path: "/foo", Server: "127.0.0.1:2181", SessionID: 0x1234, Zxid: 0x10, Err: ErrNoNode}
+	if *opErr != want {
+		t.Errorf("opError = %+v; want %+v", *opErr, want)
+	}
+	if s, want := err.Error(), `zk: getData "/foo" (server 127.0.0.1:2181, session 0x1234, zxid 0x10): node does not exist`; s != want {
+		t.Errorf("Error() = %q; want %q", s, want)
+	}
+}
+
+func TestErrCodeToError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		code ErrCode
+		err  error
+	}{
+		{errConnectionLoss, ErrConnectionClosed},
+		{errMarshallingError, ErrMarshallingError},
+		{errOperationTimeout, ErrOperationTimeout},
+		{errInvalidState, ErrInvalidState},
+		{errNoNode, ErrNoNode},
+		{-1000, ErrUnknown},
+	}
+	for _, tt := range tests {
+		if err := tt.code.toError(); !errors.Is(err, tt.err) {
+			t.Errorf("ErrCode(%d).toError() = %v; want %v", tt.code, err, tt.err)
+		}
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	t.Parallel()
+	c := &Conn{}
+	tests := []struct {
+		err                                     error
+		connectionLoss, retryable, sessionFatal bool
+	}{
+		{ErrConnectionClosed, true, true, false},
+		{c.opError(opCreate, "/a", 0, ErrNoServer), true, true, false},
+		{ErrCode(errOperationTimeout).toError(), false, true, false},
+		{ErrSessionMoved, false, true, false},
+		{c.opError(opSetData, "/a", 0, ErrSessionExpired), false, false, true},
+		{ErrAuthFailed, false, false, true},
+		{ErrClosing, false, false, true},
+		{ErrNoNode, false, false, false},
+		{nil, false, false, false},
+	}
+	for _, tt := range tests {
+		if got := IsConnectionLoss(tt.err); got != tt.connectionLoss {
+			t.Errorf("IsConnectionLoss(%v) = %v", tt.err, got)
+		}
+		if got := IsRetryable(tt.err); got != tt.retryable {
+			t.Errorf("IsRetryable(%v) = %v", tt.err, got)
+		}
+		if got := IsSessionFatal(tt.err); got != tt.sessionFatal {
+			t.Errorf("IsSessionFatal(%v) = %v", tt.err, got)
+		}
+	}
+}
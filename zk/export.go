@@ -0,0 +1,346 @@
+package zk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportVersion is the version of the format written by Export and
+// ExportStream.
+const ExportVersion = 1
+
+// Export is a portable copy of a subtree. Its JSON encoding is the export
+// format; ExportStream writes the same information as JSON lines: an
+// ExportHeader followed by one ExportedNode per line.
+type Export struct {
+	ExportHeader
+	Nodes []ExportedNode `json:"nodes"` // Parents come before their children.
+}
+
+// ExportHeader describes an export.
+type ExportHeader struct {
+	Version    int       `json:"version"`
+	Root       string    `json:"root"` // Path of the exported subtree.
+	ExportedAt time.Time `json:"exportedAt"`
+	Server     string    `json:"server,omitempty"`
+}
+
+// ExportedNode is a node of an exported subtree.
+type ExportedNode struct {
+	// Path relative to the exported root: "/" for the root itself, "/a"
+	// for its child a.
+	Path      string       `json:"path"`
+	Data      []byte       `json:"data,omitempty"`
+	ACL       []ACL        `json:"acl"`
+	Ephemeral bool         `json:"ephemeral,omitempty"`
+	Stat      ExportedStat `json:"stat"`
+}
+
+// ExportedStat holds the fields of Stat kept by an export.
+type ExportedStat struct {
+	Czxid          int64 `json:"czxid"`
+	Mzxid          int64 `json:"mzxid"`
+	Ctime          int64 `json:"ctime"`
+	Mtime          int64 `json:"mtime"`
+	Version        int32 `json:"version"`
+	Cversion       int32 `json:"cversion"`
+	Aversion       int32 `json:"aversion"`
+	EphemeralOwner int64 `json:"ephemeralOwner,omitempty"`
+}
+
+// ConflictPolicy tells Import what to do with nodes that already exist.
+type ConflictPolicy int
+
+const (
+	// ConflictSkip leaves existing nodes untouched.
+	ConflictSkip ConflictPolicy = iota
+	// ConflictOverwrite replaces the data and ACL of existing nodes.
+	ConflictOverwrite
+	// ConflictFailOnVersionMismatch overwrites existing nodes whose data
+	// version is still the exported one, and fails with ErrBadVersion
+	// otherwise.
+	ConflictFailOnVersionMismatch
+)
+
+// ImportOptions modifies the behaviour of Import.
+type ImportOptions struct {
+	Conflict ConflictPolicy
+	// Ephemeral creates the exported ephemeral nodes as ephemeral nodes of
+	// this session. They are skipped otherwise.
+	Ephemeral bool
+	// DryRun reports what would be imported without changing anything.
+	DryRun bool
+}
+
+// ImportResult lists the paths an import created, updated and skipped.
+type ImportResult struct {
+	Created []string
+	Updated []string
+	Skipped []string
+}
+
+// Export reads the subtree at root, with data, ACLs and Stats. Nodes
+// deleted while exporting are left out.
+func (c *Conn) Export(root string) (*Export, error) {
+	return exportTree(c, root)
+}
+
+// ExportStream writes the subtree at root as JSON lines, without holding it
+// in memory.
+func (c *Conn) ExportStream(w io.Writer, root string) error {
+	return exportStream(c, w, root)
+}
+
+// Import recreates the nodes of e below root, which may differ from the
+// exported root. Missing parents of root are created with the ACL of the
+// exported root. Nodes are created and updated in Multi batches that fit the
+// buffer size, so a failure may leave the import half done; the result lists
+// what was applied. opts may be nil.
+func (c *Conn) Import(e *Export, root string, opts *ImportOptions) (*ImportResult, error) {
+	if e.Version != ExportVersion {
+		return nil, fmt.Errorf("zk: unsupported export version %d", e.Version)
+	}
+	imp := newImporter(c, c.bufferSize, c.chroot, root, opts)
+	for i := range e.Nodes {
+		if err := imp.add(&e.Nodes[i]); err != nil {
+			return imp.result, err
+		}
+	}
+	return imp.result, imp.flush()
+}
+
+// ImportStream is like Import, but reads the export from JSON lines written
+// by ExportStream.
+func (c *Conn) ImportStream(r io.Reader, root string, opts *ImportOptions) (*ImportResult, error) {
+	return importStream(c, c.bufferSize, c.chroot, r, root, opts)
+}
+
+func exportedNode(node *WalkNode) ExportedNode {
+	return ExportedNode{
+		Data:      node.Data,
+		ACL:       node.ACL,
+		Ephemeral: node.Stat.EphemeralOwner != 0,
+		Stat: ExportedStat{
+			Czxid:          node.Stat.Czxid,
+			Mzxid:          node.Stat.Mzxid,
+			Ctime:          node.Stat.Ctime,
+			Mtime:          node.Stat.Mtime,
+			Version:        node.Stat.Version,
+			Cversion:       node.Stat.Cversion,
+			Aversion:       node.Stat.Aversion,
+			EphemeralOwner: node.Stat.EphemeralOwner,
+		},
+	}
+}
+
+// relativePath returns path relative to root, "/" for root itself.
+func relativePath(root, path string) string {
+	if root == "/" {
+		return path
+	}
+	if path == root {
+		return "/"
+	}
+	return strings.TrimPrefix(path, root)
+}
+
+func exportTree(c Client, root string) (*Export, error) {
+	e := &Export{ExportHeader: ExportHeader{Version: ExportVersion, Root: root, ExportedAt: time.Now().UTC(), Server: c.Server()}}
+	err := walk(c, root, func(node *WalkNode) error {
+		n := exportedNode(node)
+		n.Path = relativePath(root, node.Path)
+		e.Nodes = append(e.Nodes, n)
+		return nil
+	}, &WalkOptions{Data: true, ACL: true})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(e.Nodes, func(i, j int) bool { return e.Nodes[i].Path < e.Nodes[j].Path })
+	return e, nil
+}
+
+func exportStream(c Client, w io.Writer, root string) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(ExportHeader{Version: ExportVersion, Root: root, ExportedAt: time.Now().UTC(), Server: c.Server()}); err != nil {
+		return err
+	}
+	// Pre-order, so that parents are written before their children.
+	err := walk(c, root, func(node *WalkNode) error {
+		n := exportedNode(node)
+		n.Path = relativePath(root, node.Path)
+		return enc.Encode(&n)
+	}, &WalkOptions{Data: true, ACL: true})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func importStream(c Client, bufferSize int, chroot string, r io.Reader, root string, opts *ImportOptions) (*ImportResult, error) {
+	dec := json.NewDecoder(r)
+	var hdr ExportHeader
+	if err := dec.Decode(&hdr); err != nil {
+		return nil, fmt.Errorf("zk: reading export header: %w", err)
+	}
+	if hdr.Version != ExportVersion {
+		return nil, fmt.Errorf("zk: unsupported export version %d", hdr.Version)
+	}
+	imp := newImporter(c, bufferSize, chroot, root, opts)
+	for {
+		var n ExportedNode
+		if err := dec.Decode(&n); err == io.EOF {
+			break
+		} else if err != nil {
+			return imp.result, fmt.Errorf("zk: reading exported node: %w", err)
+		}
+		if err := imp.add(&n); err != nil {
+			return imp.result, err
+		}
+	}
+	return imp.result, imp.flush()
+}
+
+// importer applies exported nodes in Multi batches.
+type importer struct {
+	c          Client
+	bufferSize int
+	chroot     string // prefix c adds to every path, counted in the batch size
+	root       string
+	opts       ImportOptions
+	result     *ImportResult
+
+	parentACL   []ACL // ACL of the missing parents of root
+	parentsDone bool
+	pending     []*ExportedNode
+	size        int // estimated size of the multi request for pending
+}
+
+func newImporter(c Client, bufferSize int, chroot string, root string, opts *ImportOptions) *importer {
+	imp := &importer{c: c, bufferSize: bufferSize, chroot: chroot, root: root, result: &ImportResult{}, size: multiOverhead}
+	if opts != nil {
+		imp.opts = *opts
+	}
+	return imp
+}
+
+func (imp *importer) target(n *ExportedNode) string {
+	if n.Path == "/" {
+		return imp.root
+	}
+	if imp.root == "/" {
+		return n.Path
+	}
+	return imp.root + n.Path
+}
+
+// add queues a node, applying the queued ones first if it doesn't fit in
+// the batch.
+func (imp *importer) add(n *ExportedNode) error {
+	if n.Path == "/" {
+		imp.parentACL = n.ACL
+	}
+	if n.Ephemeral && !imp.opts.Ephemeral {
+		imp.result.Skipped = append(imp.result.Skipped, imp.target(n))
+		return nil
+	}
+	size := importOpSize(imp.chroot+imp.target(n), n)
+	if len(imp.pending) > 0 && imp.size+size > imp.bufferSize {
+		if err := imp.flush(); err != nil {
+			return err
+		}
+	}
+	imp.pending = append(imp.pending, n)
+	imp.size += size
+	return nil
+}
+
+// flush applies the queued nodes with a single Multi request.
+func (imp *importer) flush() error {
+	if len(imp.pending) == 0 {
+		return nil
+	}
+	if !imp.parentsDone && !imp.opts.DryRun && imp.root != "/" {
+		acl := imp.parentACL
+		if len(acl) == 0 {
+			acl = WorldACL(PermAll)
+		}
+		if err := createParents(imp.c, imp.root, acl); err != nil {
+			return err
+		}
+		imp.parentsDone = true
+	}
+
+	var ops []interface{}
+	var created, updated, skipped []string
+	var acls []func() error
+	for _, n := range imp.pending {
+		path := imp.target(n)
+		exists, stat, err := imp.c.Exists(path)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			flags := int32(0)
+			if n.Ephemeral {
+				flags = FlagEphemeral
+			}
+			ops = append(ops, &CreateRequest{Path: path, Data: n.Data, Acl: n.ACL, Flags: flags})
+			created = append(created, path)
+			continue
+		}
+
+		version := int32(-1)
+		switch imp.opts.Conflict {
+		case ConflictSkip:
+			skipped = append(skipped, path)
+			continue
+		case ConflictFailOnVersionMismatch:
+			if stat.Version != n.Stat.Version {
+				return &OpError{Op: "import", Path: path, Server: imp.c.Server(), SessionID: imp.c.SessionID(), Err: ErrBadVersion}
+			}
+			version = n.Stat.Version
+		}
+		ops = append(ops, &SetDataRequest{Path: path, Data: n.Data, Version: version})
+		updated = append(updated, path)
+		if len(n.ACL) > 0 {
+			path, acl := path, n.ACL
+			acls = append(acls, func() error {
+				_, err := imp.c.SetACL(path, acl, -1)
+				return err
+			})
+		}
+	}
+	imp.pending, imp.size = nil, multiOverhead
+
+	if !imp.opts.DryRun && len(ops) > 0 {
+		if _, err := imp.c.Multi(ops...); err != nil {
+			return err
+		}
+		// ACLs can't be set in a multi request.
+		for _, setACL := range acls {
+			if err := setACL(); err != nil {
+				return err
+			}
+		}
+	}
+	imp.result.Created = append(imp.result.Created, created...)
+	imp.result.Updated = append(imp.result.Updated, updated...)
+	imp.result.Skipped = append(imp.result.Skipped, skipped...)
+	return nil
+}
+
+// importOpSize estimates the encoded size of a create or setData operation
+// in a multi request.
+func importOpSize(path string, n *ExportedNode) int {
+	size := 9 + 4 + len(path) + 4 + len(n.Data) + 4 + 4
+	for _, acl := range n.ACL {
+		size += 4 + 4 + len(acl.Scheme) + 4 + len(acl.ID)
+	}
+	return size
+}
@@ -0,0 +1,223 @@
+package zk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func exportSource(t *testing.T) *FakeClient {
+	t.Helper()
+	f := NewFakeClient()
+	acl := DigestACL(PermAll, "user", "pass")
+	for _, n := range []struct {
+		path  string
+		data  string
+		flags int32
+	}{
+		{"/src", "root", 0},
+		{"/src/a", "alpha", 0},
+		{"/src/a/b", "beta", 0},
+		{"/src/eph", "gone", FlagEphemeral},
+	} {
+		if _, err := f.Create(n.path, []byte(n.data), n.flags, acl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+func checkImported(t *testing.T, f *FakeClient, root string) {
+	t.Helper()
+	for path, want := range map[string]string{root: "root", root + "/a": "alpha", root + "/a/b": "beta"} {
+		data, _, err := f.Get(path)
+		if err != nil || string(data) != want {
+			t.Errorf("Get(%q) = (%q, %v); want %q", path, data, err, want)
+		}
+		if acl, _, _ := f.GetACL(path); !reflect.DeepEqual(acl, DigestACL(PermAll, "user", "pass")) {
+			t.Errorf("ACL of %s = %v; want the exported one", path, acl)
+		}
+	}
+	if ok, _, _ := f.Exists(root + "/eph"); ok {
+		t.Error("ephemeral node was imported")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+	e, err := exportTree(exportSource(t), "/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, n := range e.Nodes {
+		paths = append(paths, n.Path)
+	}
+	if want := []string{"/", "/a", "/a/b", "/eph"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("exported paths %v; want %v", paths, want)
+	}
+	if n := e.Nodes[3]; !n.Ephemeral || n.Stat.EphemeralOwner == 0 {
+		t.Errorf("ephemeral node exported as %+v", n)
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Export
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Version != ExportVersion || decoded.Root != "/src" || len(decoded.Nodes) != 4 {
+		t.Fatalf("decoded export = %+v", decoded)
+	}
+
+	dst := NewFakeClient()
+	imp := newImporter(dst, 1<<20, "", "/restored/here", nil)
+	for i := range decoded.Nodes {
+		if err := imp.add(&decoded.Nodes[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := imp.flush(); err != nil {
+		t.Fatalf("import returned error: %+v", err)
+	}
+	checkImported(t, dst, "/restored/here")
+	if got := imp.result.Created; len(got) != 3 {
+		t.Errorf("created %v; want 3 nodes", got)
+	}
+	if got := imp.result.Skipped; !reflect.DeepEqual(got, []string{"/restored/here/eph"}) {
+		t.Errorf("skipped %v; want the ephemeral node", got)
+	}
+}
+
+func TestExportImportStream(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := exportStream(exportSource(t), &buf, "/src"); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 5 {
+		t.Errorf("stream has %d lines; want a header and 4 nodes:\n%s", lines, buf.String())
+	}
+
+	dst := NewFakeClient()
+	// Room for a single node per batch.
+	res, err := importStream(dst, multiOverhead+100, "", &buf, "/dst", &ImportOptions{Ephemeral: true})
+	if err != nil {
+		t.Fatalf("importStream returned error: %+v", err)
+	}
+	if len(res.Created) != 4 {
+		t.Errorf("created %v; want 4 nodes", res.Created)
+	}
+	multis := 0
+	for _, call := range dst.Calls() {
+		if call.Method == "Multi" {
+			multis++
+		}
+	}
+	if multis != 4 {
+		t.Errorf("import sent %d Multi requests; want 4", multis)
+	}
+	if _, st, err := dst.Get("/dst/eph"); err != nil || st.EphemeralOwner != dst.SessionID() {
+		t.Errorf("ephemeral node imported with %+v, %v; want it owned by the session", st, err)
+	}
+
+	if _, err := importStream(dst, 1<<20, "", strings.NewReader(`{"version":2}`), "/dst", nil); err == nil {
+		t.Error("importStream accepted an unknown version")
+	}
+}
+
+func TestImportChrootBatchSize(t *testing.T) {
+	t.Parallel()
+	e, err := exportTree(exportSource(t), "/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Room for every node in one batch, but only without the chroot prefix.
+	imported := func(chroot string) int {
+		dst := NewFakeClient()
+		bufferSize := multiOverhead
+		imp := newImporter(dst, 0, chroot, "/dst", nil)
+		for i := range e.Nodes {
+			if !e.Nodes[i].Ephemeral {
+				bufferSize += importOpSize(imp.target(&e.Nodes[i]), &e.Nodes[i])
+			}
+		}
+		imp.bufferSize = bufferSize
+		for i := range e.Nodes {
+			if err := imp.add(&e.Nodes[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := imp.flush(); err != nil {
+			t.Fatal(err)
+		}
+		multis := 0
+		for _, call := range dst.Calls() {
+			if call.Method == "Multi" {
+				multis++
+			}
+		}
+		return multis
+	}
+	if n := imported(""); n != 1 {
+		t.Errorf("import without a chroot sent %d Multi requests; want 1", n)
+	}
+	if n := imported("/chroot"); n != 2 {
+		t.Errorf("import below a chroot sent %d Multi requests; want 2", n)
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	t.Parallel()
+	e, err := exportTree(exportSource(t), "/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported := func(opts *ImportOptions) (*FakeClient, *ImportResult, error) {
+		dst := NewFakeClient()
+		dst.Create("/dst", []byte("old"), 0, WorldACL(PermAll))
+		imp := newImporter(dst, 1<<20, "", "/dst", opts)
+		for i := range e.Nodes {
+			if err := imp.add(&e.Nodes[i]); err != nil {
+				return dst, imp.result, err
+			}
+		}
+		return dst, imp.result, imp.flush()
+	}
+
+	dst, res, err := imported(&ImportOptions{Conflict: ConflictSkip})
+	if err != nil || !reflect.DeepEqual(res.Skipped, []string{"/dst/eph", "/dst"}) {
+		t.Errorf("ConflictSkip: (%+v, %v)", res, err)
+	}
+	if data, _, _ := dst.Get("/dst"); string(data) != "old" {
+		t.Errorf("ConflictSkip changed the existing node to %q", data)
+	}
+
+	dst, res, err = imported(&ImportOptions{Conflict: ConflictOverwrite})
+	if err != nil || !reflect.DeepEqual(res.Updated, []string{"/dst"}) {
+		t.Errorf("ConflictOverwrite: (%+v, %v)", res, err)
+	}
+	checkImported(t, dst, "/dst")
+
+	// Both versions are 0.
+	if _, _, err = imported(&ImportOptions{Conflict: ConflictFailOnVersionMismatch}); err != nil {
+		t.Errorf("ConflictFailOnVersionMismatch with matching versions returned %v", err)
+	}
+	e.Nodes[0].Stat.Version = 3
+	if _, _, err = imported(&ImportOptions{Conflict: ConflictFailOnVersionMismatch}); !errors.Is(err, ErrBadVersion) {
+		t.Errorf("ConflictFailOnVersionMismatch returned %v; want ErrBadVersion", err)
+	}
+
+	dst, res, err = imported(&ImportOptions{DryRun: true})
+	if err != nil || !reflect.DeepEqual(res.Created, []string{"/dst/a", "/dst/a/b"}) {
+		t.Errorf("DryRun: (%+v, %v)", res, err)
+	}
+	if ok, _, _ := dst.Exists("/dst/a"); ok {
+		t.Error("DryRun created nodes")
+	}
+}
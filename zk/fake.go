@@ -0,0 +1,676 @@
+package zk
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeCall is a single call recorded by FakeClient.
+type FakeCall struct {
+	Method string
+	Path   string
+	Err    error
+}
+
+type fakeNode struct {
+	data     []byte
+	acl      []ACL
+	stat     Stat
+	children map[string]struct{}
+}
+
+type fakeError struct {
+	method string
+	path   string
+	err    error
+}
+
+// FakeClient is an in-memory implementation of Client intended for unit
+// tests. It keeps a znode tree, fires watches the same way Conn does and
+// records every call. Errors can be scripted with InjectError.
+//
+// ACLs are stored and returned but never enforced.
+type FakeClient struct {
+	mu        sync.Mutex
+	nodes     map[string]*fakeNode
+	watchers  map[watchPathType][]chan Event
+	creds     []authCreds
+	calls     []FakeCall
+	errs      []fakeError
+	zxid      int64
+	sessionID int64
+	state     State
+	server    string
+	logger    Logger
+}
+
+var _ Client = &FakeClient{}
+
+// NewFakeClient returns a FakeClient holding an empty tree with only the
+// root node and a session in the StateHasSession state.
+func NewFakeClient() *FakeClient {
+	f := &FakeClient{
+		nodes:     make(map[string]*fakeNode),
+		watchers:  make(map[watchPathType][]chan Event),
+		sessionID: 1,
+		state:     StateHasSession,
+		server:    "fake:2181",
+		logger:    DefaultLogger,
+	}
+	f.nodes["/"] = &fakeNode{children: make(map[string]struct{})}
+	return f
+}
+
+// InjectError makes the next call of method on path fail with err. An empty
+// path matches any path. Injected errors are consumed in the order they were
+// added and each one fires only once.
+func (f *FakeClient) InjectError(method, path string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = append(f.errs, fakeError{method: method, path: path, err: err})
+}
+
+// Calls returns a copy of the calls recorded so far.
+func (f *FakeClient) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := make([]FakeCall, len(f.calls))
+	copy(calls, f.calls)
+	return calls
+}
+
+// ResetCalls clears the recorded calls.
+func (f *FakeClient) ResetCalls() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+// ExpireSession simulates the server expiring the session: ephemeral nodes
+// owned by the session are removed, all watches fire with ErrSessionExpired
+// and a new session ID is assigned.
+func (f *FakeClient) ExpireSession() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for p, n := range f.nodes {
+		if n.stat.EphemeralOwner == f.sessionID {
+			f.removeNode(p)
+		}
+	}
+	f.invalidateWatches(ErrSessionExpired)
+	f.sessionID++
+}
+
+// begin records a call and returns any error injected for it. It must be
+// called with f.mu held.
+func (f *FakeClient) begin(method, path string) error {
+	var err error
+	if f.state == StateDisconnected {
+		err = ErrClosing
+	} else {
+		for i, e := range f.errs {
+			if e.method == method && (e.path == "" || e.path == path) {
+				err = e.err
+				f.errs = append(f.errs[:i], f.errs[i+1:]...)
+				break
+			}
+		}
+	}
+	f.calls = append(f.calls, FakeCall{Method: method, Path: path, Err: err})
+	return err
+}
+
+// end updates the error of the most recently recorded call.
+func (f *FakeClient) end(err error) error {
+	f.calls[len(f.calls)-1].Err = err
+	return err
+}
+
+func (f *FakeClient) AddAuth(scheme string, auth []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("AddAuth", ""); err != nil {
+		return err
+	}
+	for _, cred := range f.creds {
+		if cred.scheme == scheme && bytes.Equal(cred.auth, auth) {
+			return nil
+		}
+	}
+	f.creds = append(f.creds, authCreds{scheme: scheme, auth: auth})
+	return nil
+}
+
+func (f *FakeClient) Children(path string) ([]string, *Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("Children", path); err != nil {
+		return nil, &Stat{}, err
+	}
+	n, ok := f.nodes[path]
+	if !ok {
+		return nil, &Stat{}, f.end(ErrNoNode)
+	}
+	stat := n.stat
+	return n.childNames(), &stat, nil
+}
+
+func (f *FakeClient) ChildrenW(path string) ([]string, *Stat, <-chan Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("ChildrenW", path); err != nil {
+		return nil, nil, nil, err
+	}
+	n, ok := f.nodes[path]
+	if !ok {
+		return nil, nil, nil, f.end(ErrNoNode)
+	}
+	stat := n.stat
+	return n.childNames(), &stat, f.addWatcher(path, watchTypeChild), nil
+}
+
+func (f *FakeClient) Get(path string) ([]byte, *Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("Get", path); err != nil {
+		return nil, &Stat{}, err
+	}
+	n, ok := f.nodes[path]
+	if !ok {
+		return nil, &Stat{}, f.end(ErrNoNode)
+	}
+	stat := n.stat
+	return copyBytes(n.data), &stat, nil
+}
+
+func (f *FakeClient) GetW(path string) ([]byte, *Stat, <-chan Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("GetW", path); err != nil {
+		return nil, nil, nil, err
+	}
+	n, ok := f.nodes[path]
+	if !ok {
+		return nil, nil, nil, f.end(ErrNoNode)
+	}
+	stat := n.stat
+	return copyBytes(n.data), &stat, f.addWatcher(path, watchTypeData), nil
+}
+
+func (f *FakeClient) Set(path string, data []byte, version int32) (*Stat, error) {
+	if path == "" {
+		return nil, ErrInvalidPath
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("Set", path); err != nil {
+		return &Stat{}, err
+	}
+	var events []Event
+	stat, err := f.set(path, data, version, &events)
+	if err != nil {
+		return &Stat{}, f.end(err)
+	}
+	f.fire(events)
+	return stat, nil
+}
+
+func (f *FakeClient) Create(path string, data []byte, flags int32, acl []ACL) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("Create", path); err != nil {
+		return "", err
+	}
+	var events []Event
+	p, _, err := f.create(path, data, flags, acl, &events)
+	if err != nil {
+		return "", f.end(err)
+	}
+	f.fire(events)
+	return p, nil
+}
+
+func (f *FakeClient) Create2(path string, data []byte, flags int32, acl []ACL) (string, *Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("Create2", path); err != nil {
+		return "", nil, err
+	}
+	var events []Event
+	p, stat, err := f.create(path, data, flags, acl, &events)
+	if err != nil {
+		return "", nil, f.end(err)
+	}
+	f.fire(events)
+	return p, stat, nil
+}
+
+// CreateContainer creates a persistent node. The fake never deletes
+// containers.
+func (f *FakeClient) CreateContainer(path string, data []byte, acl []ACL) (string, *Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("CreateContainer", path); err != nil {
+		return "", nil, err
+	}
+	var events []Event
+	p, stat, err := f.create(path, data, 0, acl, &events)
+	if err != nil {
+		return "", nil, f.end(err)
+	}
+	f.fire(events)
+	return p, stat, nil
+}
+
+// CreateTTL creates a persistent node, sequential if flags has FlagSequence.
+// The fake never deletes expired nodes.
+func (f *FakeClient) CreateTTL(path string, data []byte, flags int32, acl []ACL, ttl time.Duration) (string, *Stat, error) {
+	if flags&FlagEphemeral != 0 {
+		return "", nil, ErrBadArguments
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("CreateTTL", path); err != nil {
+		return "", nil, err
+	}
+	var events []Event
+	p, stat, err := f.create(path, data, flags&FlagSequence, acl, &events)
+	if err != nil {
+		return "", nil, f.end(err)
+	}
+	f.fire(events)
+	return p, stat, nil
+}
+
+func (f *FakeClient) CreateProtectedEphemeralSequential(path string, data []byte, acl []ACL) (string, error) {
+	return createProtectedEphemeralSequential(f, path, data, acl)
+}
+
+func (f *FakeClient) Delete(path string, version int32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("Delete", path); err != nil {
+		return err
+	}
+	var events []Event
+	if err := f.delete(path, version, &events); err != nil {
+		return f.end(err)
+	}
+	f.fire(events)
+	return nil
+}
+
+func (f *FakeClient) Exists(path string) (bool, *Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("Exists", path); err != nil {
+		return true, &Stat{}, err
+	}
+	n, ok := f.nodes[path]
+	if !ok {
+		return false, &Stat{}, nil
+	}
+	stat := n.stat
+	return true, &stat, nil
+}
+
+func (f *FakeClient) ExistsW(path string) (bool, *Stat, <-chan Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("ExistsW", path); err != nil {
+		return false, nil, nil, err
+	}
+	n, ok := f.nodes[path]
+	if !ok {
+		return false, &Stat{}, f.addWatcher(path, watchTypeExist), nil
+	}
+	stat := n.stat
+	return true, &stat, f.addWatcher(path, watchTypeData), nil
+}
+
+func (f *FakeClient) GetACL(path string) ([]ACL, *Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("GetACL", path); err != nil {
+		return nil, &Stat{}, err
+	}
+	n, ok := f.nodes[path]
+	if !ok {
+		return nil, &Stat{}, f.end(ErrNoNode)
+	}
+	stat := n.stat
+	return append([]ACL(nil), n.acl...), &stat, nil
+}
+
+func (f *FakeClient) SetACL(path string, acl []ACL, version int32) (*Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("SetACL", path); err != nil {
+		return &Stat{}, err
+	}
+	n, ok := f.nodes[path]
+	if !ok {
+		return &Stat{}, f.end(ErrNoNode)
+	}
+	if len(acl) == 0 {
+		return &Stat{}, f.end(ErrInvalidACL)
+	}
+	if version != -1 && version != n.stat.Aversion {
+		return &Stat{}, f.end(ErrBadVersion)
+	}
+	n.acl = append([]ACL(nil), acl...)
+	n.stat.Aversion++
+	stat := n.stat
+	return &stat, nil
+}
+
+func (f *FakeClient) Sync(path string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("Sync", path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Multi applies all ops or none of them. Watches fire only when every
+// operation succeeds.
+func (f *FakeClient) Multi(ops ...interface{}) ([]MultiResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.begin("Multi", ""); err != nil {
+		return nil, err
+	}
+
+	backup := make(map[string]*fakeNode, len(f.nodes))
+	for p, n := range f.nodes {
+		backup[p] = n.clone()
+	}
+	zxid := f.zxid
+
+	var events []Event
+	var multiErr error
+	failed := -1
+	res := make([]MultiResponse, len(ops))
+	for i, op := range ops {
+		var err error
+		switch op := op.(type) {
+		case *CreateRequest:
+			res[i].String, _, err = f.create(op.Path, op.Data, op.Flags, op.Acl, &events)
+		case *SetDataRequest:
+			res[i].Stat, err = f.set(op.Path, op.Data, op.Version, &events)
+		case *DeleteRequest:
+			err = f.delete(op.Path, op.Version, &events)
+		case *CheckVersionRequest:
+			if n, ok := f.nodes[op.Path]; !ok {
+				err = ErrNoNode
+			} else if op.Version != -1 && op.Version != n.stat.Version {
+				err = ErrBadVersion
+			}
+		default:
+			// Conn.Multi rejects the request before sending anything.
+			f.nodes = backup
+			f.zxid = zxid
+			return nil, f.end(fmt.Errorf("unknown operation type %T", op))
+		}
+		if err != nil {
+			multiErr = err
+			failed = i
+			break
+		}
+	}
+
+	if multiErr != nil {
+		// Like the server, report success for the operations that were rolled
+		// back and a runtime inconsistency for those that never ran.
+		f.nodes = backup
+		f.zxid = zxid
+		for i := range res {
+			res[i] = MultiResponse{}
+			switch {
+			case i == failed:
+				res[i].Error = multiErr
+			case i > failed:
+				res[i].Error = ErrCode(errRuntimeInconsistency).toError()
+			}
+		}
+		return res, f.end(multiErr)
+	}
+	f.fire(events)
+	return res, nil
+}
+
+func (f *FakeClient) State() State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+func (f *FakeClient) SessionID() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sessionID
+}
+
+func (f *FakeClient) Server() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.server
+}
+
+func (f *FakeClient) SetLogger(l Logger) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logger = l
+}
+
+// Close moves the client to StateDisconnected, removes the session's
+// ephemeral nodes and fires all watches with ErrClosing. Any later call
+// fails with ErrClosing.
+func (f *FakeClient) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, FakeCall{Method: "Close"})
+	if f.state == StateDisconnected {
+		return
+	}
+	for p, n := range f.nodes {
+		if n.stat.EphemeralOwner == f.sessionID {
+			f.removeNode(p)
+		}
+	}
+	f.invalidateWatches(ErrClosing)
+	f.state = StateDisconnected
+}
+
+func (f *FakeClient) create(path string, data []byte, flags int32, acl []ACL, events *[]Event) (string, *Stat, error) {
+	if err := validatePath(path, flags&FlagSequence != 0); err != nil {
+		return "", nil, err
+	}
+	if len(acl) == 0 {
+		return "", nil, ErrInvalidACL
+	}
+	parentPath, _ := splitFakePath(path)
+	parent, ok := f.nodes[parentPath]
+	if !ok {
+		return "", nil, ErrNoNode
+	}
+	if parent.stat.EphemeralOwner != 0 {
+		return "", nil, ErrNoChildrenForEphemerals
+	}
+	if flags&FlagSequence != 0 {
+		path = fmt.Sprintf("%s%010d", path, parent.stat.Cversion)
+	}
+	if _, ok := f.nodes[path]; ok {
+		return "", nil, ErrNodeExists
+	}
+
+	f.zxid++
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	n := &fakeNode{
+		data:     copyBytes(data),
+		acl:      append([]ACL(nil), acl...),
+		children: make(map[string]struct{}),
+		stat: Stat{
+			Czxid:      f.zxid,
+			Mzxid:      f.zxid,
+			Pzxid:      f.zxid,
+			Ctime:      now,
+			Mtime:      now,
+			DataLength: int32(len(data)),
+		},
+	}
+	if flags&FlagEphemeral != 0 {
+		n.stat.EphemeralOwner = f.sessionID
+	}
+	f.nodes[path] = n
+
+	_, name := splitFakePath(path)
+	parent.children[name] = struct{}{}
+	parent.stat.Cversion++
+	parent.stat.NumChildren++
+	parent.stat.Pzxid = f.zxid
+
+	*events = append(*events,
+		Event{Type: EventNodeCreated, State: StateConnected, Path: path},
+		Event{Type: EventNodeChildrenChanged, State: StateConnected, Path: parentPath},
+	)
+	stat := n.stat
+	return path, &stat, nil
+}
+
+func (f *FakeClient) set(path string, data []byte, version int32, events *[]Event) (*Stat, error) {
+	n, ok := f.nodes[path]
+	if !ok {
+		return nil, ErrNoNode
+	}
+	if version != -1 && version != n.stat.Version {
+		return nil, ErrBadVersion
+	}
+	f.zxid++
+	n.data = copyBytes(data)
+	n.stat.Version++
+	n.stat.Mzxid = f.zxid
+	n.stat.Mtime = time.Now().UnixNano() / int64(time.Millisecond)
+	n.stat.DataLength = int32(len(data))
+
+	*events = append(*events, Event{Type: EventNodeDataChanged, State: StateConnected, Path: path})
+	stat := n.stat
+	return &stat, nil
+}
+
+func (f *FakeClient) delete(path string, version int32, events *[]Event) error {
+	if path == "/" {
+		return ErrInvalidPath
+	}
+	n, ok := f.nodes[path]
+	if !ok {
+		return ErrNoNode
+	}
+	if version != -1 && version != n.stat.Version {
+		return ErrBadVersion
+	}
+	if len(n.children) > 0 {
+		return ErrNotEmpty
+	}
+	f.zxid++
+	parentPath := f.removeNode(path)
+	*events = append(*events,
+		Event{Type: EventNodeDeleted, State: StateConnected, Path: path},
+		Event{Type: EventNodeChildrenChanged, State: StateConnected, Path: parentPath},
+	)
+	return nil
+}
+
+// removeNode unlinks path from the tree and returns its parent path.
+func (f *FakeClient) removeNode(path string) string {
+	parentPath, name := splitFakePath(path)
+	delete(f.nodes, path)
+	if parent, ok := f.nodes[parentPath]; ok {
+		delete(parent.children, name)
+		parent.stat.Cversion++
+		parent.stat.NumChildren--
+		parent.stat.Pzxid = f.zxid
+	}
+	return parentPath
+}
+
+func (f *FakeClient) addWatcher(path string, watchType watchType) <-chan Event {
+	ch := make(chan Event, 1)
+	wpt := watchPathType{path, watchType}
+	f.watchers[wpt] = append(f.watchers[wpt], ch)
+	return ch
+}
+
+// fire delivers events to matching watchers using the same rules as the
+// receive loop of Conn.
+func (f *FakeClient) fire(events []Event) {
+	for _, ev := range events {
+		var wTypes []watchType
+		switch ev.Type {
+		case EventNodeCreated:
+			wTypes = []watchType{watchTypeExist}
+		case EventNodeDeleted, EventNodeDataChanged:
+			wTypes = []watchType{watchTypeExist, watchTypeData, watchTypeChild}
+		case EventNodeChildrenChanged:
+			wTypes = []watchType{watchTypeChild}
+		}
+		for _, t := range wTypes {
+			wpt := watchPathType{ev.Path, t}
+			for _, ch := range f.watchers[wpt] {
+				ch <- ev
+				close(ch)
+			}
+			delete(f.watchers, wpt)
+		}
+	}
+}
+
+func (f *FakeClient) invalidateWatches(err error) {
+	for pathType, watchers := range f.watchers {
+		ev := Event{Type: EventNotWatching, State: StateDisconnected, Path: pathType.path, Err: err}
+		for _, ch := range watchers {
+			ch <- ev
+			close(ch)
+		}
+	}
+	f.watchers = make(map[watchPathType][]chan Event)
+}
+
+func (n *fakeNode) childNames() []string {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n *fakeNode) clone() *fakeNode {
+	c := *n
+	c.children = make(map[string]struct{}, len(n.children))
+	for name := range n.children {
+		c.children[name] = struct{}{}
+	}
+	return &c
+}
+
+func splitFakePath(path string) (parent, name string) {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/", path[i+1:]
+	}
+	return path[:i], path[i+1:]
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,205 @@
+package zk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClientCreateGetSet(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+
+	if _, err := f.Create("/foo/bar", nil, 0, WorldACL(PermAll)); err != ErrNoNode {
+		t.Fatalf("Create without parent returned %v; want ErrNoNode", err)
+	}
+	if p, err := f.Create("/foo", []byte("a"), 0, WorldACL(PermAll)); err != nil {
+		t.Fatalf("Create returned error: %+v", err)
+	} else if p != "/foo" {
+		t.Fatalf("Create returned path %q", p)
+	}
+	if _, err := f.Create("/foo", nil, 0, WorldACL(PermAll)); err != ErrNodeExists {
+		t.Fatalf("Create of existing node returned %v; want ErrNodeExists", err)
+	}
+
+	if _, err := f.Set("/foo", []byte("b"), 5); err != ErrBadVersion {
+		t.Fatalf("Set with wrong version returned %v; want ErrBadVersion", err)
+	}
+	if stat, err := f.Set("/foo", []byte("bc"), 0); err != nil {
+		t.Fatalf("Set returned error: %+v", err)
+	} else if stat.Version != 1 || stat.DataLength != 2 {
+		t.Fatalf("Set returned unexpected stat %+v", stat)
+	}
+	if data, _, err := f.Get("/foo"); err != nil {
+		t.Fatalf("Get returned error: %+v", err)
+	} else if string(data) != "bc" {
+		t.Fatalf("Get returned %q; want %q", data, "bc")
+	}
+
+	p1, _ := f.Create("/foo/seq-", nil, FlagSequence, WorldACL(PermAll))
+	p2, _ := f.Create("/foo/seq-", nil, FlagSequence, WorldACL(PermAll))
+	if p1 != "/foo/seq-0000000000" || p2 != "/foo/seq-0000000001" {
+		t.Fatalf("unexpected sequential paths %q, %q", p1, p2)
+	}
+	if children, stat, err := f.Children("/foo"); err != nil {
+		t.Fatalf("Children returned error: %+v", err)
+	} else if len(children) != 2 || stat.NumChildren != 2 {
+		t.Fatalf("Children returned %v, %+v", children, stat)
+	}
+	if err := f.Delete("/foo", -1); err != ErrNotEmpty {
+		t.Fatalf("Delete of non-empty node returned %v; want ErrNotEmpty", err)
+	}
+}
+
+func TestFakeClientCreateContainerAndTTL(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+
+	if p, stat, err := f.CreateContainer("/c", []byte("x"), WorldACL(PermAll)); err != nil || p != "/c" || stat.DataLength != 1 {
+		t.Fatalf("CreateContainer returned %q, %+v, %v", p, stat, err)
+	}
+	if p, _, err := f.CreateTTL("/c/t-", nil, FlagSequence, WorldACL(PermAll), time.Minute); err != nil || p != "/c/t-0000000000" {
+		t.Fatalf("CreateTTL returned %q, %v", p, err)
+	}
+	if _, _, err := f.CreateTTL("/c/e", nil, FlagEphemeral, WorldACL(PermAll), time.Minute); err != ErrBadArguments {
+		t.Fatalf("ephemeral CreateTTL returned %v; want ErrBadArguments", err)
+	}
+	if _, _, err := f.CreateTTL("/c/t-0000000000", nil, 0, WorldACL(PermAll), time.Minute); err != ErrNodeExists {
+		t.Fatalf("CreateTTL of existing node returned %v; want ErrNodeExists", err)
+	}
+	if children, _, _ := f.Children("/c"); len(children) != 1 {
+		t.Fatalf("children of the container = %v", children)
+	}
+}
+
+func TestFakeClientWatches(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+
+	exists, _, existCh, err := f.ExistsW("/node")
+	if err != nil || exists {
+		t.Fatalf("ExistsW returned %v, %v", exists, err)
+	}
+	_, _, childCh, err := f.ChildrenW("/")
+	if err != nil {
+		t.Fatalf("ChildrenW returned error: %+v", err)
+	}
+	if _, err := f.Create("/node", nil, 0, WorldACL(PermAll)); err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-existCh; ev.Type != EventNodeCreated || ev.Path != "/node" {
+		t.Fatalf("unexpected exist event %+v", ev)
+	}
+	if ev := <-childCh; ev.Type != EventNodeChildrenChanged || ev.Path != "/" {
+		t.Fatalf("unexpected child event %+v", ev)
+	}
+
+	_, _, dataCh, err := f.GetW("/node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Delete("/node", -1); err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-dataCh; ev.Type != EventNodeDeleted {
+		t.Fatalf("unexpected data event %+v", ev)
+	}
+	if _, ok := <-dataCh; ok {
+		t.Fatal("watch channel should be closed after firing")
+	}
+
+	_, _, dataCh, _ = f.GetW("/")
+	f.Close()
+	if ev := <-dataCh; ev.Type != EventNotWatching || ev.Err != ErrClosing {
+		t.Fatalf("unexpected event after Close %+v", ev)
+	}
+	if _, _, err := f.Get("/"); err != ErrClosing {
+		t.Fatalf("Get after Close returned %v; want ErrClosing", err)
+	}
+}
+
+func TestFakeClientInjectError(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+
+	f.InjectError("Get", "/a", ErrConnectionClosed)
+	f.InjectError("Children", "", ErrSessionExpired)
+
+	if _, _, err := f.Get("/b"); err != ErrNoNode {
+		t.Fatalf("Get(/b) returned %v; want ErrNoNode", err)
+	}
+	if _, _, err := f.Get("/a"); err != ErrConnectionClosed {
+		t.Fatalf("Get(/a) returned %v; want ErrConnectionClosed", err)
+	}
+	if _, _, err := f.Children("/"); err != ErrSessionExpired {
+		t.Fatalf("Children returned %v; want ErrSessionExpired", err)
+	}
+	if _, _, err := f.Children("/"); err != nil {
+		t.Fatalf("injected error should fire once, got %v", err)
+	}
+
+	want := []FakeCall{
+		{Method: "Get", Path: "/b", Err: ErrNoNode},
+		{Method: "Get", Path: "/a", Err: ErrConnectionClosed},
+		{Method: "Children", Path: "/", Err: ErrSessionExpired},
+		{Method: "Children", Path: "/"},
+	}
+	calls := f.Calls()
+	if len(calls) != len(want) {
+		t.Fatalf("recorded %d calls; want %d: %+v", len(calls), len(want), calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %+v; want %+v", i, calls[i], want[i])
+		}
+	}
+}
+
+func TestFakeClientMultiIsAtomic(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+
+	ops := []interface{}{
+		&CreateRequest{Path: "/multi", Data: []byte{1}, Acl: WorldACL(PermAll)},
+		&SetDataRequest{Path: "/missing", Data: []byte{2}, Version: -1},
+	}
+	res, err := f.Multi(ops...)
+	if err != ErrNoNode {
+		t.Fatalf("Multi returned %v; want ErrNoNode", err)
+	}
+	if res[0].Error != nil || res[1].Error != ErrNoNode {
+		t.Fatalf("unexpected multi responses %+v", res)
+	}
+	if exists, _, _ := f.Exists("/multi"); exists {
+		t.Fatal("failed Multi should not leave changes behind")
+	}
+
+	if _, err := f.Multi(ops[0], &getDataRequest{Path: "/"}); err == nil {
+		t.Fatal("Multi accepted an unknown operation")
+	}
+	if exists, _, _ := f.Exists("/multi"); exists {
+		t.Fatal("Multi with an unknown operation should not leave changes behind")
+	}
+
+	if _, err := f.Multi(ops[0]); err != nil {
+		t.Fatalf("Multi returned error: %+v", err)
+	}
+	if exists, _, _ := f.Exists("/multi"); !exists {
+		t.Fatal("Multi should have created /multi")
+	}
+}
+
+func TestFakeClientLock(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+
+	l := NewLock(f, "/locks/test", WorldACL(PermAll))
+	if err := l.Lock(); err != nil {
+		t.Fatalf("Lock returned error: %+v", err)
+	}
+	if children, _, _ := f.Children("/locks/test"); len(children) != 1 {
+		t.Fatalf("expected one lock node, got %v", children)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatalf("Unlock returned error: %+v", err)
+	}
+}
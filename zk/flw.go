@@ -245,6 +245,16 @@ func parseInt64(s string) (int64, error) {
 	return strconv.ParseInt(s, 0, 64)
 }
 
+// isReadWriteServer uses the isro four letter word to check whether server
+// is serving read-write sessions.
+func isReadWriteServer(server string, timeout time.Duration) (bool, error) {
+	response, err := fourLetterWord(server, "isro", timeout)
+	if err != nil {
+		return false, err
+	}
+	return bytes.HasPrefix(response, []byte("rw")), nil
+}
+
 func fourLetterWord(server, command string, timeout time.Duration) ([]byte, error) {
 	conn, err := net.DialTimeout("tcp", server, timeout)
 	if err != nil {
@@ -282,6 +282,27 @@ func TestFLWCons(t *testing.T) {
 	}
 }
 
+func TestIsReadWriteServer(t *testing.T) {
+	t.Parallel()
+	for _, thing := range []string{"", "ro"} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+
+		go tcpServer(l, thing)
+
+		rw, err := isReadWriteServer(l.Addr().String(), time.Second*10)
+		if err != nil {
+			t.Fatalf("isReadWriteServer returned error: %+v", err)
+		}
+		if want := thing != "ro"; rw != want {
+			t.Errorf("isReadWriteServer = %v; want %v", rw, want)
+		}
+	}
+}
+
 func tcpServer(listener net.Listener, thing string) {
 	for {
 		conn, err := listener.Accept()
@@ -317,6 +338,15 @@ func connHandler(conn net.Conn, thing string) {
 		default:
 			conn.Write([]byte(zkSrvrOut))
 		}
+	case "isro":
+		switch thing {
+		case "dead":
+			return
+		case "ro":
+			conn.Write([]byte("ro"))
+		default:
+			conn.Write([]byte("rw"))
+		}
 	case "cons":
 		switch thing {
 		case "dead":
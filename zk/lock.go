@@ -16,7 +16,7 @@ var (
 
 // Lock is a mutual exclusion lock.
 type Lock struct {
-	c        *Conn
+	c        Client
 	path     string
 	acl      []ACL
 	lockPath string
@@ -26,7 +26,7 @@ type Lock struct {
 // NewLock creates a new lock instance using the provided connection, path, and acl.
 // The path must be a node that is only used by this lock. A lock instances starts
 // unlocked until Lock() is called.
-func NewLock(c *Conn, path string, acl []ACL) *Lock {
+func NewLock(c Client, path string, acl []ACL) *Lock {
 	return &Lock{
 		c:    c,
 		path: path,
@@ -53,24 +53,11 @@ func (l *Lock) Lock() error {
 	var err error
 	for i := 0; i < 3; i++ {
 		path, err = l.c.CreateProtectedEphemeralSequential(prefix, []byte{}, l.acl)
-		if err == ErrNoNode {
+		if errors.Is(err, ErrNoNode) {
 			// Create parent node.
-			parts := strings.Split(l.path, "/")
-			pth := ""
-			for _, p := range parts[1:] {
-				var exists bool
-				pth += "/" + p
-				exists, _, err = l.c.Exists(pth)
-				if err != nil {
-					return err
-				}
-				if exists == true {
-					continue
-				}
-				_, err = l.c.Create(pth, []byte{}, 0, l.acl)
-				if err != nil && err != ErrNodeExists {
-					return err
-				}
+			_, err = createAll(l.c, l.path, []byte{}, 0, l.acl)
+			if err != nil && !errors.Is(err, ErrNodeExists) {
+				return err
 			}
 		} else if err == nil {
 			break
@@ -117,9 +104,9 @@ func (l *Lock) Lock() error {
 
 		// Wait on the node next in line for the lock
 		_, _, ch, err := l.c.GetW(l.path + "/" + prevSeqPath)
-		if err != nil && err != ErrNoNode {
+		if err != nil && !errors.Is(err, ErrNoNode) {
 			return err
-		} else if err != nil && err == ErrNoNode {
+		} else if err != nil && errors.Is(err, ErrNoNode) {
 			// try again
 			continue
 		}
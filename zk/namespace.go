@@ -0,0 +1,221 @@
+package zk
+
+import (
+	"strings"
+	"time"
+)
+
+// namespace is a Client that prefixes every path with a fixed node, so that
+// several independent subsystems can share a single session.
+type namespace struct {
+	c      Client
+	prefix string
+}
+
+// Namespace returns a view of the connection in which every path is relative
+// to prefix. The view shares the session, watches and credentials of c.
+// Calling Close on the view does nothing; close c itself to end the session.
+// ErrInvalidPath is returned if prefix isn't a valid absolute path.
+func (c *Conn) Namespace(prefix string) (Client, error) {
+	return newNamespace(c, prefix)
+}
+
+func newNamespace(c Client, prefix string) (*namespace, error) {
+	if prefix == "/" {
+		prefix = ""
+	} else if err := validatePath(prefix, false); err != nil {
+		return nil, err
+	}
+	return &namespace{c: c, prefix: prefix}, nil
+}
+
+func (ns *namespace) fullPath(path string) string {
+	if path == "/" {
+		if ns.prefix == "" {
+			return path
+		}
+		return ns.prefix
+	}
+	return ns.prefix + path
+}
+
+func (ns *namespace) relPath(path string) string {
+	if ns.prefix == "" {
+		return path
+	}
+	if path == ns.prefix {
+		return "/"
+	}
+	if strings.HasPrefix(path, ns.prefix+"/") {
+		return path[len(ns.prefix):]
+	}
+	return path
+}
+
+// watch rewrites the path of the single event delivered on a watch channel.
+func (ns *namespace) watch(ch <-chan Event) <-chan Event {
+	if ch == nil {
+		return nil
+	}
+	out := make(chan Event, 1)
+	go func() {
+		defer close(out)
+		for ev := range ch {
+			ev.Path = ns.relPath(ev.Path)
+			out <- ev
+		}
+	}()
+	return out
+}
+
+func (ns *namespace) AddAuth(scheme string, auth []byte) error {
+	return ns.c.AddAuth(scheme, auth)
+}
+
+func (ns *namespace) Children(path string) ([]string, *Stat, error) {
+	return ns.c.Children(ns.fullPath(path))
+}
+
+func (ns *namespace) ChildrenW(path string) ([]string, *Stat, <-chan Event, error) {
+	children, stat, ch, err := ns.c.ChildrenW(ns.fullPath(path))
+	return children, stat, ns.watch(ch), err
+}
+
+func (ns *namespace) Get(path string) ([]byte, *Stat, error) {
+	return ns.c.Get(ns.fullPath(path))
+}
+
+func (ns *namespace) GetW(path string) ([]byte, *Stat, <-chan Event, error) {
+	data, stat, ch, err := ns.c.GetW(ns.fullPath(path))
+	return data, stat, ns.watch(ch), err
+}
+
+func (ns *namespace) Set(path string, data []byte, version int32) (*Stat, error) {
+	if path == "" {
+		return nil, ErrInvalidPath
+	}
+	return ns.c.Set(ns.fullPath(path), data, version)
+}
+
+func (ns *namespace) Create(path string, data []byte, flags int32, acl []ACL) (string, error) {
+	p, err := ns.c.Create(ns.fullPath(path), data, flags, acl)
+	if err != nil {
+		return "", err
+	}
+	return ns.relPath(p), nil
+}
+
+func (ns *namespace) Create2(path string, data []byte, flags int32, acl []ACL) (string, *Stat, error) {
+	p, stat, err := ns.c.Create2(ns.fullPath(path), data, flags, acl)
+	if err != nil {
+		return "", nil, err
+	}
+	return ns.relPath(p), stat, nil
+}
+
+func (ns *namespace) CreateContainer(path string, data []byte, acl []ACL) (string, *Stat, error) {
+	p, stat, err := ns.c.CreateContainer(ns.fullPath(path), data, acl)
+	if err != nil {
+		return "", nil, err
+	}
+	return ns.relPath(p), stat, nil
+}
+
+func (ns *namespace) CreateTTL(path string, data []byte, flags int32, acl []ACL, ttl time.Duration) (string, *Stat, error) {
+	p, stat, err := ns.c.CreateTTL(ns.fullPath(path), data, flags, acl, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+	return ns.relPath(p), stat, nil
+}
+
+func (ns *namespace) CreateProtectedEphemeralSequential(path string, data []byte, acl []ACL) (string, error) {
+	p, err := ns.c.CreateProtectedEphemeralSequential(ns.fullPath(path), data, acl)
+	if err != nil {
+		return "", err
+	}
+	return ns.relPath(p), nil
+}
+
+func (ns *namespace) adoptEphemeral(path string) {
+	if a, ok := ns.c.(ephemeralAdopter); ok {
+		a.adoptEphemeral(ns.fullPath(path))
+	}
+}
+
+func (ns *namespace) Delete(path string, version int32) error {
+	return ns.c.Delete(ns.fullPath(path), version)
+}
+
+func (ns *namespace) Exists(path string) (bool, *Stat, error) {
+	return ns.c.Exists(ns.fullPath(path))
+}
+
+func (ns *namespace) ExistsW(path string) (bool, *Stat, <-chan Event, error) {
+	exists, stat, ch, err := ns.c.ExistsW(ns.fullPath(path))
+	return exists, stat, ns.watch(ch), err
+}
+
+func (ns *namespace) GetACL(path string) ([]ACL, *Stat, error) {
+	return ns.c.GetACL(ns.fullPath(path))
+}
+
+func (ns *namespace) SetACL(path string, acl []ACL, version int32) (*Stat, error) {
+	return ns.c.SetACL(ns.fullPath(path), acl, version)
+}
+
+func (ns *namespace) Sync(path string) (string, error) {
+	p, err := ns.c.Sync(ns.fullPath(path))
+	return ns.relPath(p), err
+}
+
+func (ns *namespace) Multi(ops ...interface{}) ([]MultiResponse, error) {
+	nsOps := make([]interface{}, len(ops))
+	for i, op := range ops {
+		switch o := op.(type) {
+		case *CreateRequest:
+			r := *o
+			r.Path = ns.fullPath(r.Path)
+			nsOps[i] = &r
+		case *SetDataRequest:
+			r := *o
+			r.Path = ns.fullPath(r.Path)
+			nsOps[i] = &r
+		case *DeleteRequest:
+			r := *o
+			r.Path = ns.fullPath(r.Path)
+			nsOps[i] = &r
+		case *CheckVersionRequest:
+			r := *o
+			r.Path = ns.fullPath(r.Path)
+			nsOps[i] = &r
+		default:
+			nsOps[i] = op
+		}
+	}
+	res, err := ns.c.Multi(nsOps...)
+	for i := range res {
+		if res[i].String != "" {
+			res[i].String = ns.relPath(res[i].String)
+		}
+	}
+	return res, err
+}
+
+func (ns *namespace) State() State {
+	return ns.c.State()
+}
+
+func (ns *namespace) SessionID() int64 {
+	return ns.c.SessionID()
+}
+
+func (ns *namespace) Server() string {
+	return ns.c.Server()
+}
+
+func (ns *namespace) SetLogger(l Logger) {
+	ns.c.SetLogger(l)
+}
+
+func (ns *namespace) Close() {}
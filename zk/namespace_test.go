@@ -0,0 +1,66 @@
+package zk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+	if _, err := f.Create("/svc", nil, 0, WorldACL(PermAll)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, prefix := range []string{"", "svc", "/svc/", "/a//b"} {
+		if _, err := newNamespace(f, prefix); err != ErrInvalidPath {
+			t.Errorf("newNamespace(%q) returned %v; want ErrInvalidPath", prefix, err)
+		}
+	}
+	ns, err := newNamespace(f, "/svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := ns.Create("/a", []byte("x"), 0, WorldACL(PermAll)); err != nil {
+		t.Fatalf("Create returned error: %+v", err)
+	} else if p != "/a" {
+		t.Fatalf("Create returned %q; want /a", p)
+	}
+	if data, _, err := f.Get("/svc/a"); err != nil || string(data) != "x" {
+		t.Fatalf("node not created under prefix: %q, %v", data, err)
+	}
+
+	children, _, ch, err := ns.ChildrenW("/")
+	if err != nil {
+		t.Fatalf("ChildrenW returned error: %+v", err)
+	}
+	if len(children) != 1 || children[0] != "a" {
+		t.Fatalf("ChildrenW returned %v", children)
+	}
+
+	res, err := ns.Multi(&CreateRequest{Path: "/b", Acl: WorldACL(PermAll)})
+	if err != nil {
+		t.Fatalf("Multi returned error: %+v", err)
+	}
+	if res[0].String != "/b" {
+		t.Fatalf("Multi returned %q; want /b", res[0].String)
+	}
+	if ev := <-ch; ev.Path != "/" || ev.Type != EventNodeChildrenChanged {
+		t.Fatalf("unexpected watch event %+v", ev)
+	}
+
+	if p, _, err := ns.CreateContainer("/c", nil, WorldACL(PermAll)); err != nil || p != "/c" {
+		t.Fatalf("CreateContainer returned %q, %v; want /c", p, err)
+	}
+	if p, _, err := ns.CreateTTL("/c/t-", nil, FlagSequence, WorldACL(PermAll), time.Minute); err != nil || p != "/c/t-0000000000" {
+		t.Fatalf("CreateTTL returned %q, %v; want /c/t-0000000000", p, err)
+	}
+	if ok, _, _ := f.Exists("/svc/c/t-0000000000"); !ok {
+		t.Fatal("TTL node not created under prefix")
+	}
+
+	ns.Close()
+	if _, _, err := f.Get("/svc/b"); err != nil {
+		t.Fatalf("closing a namespace should not close the client: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package zk
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errPingTimeout is returned by sendLoop when a ping went unanswered for
+// longer than the ping timeout.
+var errPingTimeout = errors.New("zk: ping timeout")
+
+// PingStats describes the round trip times of the pings sent to keep the
+// session alive. RTTs are measured from writing a ping to reading its
+// response, so they include the time the server spent on earlier requests.
+type PingStats struct {
+	Count    int64         // Number of ping responses received.
+	Last     time.Duration // RTT of the latest ping.
+	Min      time.Duration // Smallest RTT seen.
+	Max      time.Duration // Largest RTT seen.
+	Mean     time.Duration // Average RTT.
+	Smoothed time.Duration // Exponentially weighted moving average of the RTT, weighting the latest ping by 1/8.
+
+	LastSent     time.Time // When the latest ping was sent.
+	LastReceived time.Time // When the latest ping response was received.
+	Outstanding  int       // Number of pings sent on the current connection without a response yet.
+	Timeouts     int64     // Number of connections closed because a ping went unanswered.
+}
+
+// WithPingTimeout returns a connection option that closes the connection,
+// and moves on to the next server, when a ping has not been answered within
+// timeout. Pings are sent every third of the session timeout, so this
+// detects a dead server or a half-open TCP connection well before the
+// session timeout. By default, and if timeout is zero, the connection is
+// only closed when nothing at all was received for two thirds of the
+// session timeout.
+func WithPingTimeout(timeout time.Duration) connOption {
+	return func(c *Conn) {
+		c.pingTimeout = timeout
+	}
+}
+
+// PingStats returns statistics about the pings sent to the servers.
+func (c *Conn) PingStats() PingStats {
+	return c.pings.snapshot()
+}
+
+// pingTracker matches ping responses to the pings sent. The server answers
+// requests in order, so the oldest outstanding ping is the one answered.
+type pingTracker struct {
+	mu      sync.Mutex
+	pending []time.Time // send times of unanswered pings, oldest first
+	sum     time.Duration
+	stats   PingStats
+}
+
+// reset forgets the pings outstanding on a previous connection.
+func (p *pingTracker) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = nil
+}
+
+func (p *pingTracker) sent(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, now)
+	p.stats.LastSent = now
+}
+
+func (p *pingTracker) received(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pending) == 0 {
+		return
+	}
+	rtt := now.Sub(p.pending[0])
+	p.pending = p.pending[1:]
+
+	s := &p.stats
+	s.Count++
+	s.Last = rtt
+	s.LastReceived = now
+	if s.Count == 1 || rtt < s.Min {
+		s.Min = rtt
+	}
+	if rtt > s.Max {
+		s.Max = rtt
+	}
+	p.sum += rtt
+	s.Mean = p.sum / time.Duration(s.Count)
+	if s.Count == 1 {
+		s.Smoothed = rtt
+	} else {
+		s.Smoothed += (rtt - s.Smoothed) / 8
+	}
+}
+
+// expired reports whether the oldest outstanding ping was sent more than
+// timeout before now, counting it as a timeout if so.
+func (p *pingTracker) expired(now time.Time, timeout time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pending) == 0 || now.Sub(p.pending[0]) <= timeout {
+		return false
+	}
+	p.stats.Timeouts++
+	return true
+}
+
+func (p *pingTracker) snapshot() PingStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.Outstanding = len(p.pending)
+	return s
+}
@@ -0,0 +1,80 @@
+package zk
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPingTrackerStats(t *testing.T) {
+	t.Parallel()
+	var p pingTracker
+	start := time.Now()
+	for i, rtt := range []time.Duration{40, 10, 30} {
+		sent := start.Add(time.Duration(i) * time.Second)
+		p.sent(sent)
+		p.received(sent.Add(rtt * time.Millisecond))
+	}
+	p.received(start) // unsolicited, ignored
+	p.sent(start.Add(time.Minute))
+
+	s := p.snapshot()
+	if s.Count != 3 || s.Last != 30*time.Millisecond || s.Min != 10*time.Millisecond ||
+		s.Max != 40*time.Millisecond || s.Mean != 80*time.Millisecond/3 || s.Outstanding != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	// 40ms, then 40 + (10-40)/8 = 36.25ms, then 36.25 + (30-36.25)/8.
+	if want := 35468750 * time.Nanosecond; s.Smoothed != want {
+		t.Errorf("Smoothed = %v; want %v", s.Smoothed, want)
+	}
+
+	if p.expired(start.Add(time.Minute+time.Second), 2*time.Second) {
+		t.Error("ping expired before the timeout")
+	}
+	if !p.expired(start.Add(time.Minute+3*time.Second), 2*time.Second) {
+		t.Error("ping did not expire after the timeout")
+	}
+	if s := p.snapshot(); s.Timeouts != 1 {
+		t.Errorf("Timeouts = %d; want 1", s.Timeouts)
+	}
+	p.reset()
+	if s := p.snapshot(); s.Outstanding != 0 {
+		t.Errorf("Outstanding = %d after reset; want 0", s.Outstanding)
+	}
+}
+
+func TestPingTimeoutClosesConnection(t *testing.T) {
+	t.Parallel()
+	client, server := net.Pipe()
+	defer server.Close()
+	// A server that reads pings but never answers them, like the far end
+	// of a half-open connection.
+	go io.Copy(ioutil.Discard, server)
+
+	c := &Conn{
+		conn:         client,
+		buf:          make([]byte, 64),
+		pingInterval: 10 * time.Millisecond,
+		pingTimeout:  50 * time.Millisecond,
+		recvTimeout:  time.Second,
+		sendChan:     make(chan *request),
+		closeChan:    make(chan struct{}),
+		logger:       DefaultLogger,
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.sendLoop() }()
+	select {
+	case err := <-done:
+		if err != errPingTimeout {
+			t.Errorf("sendLoop returned %v; want errPingTimeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sendLoop did not detect the unanswered pings")
+	}
+	if s := c.PingStats(); s.Timeouts != 1 || s.Outstanding == 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
@@ -0,0 +1,340 @@
+package zk
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProbeInterval = 10 * time.Second
+	defaultProbeTimeout  = time.Second
+)
+
+// ServerHealth is the result of probing a single server.
+type ServerHealth struct {
+	Server  string        // Resolved address/port of the server.
+	Host    string        // Address/port as given in the connection string.
+	Healthy bool          // Whether the server is serving requests.
+	RTT     time.Duration // Round trip time of the probe.
+	Mode    Mode          // Mode reported by the server.
+	Probed  time.Time     // When the probe completed, zero if never probed.
+	Err     error         // Error returned by the probe, if any.
+}
+
+// SelectionPolicy decides in which order healthy servers are tried.
+type SelectionPolicy interface {
+	// Order returns the servers to try, best first. It is given only the
+	// servers whose last probe succeeded.
+	Order(servers []ServerHealth) []string
+}
+
+// LatencyPolicy orders servers randomly, weighting each one by the inverse
+// of its measured RTT, so that close servers are preferred without all
+// clients piling onto the single fastest one.
+type LatencyPolicy struct{}
+
+// Order implements SelectionPolicy.
+func (LatencyPolicy) Order(servers []ServerHealth) []string {
+	weights := make([]float64, len(servers))
+	total := 0.0
+	for i, s := range servers {
+		rtt := s.RTT
+		if rtt < time.Millisecond {
+			rtt = time.Millisecond
+		}
+		weights[i] = 1 / rtt.Seconds()
+		total += weights[i]
+	}
+
+	order := make([]string, 0, len(servers))
+	picked := make([]bool, len(servers))
+	for len(order) < len(servers) {
+		r := rand.Float64() * total
+		chosen := -1
+		for i := range servers {
+			if picked[i] {
+				continue
+			}
+			chosen = i
+			if r < weights[i] {
+				break
+			}
+			r -= weights[i]
+		}
+		picked[chosen] = true
+		total -= weights[chosen]
+		order = append(order, servers[chosen].Server)
+	}
+	return order
+}
+
+// LocalityPolicy prefers servers in the same zone as the client, falling
+// back to the others. Servers within each group are ordered by Policy.
+type LocalityPolicy struct {
+	Zone   string                    // Zone of this client.
+	ZoneOf func(ServerHealth) string // Returns the zone label of a server.
+	Policy SelectionPolicy           // Orders servers within a zone. LatencyPolicy if nil.
+}
+
+// Order implements SelectionPolicy.
+func (p LocalityPolicy) Order(servers []ServerHealth) []string {
+	policy := p.Policy
+	if policy == nil {
+		policy = LatencyPolicy{}
+	}
+	var local, remote []ServerHealth
+	for _, s := range servers {
+		if p.ZoneOf != nil && p.ZoneOf(s) == p.Zone {
+			local = append(local, s)
+		} else {
+			remote = append(remote, s)
+		}
+	}
+	return append(policy.Order(local), policy.Order(remote)...)
+}
+
+// ProbingHostProvider is a HostProvider that periodically probes every
+// server with the "srvr" four letter word and hands out healthy servers in
+// the order chosen by its SelectionPolicy. Servers that fail their probe
+// (down, not serving requests or unreachable) are skipped as long as a
+// healthy server is left.
+//
+// The exported fields must be set before the provider is passed to Connect.
+// Probing stops when the connection is closed.
+type ProbingHostProvider struct {
+	Interval time.Duration                                           // Time between probes. 10s if zero.
+	Timeout  time.Duration                                           // Timeout of a single probe. 1s if zero.
+	Policy   SelectionPolicy                                         // LatencyPolicy if nil.
+	Probe    func(server string, timeout time.Duration) ServerHealth // Probes with "srvr" if nil.
+
+	mu      sync.Mutex
+	servers []string                // resolved addresses
+	hosts   map[string]string       // resolved address -> configured host
+	health  map[string]ServerHealth // resolved address -> last probe result
+	order   []string                // servers of the current rotation
+	pos     int                     // next index into order
+	started bool                    // a rotation was started since the last Connected
+	current string                  // last server passed to Connected
+	quit    chan struct{}
+	closed  bool
+
+	lookupHost func(string) ([]string, error) // Override of net.LookupHost, for testing.
+}
+
+var _ HostProvider = &ProbingHostProvider{}
+
+// Init resolves the servers and starts probing them in the background, so
+// that it doesn't wait for unreachable ones. Until the first probes complete
+// every server is tried, in random order.
+func (hp *ProbingHostProvider) Init(servers []string) error {
+	hosts := make(map[string]string)
+	var found []string
+	for _, server := range servers {
+		addrs, err := lookupServers([]string{server}, hp.lookupHost)
+		if err != nil {
+			return err
+		}
+		for _, addr := range addrs {
+			if _, ok := hosts[addr]; !ok {
+				hosts[addr] = server
+				found = append(found, addr)
+			}
+		}
+	}
+
+	hp.mu.Lock()
+	hp.servers = found
+	hp.hosts = hosts
+	hp.health = make(map[string]ServerHealth)
+	hp.quit = make(chan struct{})
+	hp.mu.Unlock()
+
+	go hp.probeLoop()
+	return nil
+}
+
+// Len returns the number of servers.
+func (hp *ProbingHostProvider) Len() int {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	return len(hp.servers)
+}
+
+// Servers returns the resolved addresses of the servers, healthy or not.
+func (hp *ProbingHostProvider) Servers() []string {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	return append([]string(nil), hp.servers...)
+}
+
+// Next returns the next server to connect to. retryStart is true for the
+// first server of a rotation when every server of the previous rotation was
+// handed out without Connected being called.
+func (hp *ProbingHostProvider) Next() (server string, retryStart bool) {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+
+	if hp.pos >= len(hp.order) {
+		// Rotations may differ in length as probe results change, so the
+		// previous one failed only if it was started after Connected.
+		retryStart = hp.started
+		hp.order = hp.rotation()
+		hp.pos = 0
+		hp.started = true
+	}
+	server = hp.order[hp.pos]
+	hp.pos++
+	return server, retryStart
+}
+
+// Connected notifies the HostProvider of a successful connection.
+func (hp *ProbingHostProvider) Connected() {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	hp.started = false
+	if hp.pos > 0 {
+		hp.current = hp.order[hp.pos-1]
+	}
+	// Start a fresh rotation with up to date probe results on reconnect.
+	hp.pos = len(hp.order)
+}
+
+// Health returns the latest probe result of every server.
+func (hp *ProbingHostProvider) Health() []ServerHealth {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	res := make([]ServerHealth, 0, len(hp.servers))
+	for _, s := range hp.servers {
+		res = append(res, hp.healthOf(s))
+	}
+	return res
+}
+
+// Close stops the background probing. It is called by Conn when the
+// connection is closed.
+func (hp *ProbingHostProvider) Close() error {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	if !hp.closed && hp.quit != nil {
+		close(hp.quit)
+		hp.closed = true
+	}
+	return nil
+}
+
+// rotation returns the servers to try in the next rotation. The server we
+// were last connected to goes last, as a reconnect usually means it failed.
+// It must be called with hp.mu held.
+func (hp *ProbingHostProvider) rotation() []string {
+	var healthy []ServerHealth
+	for _, s := range hp.servers {
+		if h := hp.healthOf(s); h.Healthy {
+			healthy = append(healthy, h)
+		}
+	}
+
+	var order []string
+	if len(healthy) > 0 {
+		policy := hp.Policy
+		if policy == nil {
+			policy = LatencyPolicy{}
+		}
+		order = policy.Order(healthy)
+	}
+	if len(order) == 0 {
+		// Nothing is known to be healthy; try everything.
+		order = append([]string(nil), hp.servers...)
+		stringShuffle(order)
+	}
+
+	if len(order) > 1 {
+		for i, s := range order {
+			if s == hp.current {
+				order = append(append(order[:i:i], order[i+1:]...), s)
+				break
+			}
+		}
+	}
+	return order
+}
+
+// healthOf must be called with hp.mu held.
+func (hp *ProbingHostProvider) healthOf(server string) ServerHealth {
+	if h, ok := hp.health[server]; ok {
+		return h
+	}
+	return ServerHealth{Server: server, Host: hp.hosts[server]}
+}
+
+func (hp *ProbingHostProvider) probeLoop() {
+	interval := hp.Interval
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	hp.probeAll()
+	for {
+		select {
+		case <-hp.quit:
+			return
+		case <-ticker.C:
+			hp.probeAll()
+		}
+	}
+}
+
+// probeAll probes every server concurrently and records the results.
+func (hp *ProbingHostProvider) probeAll() {
+	probe := hp.Probe
+	if probe == nil {
+		probe = probeServer
+	}
+	timeout := hp.Timeout
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+
+	hp.mu.Lock()
+	servers := append([]string(nil), hp.servers...)
+	hp.mu.Unlock()
+
+	results := make([]ServerHealth, len(servers))
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		wg.Add(1)
+		go func(i int, s string) {
+			defer wg.Done()
+			results[i] = probe(s, timeout)
+		}(i, s)
+	}
+	wg.Wait()
+
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+	for i, s := range servers {
+		h := results[i]
+		h.Server = s
+		h.Host = hp.hosts[s]
+		if h.Probed.IsZero() {
+			h.Probed = time.Now()
+		}
+		hp.health[s] = h
+	}
+}
+
+// probeServer runs "srvr" against server. The server is healthy if it
+// answers with a parsable status, which it only does while it is part of a
+// quorum.
+func probeServer(server string, timeout time.Duration) ServerHealth {
+	start := time.Now()
+	stats, ok := FLWSrvr([]string{server}, timeout)
+	h := ServerHealth{Server: server, RTT: time.Since(start), Probed: time.Now()}
+	if len(stats) > 0 {
+		h.Mode = stats[0].Mode
+		h.Err = stats[0].Error
+	}
+	h.Healthy = ok && h.Mode != ModeUnknown
+	return h
+}
@@ -0,0 +1,209 @@
+package zk
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestProbingHostProvider(t *testing.T, health map[string]ServerHealth) *ProbingHostProvider {
+	hp := &ProbingHostProvider{
+		Interval: time.Hour,
+		Probe: func(server string, timeout time.Duration) ServerHealth {
+			return health[server]
+		},
+		lookupHost: func(host string) ([]string, error) {
+			return []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}, nil
+		},
+	}
+	if err := hp.Init([]string{"foo.example.com:2181"}); err != nil {
+		t.Fatal(err)
+	}
+	waitProbed(t, hp)
+	return hp
+}
+
+// waitProbed waits for the first probes started by Init.
+func waitProbed(t *testing.T, hp *ProbingHostProvider) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		probed := true
+		for _, h := range hp.Health() {
+			probed = probed && !h.Probed.IsZero()
+		}
+		if probed {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("servers not probed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestProbingHostProviderInitDoesNotWait(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	hp := &ProbingHostProvider{
+		Interval: time.Hour,
+		Probe: func(server string, timeout time.Duration) ServerHealth {
+			<-release
+			return ServerHealth{Healthy: server == "192.0.2.2:2181"}
+		},
+		lookupHost: func(host string) ([]string, error) {
+			return []string{"192.0.2.1", "192.0.2.2"}, nil
+		},
+	}
+	defer hp.Close()
+	if err := hp.Init([]string{"foo.example.com:2181"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every server is tried until the probes complete.
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		server, _ := hp.Next()
+		seen[server] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("servers tried before probing = %v; want both", seen)
+	}
+
+	close(release)
+	waitProbed(t, hp)
+	for i := 0; i < 4; i++ {
+		if server, _ := hp.Next(); server != "192.0.2.2:2181" {
+			t.Errorf("Next() = %s; want the healthy server", server)
+		}
+	}
+}
+
+func TestProbingHostProviderSkipsUnhealthy(t *testing.T) {
+	t.Parallel()
+	hp := newTestProbingHostProvider(t, map[string]ServerHealth{
+		"192.0.2.1:2181": {Healthy: true, RTT: time.Millisecond},
+		"192.0.2.2:2181": {Healthy: false},
+		"192.0.2.3:2181": {Healthy: true, RTT: time.Millisecond},
+	})
+	defer hp.Close()
+
+	if hp.Len() != 3 {
+		t.Fatalf("Len() = %d; want 3", hp.Len())
+	}
+	for i := 0; i < 10; i++ {
+		server, retryStart := hp.Next()
+		if server == "192.0.2.2:2181" {
+			t.Fatalf("unhealthy server %s was returned", server)
+		}
+		if want := i > 0 && i%2 == 0; retryStart != want {
+			t.Errorf("%d: retryStart = %v; want %v", i, retryStart, want)
+		}
+	}
+}
+
+func TestProbingHostProviderRotationLengthChanges(t *testing.T) {
+	t.Parallel()
+	health := map[string]ServerHealth{
+		"192.0.2.1:2181": {Healthy: true, RTT: time.Millisecond},
+		"192.0.2.2:2181": {Healthy: true, RTT: time.Millisecond},
+		"192.0.2.3:2181": {Healthy: true, RTT: time.Millisecond},
+	}
+	hp := newTestProbingHostProvider(t, health)
+	defer hp.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, retryStart := hp.Next(); retryStart {
+			t.Fatalf("%d: retryStart set during the first rotation", i)
+		}
+	}
+	// The next rotation only has two servers.
+	health["192.0.2.2:2181"] = ServerHealth{Healthy: false}
+	hp.probeAll()
+	for i, want := range []bool{true, false, true, false} {
+		if server, retryStart := hp.Next(); retryStart != want {
+			t.Errorf("%d: retryStart = %v for %s; want %v", i, retryStart, server, want)
+		}
+	}
+
+	// Connected starts over without signalling a failed rotation.
+	hp.Connected()
+	for i, want := range []bool{false, false, true} {
+		if _, retryStart := hp.Next(); retryStart != want {
+			t.Errorf("after Connected %d: retryStart = %v; want %v", i, retryStart, want)
+		}
+	}
+}
+
+func TestProbingHostProviderAllUnhealthy(t *testing.T) {
+	t.Parallel()
+	hp := newTestProbingHostProvider(t, nil)
+	defer hp.Close()
+
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		server, _ := hp.Next()
+		seen[server] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("all servers should be tried when none is healthy, got %v", seen)
+	}
+}
+
+func TestProbingHostProviderLocality(t *testing.T) {
+	t.Parallel()
+	hp := newTestProbingHostProvider(t, map[string]ServerHealth{
+		"192.0.2.1:2181": {Healthy: true, RTT: time.Millisecond},
+		"192.0.2.2:2181": {Healthy: true, RTT: 50 * time.Millisecond},
+		"192.0.2.3:2181": {Healthy: true, RTT: time.Millisecond},
+	})
+	defer hp.Close()
+	hp.Policy = LocalityPolicy{
+		Zone: "b",
+		ZoneOf: func(h ServerHealth) string {
+			if strings.HasPrefix(h.Server, "192.0.2.2:") {
+				return "b"
+			}
+			return "a"
+		},
+	}
+
+	for rotation := 0; rotation < 3; rotation++ {
+		if server, _ := hp.Next(); server != "192.0.2.2:2181" {
+			t.Fatalf("Next() = %s; want the same-zone server first", server)
+		}
+		for i := 0; i < 2; i++ {
+			if server, _ := hp.Next(); server == "192.0.2.2:2181" {
+				t.Fatal("remote servers should follow the local one")
+			}
+		}
+	}
+
+	// After a reconnect the server we were connected to is tried last.
+	hp.Next()
+	hp.Connected()
+	if server, _ := hp.Next(); server == "192.0.2.2:2181" {
+		t.Fatal("the previously connected server should be tried last")
+	}
+}
+
+func TestLatencyPolicy(t *testing.T) {
+	t.Parallel()
+	servers := []ServerHealth{
+		{Server: "near", RTT: time.Millisecond},
+		{Server: "far", RTT: time.Second},
+	}
+	near := 0
+	for i := 0; i < 100; i++ {
+		order := LatencyPolicy{}.Order(servers)
+		if len(order) != 2 {
+			t.Fatalf("Order returned %v", order)
+		}
+		if order[0] == "near" {
+			near++
+		}
+	}
+	if near < 90 {
+		t.Errorf("near server was first only %d times out of 100", near)
+	}
+}
@@ -0,0 +1,201 @@
+package zk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// deleteRecursiveAttempts bounds how often DeleteRecursive rescans the tree
+// after nodes were added or removed concurrently.
+const deleteRecursiveAttempts = 5
+
+// multiOverhead is a generous estimate of the bytes a multi request needs
+// besides its operations: packet length, request header and done header.
+const multiOverhead = 64
+
+// DeleteOptions modifies the behaviour of DeleteRecursive.
+type DeleteOptions struct {
+	// DryRun makes DeleteRecursive list the nodes it would delete without
+	// deleting them.
+	DryRun bool
+	// Versions maps paths of the tree to the version they must have. Every
+	// batch checks the versions of the guarded nodes it has not deleted yet,
+	// and fails with ErrBadVersion if one of them changed.
+	Versions map[string]int32
+}
+
+// CreateAll creates path along with its missing parents, like mkdir -p. The
+// parents are persistent nodes without data and with the given acl, and may
+// be created concurrently by other clients. flags and data only apply to
+// path itself, and ErrNodeExists is returned if path already exists.
+func (c *Conn) CreateAll(path string, data []byte, flags int32, acl []ACL) (string, error) {
+	return createAll(c, path, data, flags, acl)
+}
+
+// DeleteRecursive deletes path and all of its descendants, and returns the
+// deleted paths, children before their parents. The nodes are deleted in
+// Multi batches that fit the buffer size, so a failure may leave part of the
+// tree deleted. Nodes created or deleted concurrently are handled by
+// rescanning the remaining tree. Deleting "/" deletes everything below it,
+// except for the /zookeeper system tree when there is no chroot. opts may be
+// nil.
+func (c *Conn) DeleteRecursive(path string, opts *DeleteOptions) ([]string, error) {
+	return deleteRecursive(c, c.bufferSize, c.chroot, path, opts)
+}
+
+func createAll(c Client, path string, data []byte, flags int32, acl []ACL) (string, error) {
+	for i := 0; ; i++ {
+		created, err := c.Create(path, data, flags, acl)
+		if !errors.Is(err, ErrNoNode) || i == 2 {
+			return created, err
+		}
+		// A parent is missing, or was deleted again right after creating it.
+		if err := createParents(c, path, acl); err != nil {
+			return "", err
+		}
+	}
+}
+
+// createParents creates the missing ancestors of path.
+func createParents(c Client, path string, acl []ACL) error {
+	parent := path[:strings.LastIndex(path, "/")]
+	if parent == "" {
+		return nil
+	}
+	_, err := c.Create(parent, []byte{}, 0, acl)
+	if errors.Is(err, ErrNoNode) {
+		if err := createParents(c, parent, acl); err != nil {
+			return err
+		}
+		_, err = c.Create(parent, []byte{}, 0, acl)
+	}
+	if err != nil && !errors.Is(err, ErrNodeExists) {
+		return err
+	}
+	return nil
+}
+
+// deleteRecursive deletes the tree at path through c, which prefixes every
+// path with chroot.
+func deleteRecursive(c Client, bufferSize int, chroot string, path string, opts *DeleteOptions) ([]string, error) {
+	if opts == nil {
+		opts = &DeleteOptions{}
+	}
+	var deleted []string
+	var err error
+	for i := 0; i < deleteRecursiveAttempts; i++ {
+		var nodes []string
+		if path == "/" {
+			nodes, err = rootSubtree(c, chroot)
+		} else {
+			nodes, err = subtree(c, path, nil)
+		}
+		if err != nil {
+			return deleted, err
+		}
+		if opts.DryRun {
+			return nodes, nil
+		}
+		var n int
+		n, err = deleteBatches(c, bufferSize, chroot, nodes, opts.Versions)
+		deleted = append(deleted, nodes[:n]...)
+		if !errors.Is(err, ErrNotEmpty) && !errors.Is(err, ErrNoNode) {
+			return deleted, err
+		}
+		// A node was created or deleted since the tree was listed.
+	}
+	return deleted, err
+}
+
+// rootSubtree lists the descendants of "/", children before their parents.
+// The /zookeeper system tree of the server can't be deleted and is skipped
+// when there is no chroot.
+func rootSubtree(c Client, chroot string) ([]string, error) {
+	children, _, err := c.Children("/")
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, child := range children {
+		if chroot == "" && child == "zookeeper" {
+			continue
+		}
+		nodes, err = subtree(c, joinPath("/", child), nodes)
+		if err != nil && !errors.Is(err, ErrNoNode) {
+			return nodes, err
+		}
+	}
+	return nodes, nil
+}
+
+// subtree appends path and its descendants to nodes, children before their
+// parents. Descendants deleted while listing are skipped.
+func subtree(c Client, path string, nodes []string) ([]string, error) {
+	children, _, err := c.Children(path)
+	if err != nil {
+		return nodes, err
+	}
+	for _, child := range children {
+		nodes, err = subtree(c, joinPath(path, child), nodes)
+		if err != nil && !errors.Is(err, ErrNoNode) {
+			return nodes, err
+		}
+	}
+	return append(nodes, path), nil
+}
+
+// deleteBatches deletes nodes, in order, with Multi requests smaller than
+// bufferSize, guard checks and the chroot prefix of every path included. It
+// returns how many nodes were deleted.
+func deleteBatches(c Client, bufferSize int, chroot string, nodes []string, versions map[string]int32) (int, error) {
+	guards := make(map[string]int) // guarded path -> index in nodes
+	for i, node := range nodes {
+		if _, ok := versions[node]; ok {
+			guards[node] = i
+		}
+	}
+
+	done := 0
+	for done < len(nodes) {
+		var ops []interface{}
+		size := multiOverhead
+		for node, i := range guards {
+			if i >= done {
+				ops = append(ops, &CheckVersionRequest{Path: node, Version: versions[node]})
+				size += multiOpSize(chroot + node)
+			}
+		}
+		end := done
+		for end < len(nodes) && size+multiOpSize(chroot+nodes[end]) <= bufferSize {
+			version := int32(-1)
+			if v, ok := versions[nodes[end]]; ok {
+				version = v
+			}
+			ops = append(ops, &DeleteRequest{Path: nodes[end], Version: version})
+			size += multiOpSize(chroot + nodes[end])
+			end++
+		}
+		if end == done {
+			return done, fmt.Errorf("zk: deleting %q with %d version checks exceeds the buffer size: %w", nodes[done], len(ops), ErrBadArguments)
+		}
+		if _, err := c.Multi(ops...); err != nil {
+			return done, err
+		}
+		done = end
+	}
+	return done, nil
+}
+
+// multiOpSize is the encoded size of a delete or check operation in a multi
+// request: header, path and version.
+func multiOpSize(path string) int {
+	return 9 + 4 + len(path) + 4
+}
+
+func joinPath(parent, child string) string {
+	if parent == "/" {
+		return "/" + child
+	}
+	return parent + "/" + child
+}
@@ -0,0 +1,229 @@
+package zk
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// multiHookClient runs hook before forwarding the first Multi call.
+type multiHookClient struct {
+	Client
+	hook func()
+}
+
+func (c *multiHookClient) Multi(ops ...interface{}) ([]MultiResponse, error) {
+	if c.hook != nil {
+		c.hook()
+		c.hook = nil
+	}
+	return c.Client.Multi(ops...)
+}
+
+// multiRecordClient records the operations of every Multi call.
+type multiRecordClient struct {
+	Client
+	batches [][]interface{}
+}
+
+func (c *multiRecordClient) Multi(ops ...interface{}) ([]MultiResponse, error) {
+	c.batches = append(c.batches, ops)
+	return c.Client.Multi(ops...)
+}
+
+// createHookClient runs hook before forwarding the first Create of path.
+type createHookClient struct {
+	Client
+	path string
+	hook func()
+}
+
+func (c *createHookClient) Create(path string, data []byte, flags int32, acl []ACL) (string, error) {
+	if path == c.path && c.hook != nil {
+		c.hook()
+		c.hook = nil
+	}
+	return c.Client.Create(path, data, flags, acl)
+}
+
+func fakeTree(t *testing.T, paths ...string) *FakeClient {
+	t.Helper()
+	f := NewFakeClient()
+	for _, p := range paths {
+		if _, err := f.Create(p, nil, 0, WorldACL(PermAll)); err != nil {
+			t.Fatalf("Create(%q) returned error: %+v", p, err)
+		}
+	}
+	return f
+}
+
+func TestCreateAll(t *testing.T) {
+	t.Parallel()
+	f := fakeTree(t, "/a")
+	if p, err := createAll(f, "/a/b/c/d", []byte("data"), 0, WorldACL(PermAll)); err != nil || p != "/a/b/c/d" {
+		t.Fatalf("createAll returned (%q, %v); want /a/b/c/d", p, err)
+	}
+	data, _, err := f.Get("/a/b/c/d")
+	if err != nil || string(data) != "data" {
+		t.Errorf("Get returned (%q, %v); want data", data, err)
+	}
+	if data, _, _ := f.Get("/a/b"); len(data) != 0 {
+		t.Errorf("parent has data %q; want none", data)
+	}
+	if _, err := createAll(f, "/a/b/c/d", nil, 0, WorldACL(PermAll)); !errors.Is(err, ErrNodeExists) {
+		t.Errorf("createAll of an existing node returned %v; want ErrNodeExists", err)
+	}
+	p, err := createAll(f, "/x/y/", nil, FlagSequence, WorldACL(PermAll))
+	if err != nil || p != "/x/y/0000000000" {
+		t.Errorf("sequential createAll returned (%q, %v); want /x/y/0000000000", p, err)
+	}
+}
+
+func TestCreateAllParentCreatedConcurrently(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+	// Another client creates /a between our failed create of /a/b and our
+	// creation of /a.
+	c := &createHookClient{Client: f, path: "/a", hook: func() {
+		f.Create("/a", nil, 0, WorldACL(PermAll))
+	}}
+	if _, err := createAll(c, "/a/b", nil, 0, WorldACL(PermAll)); err != nil {
+		t.Errorf("createAll returned error: %+v", err)
+	}
+	if ok, _, _ := f.Exists("/a/b"); !ok {
+		t.Error("/a/b was not created")
+	}
+}
+
+func TestDeleteRecursive(t *testing.T) {
+	t.Parallel()
+	f := fakeTree(t, "/a", "/a/b", "/a/b/c", "/a/d", "/e", "/zookeeper", "/zookeeper/quota")
+
+	nodes, err := deleteRecursive(f, 1<<20, "", "/a", &DeleteOptions{DryRun: true})
+	want := []string{"/a/b/c", "/a/b", "/a/d", "/a"}
+	if err != nil || !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("dry run returned (%v, %v); want %v", nodes, err, want)
+	}
+	if ok, _, _ := f.Exists("/a/b/c"); !ok {
+		t.Fatal("dry run deleted nodes")
+	}
+
+	// Room for two deletes per batch.
+	f.ResetCalls()
+	nodes, err = deleteRecursive(f, multiOverhead+2*multiOpSize("/a/b/c"), "", "/a", nil)
+	if err != nil || !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("deleteRecursive returned (%v, %v); want %v", nodes, err, want)
+	}
+	multis := 0
+	for _, call := range f.Calls() {
+		if call.Method == "Multi" {
+			multis++
+		}
+	}
+	if multis != 2 {
+		t.Errorf("deleteRecursive sent %d Multi requests; want 2", multis)
+	}
+	children, _, _ := f.Children("/")
+	if !reflect.DeepEqual(children, []string{"e", "zookeeper"}) {
+		t.Errorf("children of / = %v; want [e zookeeper]", children)
+	}
+
+	if _, err := deleteRecursive(f, 1<<20, "", "/a", nil); !errors.Is(err, ErrNoNode) {
+		t.Errorf("deleteRecursive of a missing node returned %v; want ErrNoNode", err)
+	}
+	if _, err := deleteRecursive(f, 1<<20, "", "/", nil); err != nil {
+		t.Fatalf("deleteRecursive of / returned error: %+v", err)
+	}
+	if children, _, _ := f.Children("/"); !reflect.DeepEqual(children, []string{"zookeeper"}) {
+		t.Errorf("children of / = %v; want [zookeeper]", children)
+	}
+
+	// Below a chroot, /zookeeper is an ordinary node.
+	if nodes, err := deleteRecursive(f, 1<<20, "/app", "/", nil); err != nil || len(nodes) != 2 {
+		t.Errorf("deleteRecursive of / with a chroot returned (%v, %v)", nodes, err)
+	}
+}
+
+func TestDeleteRecursiveBatchSize(t *testing.T) {
+	t.Parallel()
+	f := fakeTree(t, "/a", "/a/b", "/a/c")
+
+	// The chroot prefix counts against the buffer size: room for two deletes
+	// without it is room for one with it.
+	rec := &multiRecordClient{Client: f}
+	if _, err := deleteRecursive(rec, multiOverhead+2*multiOpSize("/a/b"), "/chroot", "/a", nil); err != nil {
+		t.Fatalf("deleteRecursive returned error: %+v", err)
+	}
+	if len(rec.batches) != 3 {
+		t.Errorf("deleteRecursive sent %d Multi requests; want 3", len(rec.batches))
+	}
+
+	// Guard checks count as well, and a batch that can't fit a single delete
+	// besides them fails without sending anything.
+	f = fakeTree(t, "/a", "/a/b", "/a/c")
+	rec = &multiRecordClient{Client: f}
+	opts := &DeleteOptions{Versions: map[string]int32{"/a": 0, "/a/b": 0, "/a/c": 0}}
+	_, err := deleteRecursive(rec, multiOverhead+3*multiOpSize("/a/b"), "", "/a", opts)
+	if !errors.Is(err, ErrBadArguments) || len(rec.batches) != 0 {
+		t.Errorf("deleteRecursive returned %v after %d Multi requests; want ErrBadArguments and none", err, len(rec.batches))
+	}
+	if _, err := deleteRecursive(rec, multiOverhead+4*multiOpSize("/a/b"), "", "/a", opts); err != nil {
+		t.Errorf("deleteRecursive returned error: %+v", err)
+	}
+	for _, ops := range rec.batches {
+		size := multiOverhead
+		for _, op := range ops {
+			switch op := op.(type) {
+			case *CheckVersionRequest:
+				size += multiOpSize(op.Path)
+			case *DeleteRequest:
+				size += multiOpSize(op.Path)
+			}
+		}
+		if size > multiOverhead+4*multiOpSize("/a/b") {
+			t.Errorf("batch %v exceeds the buffer size", ops)
+		}
+	}
+}
+
+func TestDeleteRecursiveConcurrentChanges(t *testing.T) {
+	t.Parallel()
+	f := fakeTree(t, "/a", "/a/b", "/a/c")
+	c := &multiHookClient{Client: f, hook: func() {
+		f.Create("/a/b/new", nil, 0, WorldACL(PermAll))
+		f.Delete("/a/c", -1)
+	}}
+	nodes, err := deleteRecursive(c, 1<<20, "", "/a", nil)
+	if err != nil {
+		t.Fatalf("deleteRecursive returned error: %+v", err)
+	}
+	if want := []string{"/a/b/new", "/a/b", "/a"}; !reflect.DeepEqual(nodes, want) {
+		t.Errorf("deleted %v; want %v", nodes, want)
+	}
+	if ok, _, _ := f.Exists("/a"); ok {
+		t.Error("/a still exists")
+	}
+}
+
+func TestDeleteRecursiveVersions(t *testing.T) {
+	t.Parallel()
+	f := fakeTree(t, "/a", "/a/b", "/a/c")
+	if _, err := f.Set("/a", []byte("changed"), -1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The guard on /a is checked by the first batch already.
+	opts := &DeleteOptions{Versions: map[string]int32{"/a": 0}}
+	nodes, err := deleteRecursive(f, multiOverhead+2*multiOpSize("/a/b"), "", "/a", opts)
+	if !errors.Is(err, ErrBadVersion) || len(nodes) != 0 {
+		t.Fatalf("deleteRecursive returned (%v, %v); want ErrBadVersion and nothing deleted", nodes, err)
+	}
+	if ok, _, _ := f.Exists("/a/b"); !ok {
+		t.Error("/a/b was deleted despite the version guard")
+	}
+
+	opts.Versions["/a"] = 1
+	if _, err := deleteRecursive(f, multiOverhead+2*multiOpSize("/a/b"), "", "/a", opts); err != nil {
+		t.Errorf("deleteRecursive returned error: %+v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package zk
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// RetryPolicy decides whether an operation that failed with a retryable
+// error is tried again.
+type RetryPolicy interface {
+	// Retry is called after attempt number attempt (starting at 1) failed
+	// with err. It returns how long to wait before the next attempt, or false
+	// to give up and return err.
+	Retry(attempt int, err error) (delay time.Duration, ok bool)
+}
+
+// RetryNTimes retries an operation up to N times, waiting Delay between
+// attempts.
+type RetryNTimes struct {
+	N     int
+	Delay time.Duration
+}
+
+// Retry implements RetryPolicy.
+func (r RetryNTimes) Retry(attempt int, err error) (time.Duration, bool) {
+	return r.Delay, attempt <= r.N
+}
+
+// ExponentialBackoffRetry retries an operation up to MaxRetries times with
+// an exponentially growing, optionally jittered, delay.
+type ExponentialBackoffRetry struct {
+	BaseDelay  time.Duration // Delay before the first retry. 1s if zero.
+	MaxDelay   time.Duration // Upper bound of the delay. Unbounded if zero.
+	MaxRetries int           // Number of retries before giving up.
+	Jitter     float64       // Fraction of each delay that is randomized, in [0, 1].
+}
+
+// Retry implements RetryPolicy.
+func (r ExponentialBackoffRetry) Retry(attempt int, err error) (time.Duration, bool) {
+	if attempt > r.MaxRetries {
+		return 0, false
+	}
+	b := ExponentialBackoff{BaseDelay: r.BaseDelay, MaxDelay: r.MaxDelay, Jitter: r.Jitter}
+	return b.Delay(BackoffState{Rotations: attempt, RetryStart: true})
+}
+
+// RetryClient wraps a Client and retries operations that failed with a
+// retryable error (see IsRetryable), as long as doing so is safe:
+//
+//   - reads (Get, Exists, Children, GetACL, Sync and their watching variants)
+//     are always retried;
+//   - Set, SetACL and Delete are retried only with an explicit version, so
+//     that a retry can never apply a second, unintended change. A retry of an
+//     operation that went through before the connection was lost fails with
+//     ErrBadVersion or ErrNoNode;
+//   - non-sequential ephemeral creates are retried, and an ErrNodeExists
+//     caused by an earlier attempt is recognized by the owner of the node;
+//   - with ProtectSequential, sequential creates use a protected name (see
+//     CreateProtectedEphemeralSequential), so the created node is found again
+//     instead of being created twice;
+//   - other creates are retried only as long as no attempt may have been
+//     applied, that is after ErrNoServer or ErrSessionMoved. After
+//     ErrConnectionClosed or ErrOperationTimeout, nothing would tell a node
+//     created by an earlier attempt from one created by another client.
+//
+// Multi, AddAuth, CreateContainer and CreateTTL are never retried.
+type RetryClient struct {
+	Client
+	policy RetryPolicy
+
+	// ProtectSequential makes sequential creates retryable by prefixing the
+	// name of the node with "_c_" and a GUID, as
+	// CreateProtectedEphemeralSequential does. Callers that sort or parse
+	// the names of the children must allow for the prefix.
+	ProtectSequential bool
+
+	closeOnce sync.Once
+	closed    chan struct{} // closed by Close, to stop waiting for a retry
+}
+
+// NewRetryClient returns a RetryClient retrying operations on c according to
+// policy.
+func NewRetryClient(c Client, policy RetryPolicy) *RetryClient {
+	return &RetryClient{Client: c, policy: policy, closed: make(chan struct{})}
+}
+
+// Close stops pending retries, which fail with ErrClosing, and closes the
+// wrapped Client.
+func (r *RetryClient) Close() {
+	r.closeOnce.Do(func() {
+		if r.closed != nil {
+			close(r.closed)
+		}
+	})
+	r.Client.Close()
+}
+
+// do runs op until it succeeds, fails with an error that is not retryable,
+// or the policy gives up.
+func (r *RetryClient) do(op func() error) error {
+	return r.doIf(IsRetryable, op)
+}
+
+// doIf is like do, with retryable telling which errors are retried.
+func (r *RetryClient) doIf(retryable func(error) bool, op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if !retryable(err) {
+			return err
+		}
+		delay, ok := r.policy.Retry(attempt, err)
+		if !ok {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.closed:
+			timer.Stop()
+			return ErrClosing
+		}
+	}
+}
+
+// mayHaveApplied reports whether an operation that failed with err may have
+// been applied by the server.
+func mayHaveApplied(err error) bool {
+	return errors.Is(err, ErrConnectionClosed) || errors.Is(err, ErrOperationTimeout)
+}
+
+// isRetryableUnapplied reports whether err is retryable and the operation
+// was certainly not applied.
+func isRetryableUnapplied(err error) bool {
+	return IsRetryable(err) && !mayHaveApplied(err)
+}
+
+func (r *RetryClient) Children(path string) (children []string, stat *Stat, err error) {
+	err = r.do(func() error {
+		children, stat, err = r.Client.Children(path)
+		return err
+	})
+	return children, stat, err
+}
+
+func (r *RetryClient) ChildrenW(path string) (children []string, stat *Stat, ch <-chan Event, err error) {
+	err = r.do(func() error {
+		children, stat, ch, err = r.Client.ChildrenW(path)
+		return err
+	})
+	return children, stat, ch, err
+}
+
+func (r *RetryClient) Get(path string) (data []byte, stat *Stat, err error) {
+	err = r.do(func() error {
+		data, stat, err = r.Client.Get(path)
+		return err
+	})
+	return data, stat, err
+}
+
+func (r *RetryClient) GetW(path string) (data []byte, stat *Stat, ch <-chan Event, err error) {
+	err = r.do(func() error {
+		data, stat, ch, err = r.Client.GetW(path)
+		return err
+	})
+	return data, stat, ch, err
+}
+
+func (r *RetryClient) Exists(path string) (exists bool, stat *Stat, err error) {
+	err = r.do(func() error {
+		exists, stat, err = r.Client.Exists(path)
+		return err
+	})
+	return exists, stat, err
+}
+
+func (r *RetryClient) ExistsW(path string) (exists bool, stat *Stat, ch <-chan Event, err error) {
+	err = r.do(func() error {
+		exists, stat, ch, err = r.Client.ExistsW(path)
+		return err
+	})
+	return exists, stat, ch, err
+}
+
+func (r *RetryClient) GetACL(path string) (acl []ACL, stat *Stat, err error) {
+	err = r.do(func() error {
+		acl, stat, err = r.Client.GetACL(path)
+		return err
+	})
+	return acl, stat, err
+}
+
+func (r *RetryClient) Sync(path string) (p string, err error) {
+	err = r.do(func() error {
+		p, err = r.Client.Sync(path)
+		return err
+	})
+	return p, err
+}
+
+func (r *RetryClient) Set(path string, data []byte, version int32) (stat *Stat, err error) {
+	if version == -1 {
+		return r.Client.Set(path, data, version)
+	}
+	err = r.do(func() error {
+		stat, err = r.Client.Set(path, data, version)
+		return err
+	})
+	return stat, err
+}
+
+func (r *RetryClient) SetACL(path string, acl []ACL, version int32) (stat *Stat, err error) {
+	if version == -1 {
+		return r.Client.SetACL(path, acl, version)
+	}
+	err = r.do(func() error {
+		stat, err = r.Client.SetACL(path, acl, version)
+		return err
+	})
+	return stat, err
+}
+
+func (r *RetryClient) Delete(path string, version int32) error {
+	if version == -1 {
+		return r.Client.Delete(path, version)
+	}
+	return r.do(func() error {
+		return r.Client.Delete(path, version)
+	})
+}
+
+func (r *RetryClient) Create(path string, data []byte, flags int32, acl []ACL) (string, error) {
+	p, _, err := r.create(path, data, flags, acl, false)
+	return p, err
+}
+
+func (r *RetryClient) Create2(path string, data []byte, flags int32, acl []ACL) (string, *Stat, error) {
+	return r.create(path, data, flags, acl, true)
+}
+
+func (r *RetryClient) create(path string, data []byte, flags int32, acl []ACL, withStat bool) (string, *Stat, error) {
+	create := func(path string) (string, *Stat, error) {
+		if withStat {
+			return r.Client.Create2(path, data, flags, acl)
+		}
+		p, err := r.Client.Create(path, data, flags, acl)
+		return p, nil, err
+	}
+	stat := func(path string) (*Stat, error) {
+		if !withStat {
+			return nil, nil
+		}
+		_, st, err := r.Client.Exists(path)
+		return st, err
+	}
+
+	var newPath string
+	var newStat *Stat
+	maybeCreated := false
+
+	if flags&FlagSequence == 0 || !r.ProtectSequential {
+		// Only ephemeral nodes can be recognized as created by an earlier
+		// attempt, through their owner.
+		retryable := IsRetryable
+		if flags&FlagSequence != 0 || flags&FlagEphemeral == 0 {
+			retryable = isRetryableUnapplied
+		}
+		err := r.doIf(retryable, func() error {
+			p, st, err := create(path)
+			if errors.Is(err, ErrNodeExists) && maybeCreated {
+				// An earlier attempt may have created the node before
+				// the connection was lost.
+				exists, st, serr := r.Client.Exists(path)
+				if serr != nil {
+					return serr
+				}
+				if exists && st.EphemeralOwner == r.SessionID() {
+					if a, ok := r.Client.(ephemeralAdopter); ok {
+						a.adoptEphemeral(path)
+					}
+					newPath, newStat = path, st
+					return nil
+				}
+			}
+			if mayHaveApplied(err) {
+				maybeCreated = true
+			}
+			newPath, newStat = p, st
+			return err
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		return newPath, newStat, nil
+	}
+
+	protectedPath, rootPath, guid, err := protectedName(path)
+	if err != nil {
+		return "", nil, err
+	}
+	err = r.do(func() error {
+		if maybeCreated {
+			found, err := findProtected(r.Client, rootPath, guid)
+			if err != nil {
+				return err
+			}
+			if found != "" {
+				if a, ok := r.Client.(ephemeralAdopter); ok && flags&FlagEphemeral != 0 {
+					a.adoptEphemeral(found)
+				}
+				st, err := stat(found)
+				newPath, newStat = found, st
+				return err
+			}
+		}
+		p, st, err := create(protectedPath)
+		if IsRetryable(err) {
+			maybeCreated = true
+		}
+		newPath, newStat = p, st
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return newPath, newStat, nil
+}
+
+var _ Client = &RetryClient{}
@@ -0,0 +1,158 @@
+package zk
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryClientRetriesReads(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+	r := NewRetryClient(f, RetryNTimes{N: 2})
+
+	f.InjectError("Get", "/", ErrConnectionClosed)
+	f.InjectError("Get", "/", ErrNoServer)
+	if _, _, err := r.Get("/"); err != nil {
+		t.Fatalf("Get returned error: %+v", err)
+	}
+	if n := len(f.Calls()); n != 3 {
+		t.Errorf("Get was attempted %d times; want 3", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		f.InjectError("Children", "/", ErrConnectionClosed)
+	}
+	if _, _, err := r.Children("/"); err != ErrConnectionClosed {
+		t.Errorf("Children returned %v after exhausting retries; want ErrConnectionClosed", err)
+	}
+
+	f.InjectError("Exists", "/", ErrSessionExpired)
+	if _, _, err := r.Exists("/"); err != ErrSessionExpired {
+		t.Errorf("Exists returned %v; want ErrSessionExpired without retry", err)
+	}
+}
+
+func TestRetryClientVersionedWrites(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+	r := NewRetryClient(f, RetryNTimes{N: 2})
+	if _, err := f.Create("/node", nil, 0, WorldACL(PermAll)); err != nil {
+		t.Fatal(err)
+	}
+
+	f.InjectError("Set", "/node", ErrConnectionClosed)
+	if _, err := r.Set("/node", []byte("a"), -1); err != ErrConnectionClosed {
+		t.Errorf("unversioned Set returned %v; want ErrConnectionClosed without retry", err)
+	}
+	f.InjectError("Set", "/node", ErrConnectionClosed)
+	if stat, err := r.Set("/node", []byte("a"), 0); err != nil {
+		t.Errorf("versioned Set returned error: %+v", err)
+	} else if stat.Version != 1 {
+		t.Errorf("Set applied %d times", stat.Version)
+	}
+
+	f.InjectError("Delete", "/node", ErrConnectionClosed)
+	if err := r.Delete("/node", 1); err != nil {
+		t.Errorf("versioned Delete returned error: %+v", err)
+	}
+}
+
+// lossyClient fails the first Create after it was applied, simulating a
+// connection lost before the response arrived.
+type lossyClient struct {
+	*FakeClient
+	lost    bool
+	adopted []string // ephemeral nodes found after the connection loss
+}
+
+func (l *lossyClient) Create(path string, data []byte, flags int32, acl []ACL) (string, error) {
+	p, err := l.FakeClient.Create(path, data, flags, acl)
+	if err == nil && !l.lost {
+		l.lost = true
+		return "", ErrConnectionClosed
+	}
+	return p, err
+}
+
+func (l *lossyClient) adoptEphemeral(path string) {
+	l.adopted = append(l.adopted, path)
+}
+
+func TestRetryClientProtectedCreate(t *testing.T) {
+	t.Parallel()
+	l := &lossyClient{FakeClient: NewFakeClient()}
+	r := NewRetryClient(l, RetryNTimes{N: 2})
+
+	// Without protection, a sequential create whose outcome is unknown isn't
+	// retried.
+	if _, err := r.Create("/plain-", nil, FlagSequence, WorldACL(PermAll)); err != ErrConnectionClosed {
+		t.Fatalf("unprotected Create returned %v; want ErrConnectionClosed", err)
+	}
+	l.Delete("/plain-0000000000", -1)
+
+	l.lost = false
+	r.ProtectSequential = true
+	p, err := r.Create("/seq-", []byte("x"), FlagSequence, WorldACL(PermAll))
+	if err != nil {
+		t.Fatalf("Create returned error: %+v", err)
+	}
+	if !strings.HasPrefix(p, "/"+protectedPrefix) {
+		t.Errorf("Create returned unprotected path %q", p)
+	}
+	children, _, _ := l.Children("/")
+	if len(children) != 1 || "/"+children[0] != p {
+		t.Errorf("expected exactly the node %q, got %v", p, children)
+	}
+}
+
+func TestRetryClientEphemeralCreate(t *testing.T) {
+	t.Parallel()
+	l := &lossyClient{FakeClient: NewFakeClient()}
+	r := NewRetryClient(l, RetryNTimes{N: 2})
+
+	if p, err := r.Create("/eph", nil, FlagEphemeral, WorldACL(PermAll)); err != nil {
+		t.Fatalf("Create returned error: %+v", err)
+	} else if p != "/eph" {
+		t.Errorf("Create returned %q; want /eph", p)
+	}
+
+	if len(l.adopted) != 1 || l.adopted[0] != "/eph" {
+		t.Errorf("adopted %q; want /eph", l.adopted)
+	}
+
+	// A persistent node found by a retry may not be ours, so a create that
+	// may have been applied isn't retried.
+	l.lost = false
+	if _, err := r.Create("/persistent", nil, 0, WorldACL(PermAll)); err != ErrConnectionClosed {
+		t.Errorf("Create of persistent node returned %v; want ErrConnectionClosed", err)
+	}
+	l.InjectError("Create", "/other", ErrNoServer)
+	if _, err := r.Create("/other", nil, 0, WorldACL(PermAll)); err != nil {
+		t.Errorf("Create of persistent node after ErrNoServer returned %v", err)
+	}
+}
+
+func TestRetryClientClose(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+	r := NewRetryClient(f, RetryNTimes{N: 1, Delay: time.Hour})
+	f.InjectError("Get", "/", ErrConnectionClosed)
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := r.Get("/")
+		done <- err
+	}()
+	for len(f.Calls()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	r.Close()
+	select {
+	case err := <-done:
+		if err != ErrClosing {
+			t.Errorf("Get returned %v; want ErrClosing", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the retry")
+	}
+}
@@ -0,0 +1,133 @@
+package zk
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ConnectContext is like Connect, but only returns once a session has been
+// established and the credentials given with WithAuth were accepted. See
+// WaitForSession for the errors returned. The connection is closed if an
+// error is returned.
+func ConnectContext(ctx context.Context, servers []string, sessionTimeout time.Duration, options ...connOption) (*Conn, <-chan Event, error) {
+	c, ec, err := Connect(servers, sessionTimeout, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.WaitForSession(ctx); err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	return c, ec, nil
+}
+
+// WaitForSession blocks until the connection has a session (possibly a
+// read-only one, see AllowReadOnly) and the stored credentials have been
+// submitted. It returns
+//
+//   - ErrNoServer once every server has been tried without success, or when
+//     the backoff policy gave up;
+//   - an error wrapping ErrAuthFailed or ErrNoAuth when the server rejected
+//     the credentials;
+//   - ErrClosing when the connection is closed;
+//   - ctx.Err() when ctx expires.
+//
+// The connection keeps trying to establish a session after an error is
+// returned, until it is closed. Calling WaitForSession again waits for the
+// outcome of the next attempt.
+func (c *Conn) WaitForSession(ctx context.Context) error {
+	r := c.session.current()
+	select {
+	case <-r.done:
+		return r.err
+	case <-c.loopDone:
+		// With AuthFailureClose the outcome and the end of the loop come
+		// together; the outcome tells why.
+		select {
+		case <-r.done:
+			if r.err != nil {
+				return r.err
+			}
+		default:
+		}
+		select {
+		case <-c.shouldQuit:
+			return ErrClosing
+		default:
+			return ErrNoServer
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SessionContext returns a context that is cancelled when the current
+// session is lost: when it expires, when the connection has been down for
+// longer than the session timeout, or when the Conn is closed. Work that is
+// only valid while the session lives, such as acting on a lock or a
+// leadership held through ephemeral nodes, should be bound to it.
+//
+// Before the first session is established, the context of that session is
+// returned. Once a session is lost, the returned context stays cancelled
+// until a new session is established. Its Err matches context.Canceled and
+// wraps why it was cancelled, which errors.Is reports: ErrSessionExpired,
+// ErrConnectionClosed (disconnected for too long), ErrAuthFailed or
+// ErrClosing.
+func (c *Conn) SessionContext() context.Context {
+	c.connState.mu.Lock()
+	defer c.connState.mu.Unlock()
+	return c.connState.sessionContext()
+}
+
+// sessionResult is the outcome of an attempt to establish a session.
+type sessionResult struct {
+	done chan struct{} // closed once err is set
+	err  error
+}
+
+// sessionNotifier publishes the outcome of attempts to establish a session
+// to WaitForSession.
+type sessionNotifier struct {
+	mu   sync.Mutex
+	last *sessionResult // the ready session, nil if there is none
+	next *sessionResult // outcome of the ongoing attempt
+}
+
+// current returns the outcome for the ready session, or the pending outcome
+// of the ongoing attempt.
+func (n *sessionNotifier) current() *sessionResult {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.last != nil {
+		return n.last
+	}
+	if n.next == nil {
+		n.next = &sessionResult{done: make(chan struct{})}
+	}
+	return n.next
+}
+
+// notify records the outcome of an attempt: nil once a session is ready, or
+// the reason it could not be established.
+func (n *sessionNotifier) notify(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	r := n.next
+	if r == nil {
+		r = &sessionResult{done: make(chan struct{})}
+	}
+	r.err = err
+	close(r.done)
+	n.next = nil
+	if err == nil {
+		n.last = r
+	}
+}
+
+// reset forgets the ready session once it is lost.
+func (n *sessionNotifier) reset() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.last = nil
+}
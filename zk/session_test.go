@@ -0,0 +1,160 @@
+package zk
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnectContext(t *testing.T) {
+	t.Parallel()
+	srv := &testServer{}
+	c, _, err := ConnectContext(context.Background(), []string{"127.0.0.1:2181"}, time.Second, WithDialer(srv.dial))
+	if err != nil {
+		t.Fatalf("ConnectContext returned error: %+v", err)
+	}
+	defer c.Close()
+	if s := c.State(); s != StateHasSession {
+		t.Errorf("State() = %v; want StateHasSession", s)
+	}
+	if err := c.WaitForSession(context.Background()); err != nil {
+		t.Errorf("WaitForSession on an established session returned error: %+v", err)
+	}
+}
+
+func TestConnectContextNoServer(t *testing.T) {
+	t.Parallel()
+	dialer := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+	_, _, err := ConnectContext(context.Background(), []string{"127.0.0.1:2181", "127.0.0.2:2181"}, time.Second,
+		WithDialer(dialer), WithBackoffPolicy(ExponentialBackoff{BaseDelay: time.Millisecond}))
+	if err != ErrNoServer {
+		t.Errorf("ConnectContext returned %v; want ErrNoServer", err)
+	}
+}
+
+func TestConnectContextAuthFailed(t *testing.T) {
+	t.Parallel()
+	srv := &testServer{handle: func(opcode int32, req interface{}) (interface{}, ErrCode) {
+		if opcode == opSetAuth {
+			return nil, errAuthFailed
+		}
+		return nil, 0
+	}}
+	_, _, err := ConnectContext(context.Background(), []string{"127.0.0.1:2181"}, time.Second,
+		WithDialer(srv.dial), WithAuth("digest", []byte("user:wrong")))
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("ConnectContext returned %v; want ErrAuthFailed", err)
+	}
+}
+
+func TestWaitForSessionAuthFailedClose(t *testing.T) {
+	t.Parallel()
+	// With AuthFailureClose the outcome is published as the loop ends; the
+	// rejection must win every time.
+	done := make(chan struct{})
+	close(done)
+	c := &Conn{loopDone: done, shouldQuit: done}
+	c.session.next = &sessionResult{done: done, err: ErrAuthFailed}
+	for i := 0; i < 100; i++ {
+		if err := c.WaitForSession(context.Background()); err != ErrAuthFailed {
+			t.Fatalf("WaitForSession returned %v; want ErrAuthFailed", err)
+		}
+	}
+}
+
+func TestConnectContextExpires(t *testing.T) {
+	t.Parallel()
+	srv := &testServer{handle: func(opcode int32, req interface{}) (interface{}, ErrCode) {
+		select {} // never answer setAuth
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err := ConnectContext(ctx, []string{"127.0.0.1:2181"}, time.Second,
+		WithDialer(srv.dial), WithAuth("digest", []byte("user:pass")))
+	if err != context.DeadlineExceeded {
+		t.Errorf("ConnectContext returned %v; want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSessionContext(t *testing.T) {
+	t.Parallel()
+	timeout := 20 * time.Millisecond
+	c := &Conn{}
+	tr := &c.connState
+
+	first := c.SessionContext()
+	tr.update(StateHasSession, timeout)
+	if c.SessionContext() != first {
+		t.Fatal("the first session got a different context than the one returned before it")
+	}
+	tr.update(StateDisconnected, timeout)
+	tr.update(StateHasSession, timeout)
+	if first.Err() != nil {
+		t.Fatal("context cancelled although the session was re-established in time")
+	}
+
+	tr.update(StateExpired, timeout)
+	if err := first.Err(); !errors.Is(err, ErrSessionExpired) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Err() = %v; want ErrSessionExpired and context.Canceled", err)
+	}
+	if ctx := c.SessionContext(); ctx.Err() == nil {
+		t.Fatal("context returned while the session is lost is not cancelled")
+	}
+
+	tr.update(StateHasSession, timeout)
+	second := c.SessionContext()
+	if second.Err() != nil {
+		t.Fatal("the context of the new session is cancelled")
+	}
+	tr.update(StateDisconnected, timeout)
+	select {
+	case <-second.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled after being disconnected for the session timeout")
+	}
+	if err := second.Err(); !errors.Is(err, ErrConnectionClosed) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Err() = %v; want ErrConnectionClosed and context.Canceled", err)
+	}
+
+	tr.update(StateHasSession, timeout)
+	third := c.SessionContext()
+	tr.close()
+	if err := third.Err(); !errors.Is(err, ErrClosing) || !errors.Is(err, context.Canceled) {
+		t.Errorf("Err() = %v; want ErrClosing and context.Canceled", err)
+	}
+}
+
+func TestSessionContextClose(t *testing.T) {
+	t.Parallel()
+	srv := &testServer{}
+	c, events, err := Connect([]string{"127.0.0.1:2181"}, time.Second, WithDialer(srv.dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitForSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx := c.SessionContext()
+	derived, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c.Close()
+	for range events {
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled by Close")
+	}
+	if err := ctx.Err(); !errors.Is(err, ErrClosing) || !errors.Is(err, context.Canceled) {
+		t.Errorf("Err() = %v; want ErrClosing and context.Canceled", err)
+	}
+	select {
+	case <-derived.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("derived context not cancelled by Close")
+	}
+}
@@ -0,0 +1,164 @@
+package zk
+
+import (
+	"context"
+	"errors"
+)
+
+// Shutdown closes the connection gracefully. It
+//
+//   - makes new requests fail with ErrClosing,
+//   - waits for the outstanding requests to complete,
+//   - deletes the ephemeral nodes created by this session, so that other
+//     clients see them disappear right away,
+//   - closes the session on the server and
+//   - waits until the event channel returned by Connect is closed.
+//
+// If ctx expires first, Shutdown returns ctx.Err() right away and the
+// connection is closed in the background, as with Close. The Conn can't be
+// used after Shutdown has been called.
+func (c *Conn) Shutdown(ctx context.Context) error {
+	err := c.shutdown(ctx)
+	if err != nil {
+		go c.Close()
+	}
+	return err
+}
+
+func (c *Conn) shutdown(ctx context.Context) error {
+	select {
+	case <-c.drain():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := c.deleteEphemerals(ctx); err != nil {
+		return err
+	}
+
+	c.quit()
+	select {
+	case <-c.queueRequest(opClose, &closeRequest{}, &closeResponse{}, nil):
+	case <-c.loopDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-c.loopDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// quit tells the connection loop to stop. It may be called several times.
+func (c *Conn) quit() {
+	c.quitOnce.Do(func() {
+		close(c.shouldQuit)
+	})
+}
+
+// beginRequest registers a request from the API. It returns false once the
+// connection is shutting down.
+func (c *Conn) beginRequest() bool {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+	if c.draining {
+		return false
+	}
+	c.inflight++
+	return true
+}
+
+func (c *Conn) endRequest() {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+	c.inflight--
+	if c.inflight == 0 && c.drained != nil {
+		close(c.drained)
+		c.drained = nil
+	}
+}
+
+// drain stops accepting requests and returns a channel that is closed once
+// the outstanding requests have completed. Concurrent calls share the
+// channel.
+func (c *Conn) drain() <-chan struct{} {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+	c.draining = true
+	if c.drained != nil {
+		return c.drained
+	}
+	done := make(chan struct{})
+	if c.inflight == 0 {
+		close(done)
+	} else {
+		c.drained = done
+	}
+	return done
+}
+
+// trackEphemeral records an ephemeral node created by the current session.
+// path is the full path on the server.
+func (c *Conn) trackEphemeral(path string) {
+	c.ephemeralsMu.Lock()
+	defer c.ephemeralsMu.Unlock()
+	if c.ephemerals == nil {
+		c.ephemerals = make(map[string]struct{})
+	}
+	c.ephemerals[path] = struct{}{}
+}
+
+// adoptEphemeral records an ephemeral node of the session that was found,
+// rather than created, after a connection loss. path is relative to the
+// chroot, as returned to the caller.
+func (c *Conn) adoptEphemeral(path string) {
+	c.trackEphemeral(c.prefixChroot(path))
+}
+
+func (c *Conn) untrackEphemeral(path string) {
+	c.ephemeralsMu.Lock()
+	defer c.ephemeralsMu.Unlock()
+	delete(c.ephemerals, path)
+}
+
+// resetEphemerals forgets the ephemeral nodes of an expired session.
+func (c *Conn) resetEphemerals() {
+	c.ephemeralsMu.Lock()
+	defer c.ephemeralsMu.Unlock()
+	c.ephemerals = nil
+}
+
+// deleteEphemerals deletes the tracked ephemeral nodes. Nodes that are
+// already gone are ignored.
+func (c *Conn) deleteEphemerals(ctx context.Context) error {
+	c.ephemeralsMu.Lock()
+	paths := make([]string, 0, len(c.ephemerals))
+	for path := range c.ephemerals {
+		paths = append(paths, path)
+	}
+	c.ephemeralsMu.Unlock()
+	if len(paths) == 0 {
+		return nil
+	}
+
+	resChans := make([]<-chan response, len(paths))
+	for i, path := range paths {
+		resChans[i] = c.queueRequest(opDelete, &DeleteRequest{Path: path, Version: -1}, &deleteResponse{}, nil)
+	}
+	for i, ch := range resChans {
+		select {
+		case res := <-ch:
+			if res.err == nil || errors.Is(res.err, ErrNoNode) {
+				c.untrackEphemeral(paths[i])
+			} else {
+				c.logger.Printf("Failed to delete ephemeral node %s on shutdown: %v", paths[i], res.err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package zk
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	srv := &testServer{handle: func(opcode int32, req interface{}) (interface{}, ErrCode) {
+		switch r := req.(type) {
+		case *CreateRequest:
+			return &createResponse{Path: r.Path}, 0
+		case *getDataRequest:
+			if r.Path == "/slow" {
+				<-release
+			}
+			return &getDataResponse{}, 0
+		}
+		return nil, 0
+	}}
+	c, events, err := Connect([]string{"127.0.0.1:2181"}, time.Second, WithDialer(srv.dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Create("/eph", nil, FlagEphemeral, WorldACL(PermAll)); err != nil {
+		t.Fatalf("Create returned error: %+v", err)
+	}
+	if _, err := c.Create("/persistent", nil, 0, WorldACL(PermAll)); err != nil {
+		t.Fatalf("Create returned error: %+v", err)
+	}
+	getDone := make(chan error, 1)
+	go func() {
+		_, _, err := c.Get("/slow")
+		getDone <- err
+	}()
+	for c.Stats().PendingRequests == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Concurrent calls wait for the same outstanding requests.
+	shutdownDone := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { shutdownDone <- c.Shutdown(context.Background()) }()
+	}
+	for {
+		if _, _, err := c.Get("/new"); errors.Is(err, ErrClosing) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-shutdownDone:
+		t.Fatalf("Shutdown returned %v before the outstanding request completed", err)
+	default:
+	}
+
+	close(release)
+	if err := <-getDone; err != nil {
+		t.Errorf("outstanding Get returned error: %+v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-shutdownDone:
+			if err != nil {
+				t.Fatalf("Shutdown returned error: %+v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Shutdown did not complete")
+		}
+	}
+
+	if _, ok := <-events; ok {
+		for range events {
+		}
+	}
+	// Gets of /new may have been sent before Shutdown started draining. Only
+	// one of the Shutdown calls closes the session.
+	got := srv.received()
+	if len(got) < 2 || !reflect.DeepEqual(got[len(got)-2:], []int32{opDelete, opClose}) {
+		t.Errorf("server received ops %v; want the ephemeral deleted, then the session closed", got)
+	}
+	c.Close() // must not panic after Shutdown
+}
+
+func TestShutdownContextExpires(t *testing.T) {
+	t.Parallel()
+	srv := &testServer{handle: func(opcode int32, req interface{}) (interface{}, ErrCode) {
+		if opcode == opGetData {
+			select {}
+		}
+		return nil, 0
+	}}
+	c, events, err := Connect([]string{"127.0.0.1:2181"}, time.Second, WithDialer(srv.dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go c.Get("/stuck")
+	for c.Stats().PendingRequests == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown returned %v; want context.DeadlineExceeded", err)
+	}
+	for range events {
+	}
+}
+
+func TestShutdownDeletesFoundProtectedNodes(t *testing.T) {
+	t.Parallel()
+	l := &lossyClient{FakeClient: NewFakeClient()}
+	path, err := createProtectedEphemeralSequential(l, "/lock-", nil, WorldACL(PermAll))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l.adopted, []string{path}) {
+		t.Errorf("adopted %q; want the node %q found after the connection loss", l.adopted, path)
+	}
+
+	c := &Conn{chroot: "/app"}
+	c.adoptEphemeral("/lock-1")
+	if _, ok := c.ephemerals["/app/lock-1"]; !ok {
+		t.Errorf("tracked ephemerals %v; want /app/lock-1", c.ephemerals)
+	}
+}
@@ -0,0 +1,186 @@
+package zk
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the internal state of a Conn, for debugging.
+type Stats struct {
+	Server          string
+	State           State
+	ConnectionState ConnectionState
+	SessionID       int64
+	SessionTimeout  time.Duration // Negotiated with the server.
+	LastZxid        int64         // Latest zxid seen in a response.
+
+	PendingRequests  int           // Requests sent and waiting for a response.
+	OldestPendingAge time.Duration // Time since the oldest pending request was sent.
+	QueuedRequests   int           // Requests waiting to be sent.
+
+	Watches     WatchStats
+	AuthSchemes []string // Schemes of the credentials re-submitted on reconnect, including those of AuthProviders.
+
+	Connects      int64 // Sessions established or re-established.
+	Reconnects    int64 // Connects after the first one.
+	Expirations   int64 // Sessions expired by the server.
+	FailedDials   int64 // Connection attempts that failed.
+	DroppedEvents uint64
+	Ping          PingStats
+}
+
+// WatchStats lists the watched paths by type of watch.
+type WatchStats struct {
+	Data  []string // Set by Get and Exists on existing nodes.
+	Exist []string // Set by Exists on missing nodes.
+	Child []string // Set by Children.
+}
+
+// Stats returns a snapshot of the internal state of the connection.
+func (c *Conn) Stats() Stats {
+	connects := atomic.LoadInt64(&c.connects)
+	s := Stats{
+		Server:          c.Server(),
+		State:           c.State(),
+		ConnectionState: c.ConnectionState(),
+		SessionID:       c.SessionID(),
+		SessionTimeout:  time.Duration(atomic.LoadInt32(&c.sessionTimeoutMs)) * time.Millisecond,
+		LastZxid:        atomic.LoadInt64(&c.lastZxid),
+		QueuedRequests:  len(c.sendChan),
+		Connects:        connects,
+		Expirations:     atomic.LoadInt64(&c.expirations),
+		FailedDials:     atomic.LoadInt64(&c.failedDials),
+		DroppedEvents:   c.DroppedEvents(),
+		Ping:            c.PingStats(),
+	}
+	if connects > 1 {
+		s.Reconnects = connects - 1
+	}
+
+	now := time.Now()
+	c.requestsLock.Lock()
+	s.PendingRequests = len(c.requests)
+	for _, req := range c.requests {
+		if age := now.Sub(req.sent); age > s.OldestPendingAge {
+			s.OldestPendingAge = age
+		}
+	}
+	c.requestsLock.Unlock()
+
+	c.watchersLock.Lock()
+	for wpt, watchers := range c.watchers {
+		if len(watchers) == 0 {
+			continue
+		}
+		path := c.stripChroot(wpt.path)
+		switch wpt.wType {
+		case watchTypeData:
+			s.Watches.Data = append(s.Watches.Data, path)
+		case watchTypeExist:
+			s.Watches.Exist = append(s.Watches.Exist, path)
+		case watchTypeChild:
+			s.Watches.Child = append(s.Watches.Child, path)
+		}
+	}
+	c.watchersLock.Unlock()
+	sort.Strings(s.Watches.Data)
+	sort.Strings(s.Watches.Exist)
+	sort.Strings(s.Watches.Child)
+
+	c.credsMu.Lock()
+	for _, cred := range c.creds {
+		s.AuthSchemes = append(s.AuthSchemes, cred.scheme)
+	}
+	for _, cred := range c.providerAuth {
+		s.AuthSchemes = append(s.AuthSchemes, cred.scheme)
+	}
+	c.credsMu.Unlock()
+
+	return s
+}
+
+// statsJSON is the JSON rendering of Stats, with readable states and
+// durations.
+type statsJSON struct {
+	Server           string     `json:"server"`
+	State            string     `json:"state"`
+	ConnectionState  string     `json:"connectionState"`
+	SessionID        string     `json:"sessionId"`
+	SessionTimeout   string     `json:"sessionTimeout"`
+	LastZxid         string     `json:"lastZxid"`
+	PendingRequests  int        `json:"pendingRequests"`
+	OldestPendingAge string     `json:"oldestPendingAge"`
+	QueuedRequests   int        `json:"queuedRequests"`
+	Watches          WatchStats `json:"watches"`
+	AuthSchemes      []string   `json:"authSchemes"`
+	Connects         int64      `json:"connects"`
+	Reconnects       int64      `json:"reconnects"`
+	Expirations      int64      `json:"expirations"`
+	FailedDials      int64      `json:"failedDials"`
+	DroppedEvents    uint64     `json:"droppedEvents"`
+	Ping             pingJSON   `json:"ping"`
+}
+
+type pingJSON struct {
+	Count        int64     `json:"count"`
+	Last         string    `json:"last"`
+	Min          string    `json:"min"`
+	Max          string    `json:"max"`
+	Mean         string    `json:"mean"`
+	Smoothed     string    `json:"smoothed"`
+	LastSent     time.Time `json:"lastSent"`
+	LastReceived time.Time `json:"lastReceived"`
+	Outstanding  int       `json:"outstanding"`
+	Timeouts     int64     `json:"timeouts"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Stats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(statsJSON{
+		Server:           s.Server,
+		State:            s.State.String(),
+		ConnectionState:  s.ConnectionState.String(),
+		SessionID:        fmt.Sprintf("0x%x", s.SessionID),
+		SessionTimeout:   s.SessionTimeout.String(),
+		LastZxid:         fmt.Sprintf("0x%x", s.LastZxid),
+		PendingRequests:  s.PendingRequests,
+		OldestPendingAge: s.OldestPendingAge.String(),
+		QueuedRequests:   s.QueuedRequests,
+		Watches:          s.Watches,
+		AuthSchemes:      s.AuthSchemes,
+		Connects:         s.Connects,
+		Reconnects:       s.Reconnects,
+		Expirations:      s.Expirations,
+		FailedDials:      s.FailedDials,
+		DroppedEvents:    s.DroppedEvents,
+		Ping: pingJSON{
+			Count:        s.Ping.Count,
+			Last:         s.Ping.Last.String(),
+			Min:          s.Ping.Min.String(),
+			Max:          s.Ping.Max.String(),
+			Mean:         s.Ping.Mean.String(),
+			Smoothed:     s.Ping.Smoothed.String(),
+			LastSent:     s.Ping.LastSent,
+			LastReceived: s.Ping.LastReceived,
+			Outstanding:  s.Ping.Outstanding,
+			Timeouts:     s.Ping.Timeouts,
+		},
+	})
+}
+
+// StatsHandler returns an http.Handler that renders c.Stats() as JSON, for
+// debug endpoints.
+func StatsHandler(c *Conn) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(c.Stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
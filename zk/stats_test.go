@@ -0,0 +1,66 @@
+package zk
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+	c := &Conn{
+		server:           "127.0.0.1:2181",
+		state:            StateHasSession,
+		sessionID:        0x1234,
+		sessionTimeoutMs: 4000,
+		lastZxid:         0x10,
+		connects:         3,
+		chroot:           "/app",
+		sendChan:         make(chan *request, 2),
+		requests: map[int32]*request{
+			1: {sent: time.Now().Add(-time.Minute)},
+			2: {sent: time.Now()},
+		},
+		watchers: map[watchPathType][]chan Event{
+			{"/app/b", watchTypeData}:  {make(chan Event, 1)},
+			{"/app/a", watchTypeData}:  {make(chan Event, 1)},
+			{"/app/c", watchTypeChild}: {make(chan Event, 1)},
+			{"/app/d", watchTypeExist}: nil,
+		},
+		creds: []authCreds{{"digest", []byte("user:secret")}},
+	}
+	c.sendChan <- &request{}
+
+	s := c.Stats()
+	if s.Server != "127.0.0.1:2181" || s.State != StateHasSession || s.SessionID != 0x1234 ||
+		s.SessionTimeout != 4*time.Second || s.LastZxid != 0x10 {
+		t.Errorf("unexpected session stats %+v", s)
+	}
+	if s.PendingRequests != 2 || s.OldestPendingAge < time.Minute || s.QueuedRequests != 1 {
+		t.Errorf("unexpected request stats %+v", s)
+	}
+	if want := (WatchStats{Data: []string{"/a", "/b"}, Child: []string{"/c"}}); !reflect.DeepEqual(s.Watches, want) {
+		t.Errorf("Watches = %+v; want %+v", s.Watches, want)
+	}
+	if !reflect.DeepEqual(s.AuthSchemes, []string{"digest"}) {
+		t.Errorf("AuthSchemes = %q", s.AuthSchemes)
+	}
+	if s.Connects != 3 || s.Reconnects != 2 {
+		t.Errorf("Connects, Reconnects = %d, %d; want 3, 2", s.Connects, s.Reconnects)
+	}
+
+	rec := httptest.NewRecorder()
+	StatsHandler(c).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/zk", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	if out["state"] != "StateHasSession" || out["sessionId"] != "0x1234" || out["sessionTimeout"] != "4s" {
+		t.Errorf("unexpected JSON %s", rec.Body.String())
+	}
+}
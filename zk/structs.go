@@ -6,6 +6,7 @@ import (
 	"log"
 	"reflect"
 	"runtime"
+	"strings"
 	"time"
 )
 
@@ -171,6 +172,14 @@ type CreateRequest struct {
 	Flags int32
 }
 
+type createTTLRequest struct {
+	Path  string
+	Data  []byte
+	Acl   []ACL
+	Flags int32
+	Ttl   int64 // milliseconds
+}
+
 type createResponse pathResponse
 type DeleteRequest PathVersionRequest
 type deleteResponse struct{}
@@ -400,10 +409,25 @@ type encoder interface {
 	Encode(buf []byte) (int, error)
 }
 
+// DecodeRecord decodes a jute record, the serialization used by the
+// ZooKeeper protocol and data files, from buf into the struct pointed to by
+// st. The fields of st are read in order: int32, int64, bool, string,
+// []byte, structs and slices of those. It returns the number of bytes read,
+// and ErrShortBuffer if buf ends before the record does.
+func DecodeRecord(buf []byte, st interface{}) (int, error) {
+	return decodePacket(buf, st)
+}
+
+// EncodeRecord is the counterpart of DecodeRecord. It returns ErrShortBuffer
+// if the record doesn't fit in buf.
+func EncodeRecord(buf []byte, st interface{}) (int, error) {
+	return encodePacket(buf, st)
+}
+
 func decodePacket(buf []byte, st interface{}) (n int, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			if e, ok := r.(runtime.Error); ok && e.Error() == "runtime error: slice bounds out of range" {
+			if isBoundsError(r) {
 				err = ErrShortBuffer
 			} else {
 				panic(r)
@@ -418,6 +442,17 @@ func decodePacket(buf []byte, st interface{}) (n int, err error) {
 	return decodePacketValue(buf, v)
 }
 
+// isBoundsError reports whether a recovered panic is an index or slice
+// bounds failure, which is how a buffer that is too short surfaces.
+func isBoundsError(r interface{}) bool {
+	e, ok := r.(runtime.Error)
+	if !ok {
+		return false
+	}
+	msg := e.Error()
+	return strings.Contains(msg, "index out of range") || strings.Contains(msg, "slice bounds out of range")
+}
+
 func decodePacketValue(buf []byte, v reflect.Value) (int, error) {
 	rv := v
 	kind := v.Kind()
@@ -449,23 +484,57 @@ func decodePacketValue(buf []byte, v reflect.Value) (int, error) {
 			}
 		}
 	case reflect.Bool:
+		if len(buf) < 1 {
+			return n, ErrShortBuffer
+		}
 		v.SetBool(buf[n] != 0)
 		n++
 	case reflect.Int32:
+		if len(buf) < 4 {
+			return n, ErrShortBuffer
+		}
 		v.SetInt(int64(binary.BigEndian.Uint32(buf[n : n+4])))
 		n += 4
 	case reflect.Int64:
+		if len(buf) < 8 {
+			return n, ErrShortBuffer
+		}
 		v.SetInt(int64(binary.BigEndian.Uint64(buf[n : n+8])))
 		n += 8
 	case reflect.String:
-		ln := int(binary.BigEndian.Uint32(buf[n : n+4]))
+		if len(buf) < 4 {
+			return n, ErrShortBuffer
+		}
+		ln := int(int32(binary.BigEndian.Uint32(buf[n : n+4])))
+		if ln < 0 {
+			// A null string.
+			v.SetString("")
+			n += 4
+			break
+		}
+		if ln > len(buf)-4 {
+			return n, ErrShortBuffer
+		}
 		v.SetString(string(buf[n+4 : n+4+ln]))
 		n += 4 + ln
 	case reflect.Slice:
+		if len(buf) < 4 {
+			return n, ErrShortBuffer
+		}
 		switch v.Type().Elem().Kind() {
 		default:
-			count := int(binary.BigEndian.Uint32(buf[n : n+4]))
+			count := int(int32(binary.BigEndian.Uint32(buf[n : n+4])))
 			n += 4
+			if count < 0 {
+				// A null vector.
+				v.Set(reflect.Zero(v.Type()))
+				break
+			}
+			// Every element takes at least a byte, so a larger count can
+			// only come from a corrupt or truncated buffer.
+			if count > len(buf)-n {
+				return n, ErrShortBuffer
+			}
 			values := reflect.MakeSlice(v.Type(), count, count)
 			v.Set(values)
 			for i := 0; i < count; i++ {
@@ -480,6 +549,8 @@ func decodePacketValue(buf []byte, v reflect.Value) (int, error) {
 			if ln < 0 {
 				n += 4
 				v.SetBytes(nil)
+			} else if ln > len(buf)-4 {
+				return n, ErrShortBuffer
 			} else {
 				bytes := make([]byte, ln)
 				copy(bytes, buf[n+4:n+4+ln])
@@ -494,7 +565,7 @@ func decodePacketValue(buf []byte, v reflect.Value) (int, error) {
 func encodePacket(buf []byte, st interface{}) (n int, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			if e, ok := r.(runtime.Error); ok && e.Error() == "runtime error: slice bounds out of range" {
+			if isBoundsError(r) {
 				err = ErrShortBuffer
 			} else {
 				panic(r)
@@ -585,8 +656,10 @@ func requestStructForOp(op int32) interface{} {
 	switch op {
 	case opClose:
 		return &closeRequest{}
-	case opCreate, opCreate2:
+	case opCreate, opCreate2, opCreateContainer:
 		return &CreateRequest{}
+	case opCreateTTL:
+		return &createTTLRequest{}
 	case opDelete:
 		return &DeleteRequest{}
 	case opExists:
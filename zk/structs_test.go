@@ -70,6 +70,41 @@ func TestDecodeShortBuffer(t *testing.T) {
 	}
 }
 
+// makesliceDecoder fails with a runtime error that isn't a bounds failure.
+type makesliceDecoder struct{}
+
+func (makesliceDecoder) Decode(buf []byte) (int, error) {
+	n := -len(buf) - 1
+	_ = make([]byte, n)
+	return 0, nil
+}
+
+func TestDecodeCorruptLengths(t *testing.T) {
+	t.Parallel()
+	for _, buf := range [][]byte{
+		{0, 0, 0, 1, 0, 0, 0, 9, 'a'}, // string longer than the buffer
+		{0x7f, 0xff, 0xff, 0xff},      // huge count
+		{0, 0, 0, 1, 0, 0},            // truncated string length
+	} {
+		var res getChildrenResponse
+		if _, err := decodePacket(buf, &res); err != ErrShortBuffer {
+			t.Errorf("decodePacket(%v) returned %v; want ErrShortBuffer", buf, err)
+		}
+	}
+
+	var res getChildrenResponse
+	if _, err := decodePacket([]byte{0xff, 0xff, 0xff, 0xff}, &res); err != nil || res.Children != nil {
+		t.Errorf("decoding a null vector returned %v, %v", res.Children, err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("a runtime error other than a bounds failure should not be recovered")
+		}
+	}()
+	decodePacket([]byte{1}, &makesliceDecoder{})
+}
+
 func BenchmarkEncode(b *testing.B) {
 	buf := make([]byte, 4096)
 	st := &connectRequest{Passwd: []byte("1234567890")}
@@ -0,0 +1,266 @@
+package zk
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy decides what happens to an event delivered to a subscriber
+// whose buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest buffered event to make room for
+	// the new one. Dropped events are counted by Conn.DroppedEvents.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowBlock waits until the subscriber has made room. This delays
+	// the ZK go routines, so it must only be used with consumers that keep up.
+	OverflowBlock
+	// OverflowUnbounded buffers as many events as needed.
+	OverflowUnbounded
+)
+
+// EventFilter selects the events delivered to a subscriber and how they are
+// buffered. The zero value subscribes to all events with a buffer of
+// eventChanSize events, dropping the oldest ones on overflow.
+type EventFilter struct {
+	Types      []EventType // Deliver only events of these types. All if empty.
+	States     []State     // Deliver only events with these states. All if empty.
+	PathPrefix string      // Deliver only events for paths with this prefix. All if empty.
+
+	BufferSize int            // Size of the channel buffer. eventChanSize if zero.
+	Overflow   OverflowPolicy // What to do when the buffer is full.
+}
+
+func (f *EventFilter) match(ev Event) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			if t == ev.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.States) > 0 {
+		found := false
+		for _, s := range f.States {
+			if s == ev.State {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.PathPrefix == "" || strings.HasPrefix(ev.Path, f.PathPrefix)
+}
+
+// Subscribe returns a channel receiving the events matching filter, in
+// addition to the channel returned by Connect. Every subscriber has its own
+// buffer, so a slow subscriber does not affect the others. The channel is
+// closed when cancel is called or the connection is closed.
+func (c *Conn) Subscribe(filter EventFilter) (events <-chan Event, cancel func()) {
+	size := filter.BufferSize
+	if size <= 0 {
+		size = eventChanSize
+	}
+	s := &subscriber{
+		filter:  filter,
+		out:     make(chan Event, size),
+		done:    make(chan struct{}),
+		dropped: &c.droppedEvents,
+	}
+	if filter.Overflow == OverflowUnbounded {
+		s.wake = make(chan struct{}, 1)
+		s.forwarded = make(chan struct{})
+		go s.forward()
+	}
+
+	c.subsMu.Lock()
+	if c.subsClosed {
+		c.subsMu.Unlock()
+		s.cancel()
+		return s.out, func() {}
+	}
+	if c.subs == nil {
+		c.subs = make(map[*subscriber]struct{})
+	}
+	c.subs[s] = struct{}{}
+	c.subsMu.Unlock()
+
+	var once sync.Once
+	return s.out, func() {
+		once.Do(func() {
+			// Unblock a pending delivery before waiting for subsMu, which
+			// is held while delivering.
+			close(s.done)
+			c.subsMu.Lock()
+			delete(c.subs, s)
+			c.subsMu.Unlock()
+			s.cancel()
+		})
+	}
+}
+
+// DroppedEvents returns the number of events discarded so far because the
+// channel returned by Connect or a subscriber's buffer was full.
+func (c *Conn) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&c.droppedEvents)
+}
+
+// publishEvent delivers ev to every subscriber.
+func (c *Conn) publishEvent(ev Event) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	for s := range c.subs {
+		if s.filter.match(ev) {
+			s.deliver(ev)
+		}
+	}
+}
+
+// closeSubscribers closes the channel of every subscriber once the Conn has
+// shut down. Events already buffered are still delivered.
+func (c *Conn) closeSubscribers() {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	for s := range c.subs {
+		s.shutdown()
+	}
+	c.subs = nil
+	c.subsClosed = true
+}
+
+type subscriber struct {
+	filter  EventFilter
+	out     chan Event
+	done    chan struct{} // closed on cancel to unblock deliver and forward
+	dropped *uint64
+
+	mu        sync.Mutex // protects out, queue, closed, draining and outClosed
+	queue     []Event    // pending events of an unbounded subscriber
+	closed    bool       // no more events are accepted
+	draining  bool       // forward closes out once queue is empty
+	outClosed bool
+
+	wake      chan struct{} // signals forward that queue changed
+	forwarded chan struct{} // closed when forward returns
+}
+
+func (s *subscriber) deliver(ev Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	switch s.filter.Overflow {
+	case OverflowBlock:
+		select {
+		case s.out <- ev:
+		case <-s.done:
+		}
+	case OverflowUnbounded:
+		s.queue = append(s.queue, ev)
+		s.signal()
+	default:
+		for {
+			select {
+			case s.out <- ev:
+				return
+			default:
+			}
+			select {
+			case <-s.out:
+				atomic.AddUint64(s.dropped, 1)
+			default:
+			}
+		}
+	}
+}
+
+func (s *subscriber) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// forward moves queued events of an unbounded subscriber to its channel.
+func (s *subscriber) forward() {
+	defer close(s.forwarded)
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				if s.draining {
+					s.closeOut()
+					s.mu.Unlock()
+					return
+				}
+				s.mu.Unlock()
+				break
+			}
+			ev := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			select {
+			case s.out <- ev:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// shutdown stops accepting events and closes the channel once the buffered
+// events have been handed over.
+func (s *subscriber) shutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.forwarded != nil {
+		s.draining = true
+		s.signal()
+		return
+	}
+	s.closeOut()
+}
+
+// cancel discards pending events and closes the channel. s.done may already
+// have been closed by the caller.
+func (s *subscriber) cancel() {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	if s.forwarded != nil {
+		<-s.forwarded
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.queue = nil
+	s.closeOut()
+}
+
+// closeOut must be called with s.mu held.
+func (s *subscriber) closeOut() {
+	if !s.outClosed {
+		close(s.out)
+		s.outClosed = true
+	}
+}
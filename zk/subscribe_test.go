@@ -0,0 +1,108 @@
+package zk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribeFilter(t *testing.T) {
+	t.Parallel()
+	c := &Conn{eventChan: make(chan Event, eventChanSize)}
+	nodes, cancelNodes := c.Subscribe(EventFilter{Types: []EventType{EventNodeDataChanged}, PathPrefix: "/app/"})
+	defer cancelNodes()
+	sessions, cancelSessions := c.Subscribe(EventFilter{States: []State{StateExpired, StateHasSession}})
+	defer cancelSessions()
+
+	c.sendEvent(Event{Type: EventNodeDataChanged, Path: "/app/a"})
+	c.sendEvent(Event{Type: EventNodeDataChanged, Path: "/other"})
+	c.sendEvent(Event{Type: EventNodeCreated, Path: "/app/b"})
+	c.sendEvent(Event{Type: EventSession, State: StateConnecting})
+	c.sendEvent(Event{Type: EventSession, State: StateHasSession})
+
+	if ev := <-nodes; ev.Path != "/app/a" {
+		t.Errorf("unexpected node event %+v", ev)
+	}
+	if ev := <-sessions; ev.State != StateHasSession {
+		t.Errorf("unexpected session event %+v", ev)
+	}
+	select {
+	case ev := <-nodes:
+		t.Errorf("unexpected node event %+v", ev)
+	case ev := <-sessions:
+		t.Errorf("unexpected session event %+v", ev)
+	default:
+	}
+}
+
+func TestSubscribeOverflow(t *testing.T) {
+	t.Parallel()
+	c := &Conn{eventChan: make(chan Event, 100)}
+	dropOldest, cancelDrop := c.Subscribe(EventFilter{BufferSize: 2})
+	unbounded, cancelUnbounded := c.Subscribe(EventFilter{BufferSize: 1, Overflow: OverflowUnbounded})
+	defer cancelUnbounded()
+
+	for _, p := range []string{"/a", "/b", "/c", "/d"} {
+		c.sendEvent(Event{Type: EventNodeCreated, Path: p})
+	}
+	if n := c.DroppedEvents(); n != 2 {
+		t.Errorf("DroppedEvents() = %d; want 2", n)
+	}
+	if ev := <-dropOldest; ev.Path != "/c" {
+		t.Errorf("first buffered event is %q; want /c", ev.Path)
+	}
+	cancelDrop()
+	for range dropOldest {
+	}
+
+	for _, want := range []string{"/a", "/b", "/c", "/d"} {
+		select {
+		case ev := <-unbounded:
+			if ev.Path != want {
+				t.Errorf("unbounded subscriber got %q; want %q", ev.Path, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("unbounded subscriber did not receive %q", want)
+		}
+	}
+}
+
+func TestSubscribeBlockAndClose(t *testing.T) {
+	t.Parallel()
+	c := &Conn{eventChan: make(chan Event, 100)}
+	blocking, cancel := c.Subscribe(EventFilter{BufferSize: 1, Overflow: OverflowBlock})
+	unbounded, _ := c.Subscribe(EventFilter{Overflow: OverflowUnbounded})
+
+	c.sendEvent(Event{Type: EventNodeCreated, Path: "/a"})
+	sent := make(chan struct{})
+	go func() {
+		c.sendEvent(Event{Type: EventNodeCreated, Path: "/b"})
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("sendEvent did not block on a full subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("cancel did not unblock sendEvent")
+	}
+	for range blocking {
+	}
+
+	c.closeSubscribers()
+	var paths []string
+	for ev := range unbounded {
+		paths = append(paths, ev.Path)
+	}
+	if len(paths) != 2 {
+		t.Errorf("unbounded subscriber received %q after close; want both events", paths)
+	}
+	if ch, _ := c.Subscribe(EventFilter{}); ch != nil {
+		if _, ok := <-ch; ok {
+			t.Error("Subscribe after close should return a closed channel")
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"math/rand"
-	"strconv"
 	"strings"
 )
 
@@ -38,13 +37,56 @@ func DigestACL(perms int32, user, password string) []ACL {
 // DefaultPort constant is added to the end.
 func FormatServers(servers []string) []string {
 	for i := range servers {
-		if !strings.Contains(servers[i], ":") {
-			servers[i] = servers[i] + ":" + strconv.Itoa(DefaultPort)
-		}
+		servers[i] = formatServer(servers[i])
 	}
 	return servers
 }
 
+// splitChroot removes the chroot suffix (e.g. "host:2181/apps/foo") from a
+// list of server addresses. Every server carrying a suffix must agree on it.
+func splitChroot(servers []string) ([]string, string, error) {
+	chroot := ""
+	srvs := make([]string, len(servers))
+	for i, addr := range servers {
+		idx := strings.Index(addr, "/")
+		if idx < 0 {
+			srvs[i] = addr
+			continue
+		}
+		root := addr[idx:]
+		if chroot != "" && root != chroot {
+			return nil, "", fmt.Errorf("zk: conflicting chroot paths %q and %q", chroot, root)
+		}
+		chroot = root
+		srvs[i] = addr[:idx]
+	}
+	if chroot == "/" {
+		chroot = ""
+	}
+	if chroot != "" {
+		if err := validatePath(chroot, false); err != nil {
+			return nil, "", err
+		}
+	}
+	return srvs, chroot, nil
+}
+
+// validatePath checks that path is an absolute znode path other than the root.
+// A trailing slash is only allowed for sequential nodes, where the server
+// appends a suffix.
+func validatePath(path string, isSequential bool) error {
+	if path == "" || path[0] != '/' || path == "/" {
+		return ErrInvalidPath
+	}
+	if strings.HasSuffix(path, "/") && !isSequential {
+		return ErrInvalidPath
+	}
+	if strings.Contains(path, "//") {
+		return ErrInvalidPath
+	}
+	return nil
+}
+
 // stringShuffle performs a Fisher-Yates shuffle on a slice of strings
 func stringShuffle(s []string) {
 	for i := len(s) - 1; i > 0; i-- {
@@ -1,14 +1,66 @@
 package zk
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestFormatServers(t *testing.T) {
 	t.Parallel()
-	servers := []string{"127.0.0.1:2181", "127.0.0.42", "127.0.42.1:8811"}
-	r := []string{"127.0.0.1:2181", "127.0.0.42:2181", "127.0.42.1:8811"}
+	servers := []string{"127.0.0.1:2181", "127.0.0.42", "127.0.42.1:8811", "::1", "[::1]:2182"}
+	r := []string{"127.0.0.1:2181", "127.0.0.42:2181", "127.0.42.1:8811", "[::1]:2181", "[::1]:2182"}
 	for i, s := range FormatServers(servers) {
 		if s != r[i] {
 			t.Errorf("%v should equal %v", s, r[i])
 		}
 	}
 }
+
+func TestSplitChroot(t *testing.T) {
+	t.Parallel()
+	srvs, chroot, err := splitChroot([]string{"host1:2181", "host2:2181/apps/foo"})
+	if err != nil {
+		t.Fatalf("splitChroot returned error: %+v", err)
+	}
+	if chroot != "/apps/foo" || srvs[0] != "host1:2181" || srvs[1] != "host2:2181" {
+		t.Errorf("splitChroot returned %q, %q", srvs, chroot)
+	}
+	if _, chroot, _ := splitChroot([]string{"host1/"}); chroot != "" {
+		t.Errorf("root chroot should be ignored, got %q", chroot)
+	}
+	if _, _, err := splitChroot([]string{"host1/a", "host2/b"}); err == nil {
+		t.Error("conflicting chroots should fail")
+	}
+	if _, _, err := splitChroot([]string{"host1/a/"}); err != ErrInvalidPath {
+		t.Errorf("invalid chroot returned %v; want ErrInvalidPath", err)
+	}
+}
+
+func TestWithChrootInvalid(t *testing.T) {
+	t.Parallel()
+	for _, chroot := range []string{"a/b", "/a/", "/a//b"} {
+		if _, _, err := Connect([]string{"127.0.0.1:2181"}, time.Second, WithChroot(chroot)); err != ErrInvalidPath {
+			t.Errorf("Connect with chroot %q returned %v; want ErrInvalidPath", chroot, err)
+		}
+	}
+}
+
+func TestChrootPaths(t *testing.T) {
+	t.Parallel()
+	c := &Conn{chroot: "/apps/foo"}
+	tests := []struct {
+		client, server string
+	}{
+		{"/", "/apps/foo"},
+		{"/bar", "/apps/foo/bar"},
+		{"/bar/baz", "/apps/foo/bar/baz"},
+	}
+	for _, tt := range tests {
+		if p := c.prefixChroot(tt.client); p != tt.server {
+			t.Errorf("prefixChroot(%q) = %q; want %q", tt.client, p, tt.server)
+		}
+		if p := c.stripChroot(tt.server); p != tt.client {
+			t.Errorf("stripChroot(%q) = %q; want %q", tt.server, p, tt.client)
+		}
+	}
+}
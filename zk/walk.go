@@ -0,0 +1,262 @@
+package zk
+
+import (
+	"errors"
+	"sync"
+)
+
+// SkipSubtree can be returned by a WalkFunc to skip the descendants of the
+// node it was called for. It is not returned as an error by Walk.
+var SkipSubtree = errors.New("zk: skip this subtree")
+
+// defaultWalkConcurrency is the number of requests Walk keeps in flight if
+// WalkOptions.Concurrency isn't set.
+const defaultWalkConcurrency = 8
+
+// WalkOptions modifies the behaviour of Walk.
+type WalkOptions struct {
+	// Concurrency is the maximum number of nodes fetched at once. It
+	// defaults to 8.
+	Concurrency int
+	// Data fetches the data of every node.
+	Data bool
+	// ACL fetches the ACL of every node.
+	ACL bool
+	// PostOrder visits the children of a node before the node itself,
+	// rather than after it.
+	PostOrder bool
+	// MaxDepth limits how far below the root the walk goes: 1 visits the
+	// root and its children. 0 means no limit.
+	MaxDepth int
+}
+
+// WalkNode is a node visited by Walk.
+type WalkNode struct {
+	Path     string
+	Depth    int      // 0 for the root.
+	Children []string // Names of the children, in no particular order.
+	Stat     *Stat
+	Data     []byte // Set if WalkOptions.Data is.
+	ACL      []ACL  // Set if WalkOptions.ACL is.
+}
+
+// WalkFunc is called by Walk for every node. Calls are never concurrent. If
+// it returns SkipSubtree in pre-order, the descendants of node are skipped.
+// Any other error stops the walk and is returned by Walk.
+type WalkFunc func(node *WalkNode) error
+
+// Walk visits root and its descendants, calling fn for every node. Nodes
+// are fetched concurrently, so siblings are visited in no particular order,
+// but a node is always visited before its descendants, or after them if
+// opts.PostOrder is set. Nodes deleted during the walk are skipped; root
+// itself must exist. opts may be nil.
+func (c *Conn) Walk(root string, fn WalkFunc, opts *WalkOptions) error {
+	return walk(c, root, fn, opts)
+}
+
+type walker struct {
+	c    Client
+	fn   WalkFunc
+	opts WalkOptions
+
+	fnMu sync.Mutex // serializes the calls of fn
+
+	mu     sync.Mutex
+	cond   *sync.Cond // signalled when work is queued or the walk ends
+	queue  []walkTask // nodes waiting to be fetched
+	active int        // tasks being processed by a worker
+	err    error      // the first error, which stops the walk
+}
+
+// walkTask is a node to fetch, with the state of its visited parent.
+type walkTask struct {
+	path   string
+	depth  int
+	parent *walkState
+}
+
+// walkState tracks a fetched node until all of its children are done, so
+// that it can be visited after them in post-order.
+type walkState struct {
+	node    *WalkNode
+	parent  *walkState
+	pending int // children not done yet, guarded by walker.mu
+}
+
+func walk(c Client, root string, fn WalkFunc, opts *WalkOptions) error {
+	w := &walker{c: c, fn: fn}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.Concurrency <= 0 {
+		w.opts.Concurrency = defaultWalkConcurrency
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	node, err := w.fetch(root, 0)
+	if err != nil {
+		return err
+	}
+	w.expand(&walkState{node: node})
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+	return w.failed()
+}
+
+func (w *walker) failed() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *walker) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+		w.queue = nil
+		w.cond.Broadcast()
+	}
+}
+
+func (w *walker) call(node *WalkNode) error {
+	w.fnMu.Lock()
+	defer w.fnMu.Unlock()
+	if err := w.failed(); err != nil {
+		return err
+	}
+	return w.fn(node)
+}
+
+// work processes queued tasks until the queue is empty and no other worker
+// can add to it. The most recently queued task is taken first, which keeps
+// the queue as small as a depth-first walk would.
+func (w *walker) work() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for {
+		for len(w.queue) == 0 && w.active > 0 {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 {
+			return
+		}
+		task := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		w.active++
+		w.mu.Unlock()
+		w.process(task)
+		w.mu.Lock()
+		w.active--
+		if w.active == 0 && len(w.queue) == 0 {
+			w.cond.Broadcast()
+		}
+	}
+}
+
+// process fetches the node of task and visits it.
+func (w *walker) process(task walkTask) {
+	if w.failed() != nil {
+		return
+	}
+	node, err := w.fetch(task.path, task.depth)
+	if errors.Is(err, ErrNoNode) {
+		// Deleted since its parent was listed.
+		w.childDone(task.parent)
+		return
+	} else if err != nil {
+		w.fail(err)
+		return
+	}
+	w.expand(&walkState{node: node, parent: task.parent})
+}
+
+// expand calls fn for a pre-order walk and queues the children of the node,
+// or finishes it if there are none to visit.
+func (w *walker) expand(state *walkState) {
+	node := state.node
+	if !w.opts.PostOrder {
+		if err := w.call(node); err == SkipSubtree {
+			w.childDone(state.parent)
+			return
+		} else if err != nil {
+			w.fail(err)
+			return
+		}
+	}
+
+	var children []string
+	if w.opts.MaxDepth == 0 || node.Depth < w.opts.MaxDepth {
+		children = node.Children
+	}
+	if len(children) == 0 {
+		w.finish(state)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return
+	}
+	state.pending = len(children)
+	for _, name := range children {
+		w.queue = append(w.queue, walkTask{path: joinPath(node.Path, name), depth: node.Depth + 1, parent: state})
+	}
+	w.cond.Broadcast()
+}
+
+// finish is called once all children of a node are done. It calls fn for a
+// post-order walk and tells the parent.
+func (w *walker) finish(state *walkState) {
+	if w.opts.PostOrder {
+		if err := w.call(state.node); err != nil && err != SkipSubtree {
+			w.fail(err)
+			return
+		}
+	}
+	w.childDone(state.parent)
+}
+
+// childDone records that a child of parent is done, and finishes parent if
+// it was the last one.
+func (w *walker) childDone(parent *walkState) {
+	if parent == nil {
+		return
+	}
+	w.mu.Lock()
+	parent.pending--
+	last := parent.pending == 0
+	w.mu.Unlock()
+	if last {
+		w.finish(parent)
+	}
+}
+
+// fetch reads a node with the requests asked for by the options.
+func (w *walker) fetch(path string, depth int) (*WalkNode, error) {
+	node := &WalkNode{Path: path, Depth: depth}
+	var err error
+	if node.Children, node.Stat, err = w.c.Children(path); err != nil {
+		return nil, err
+	}
+	if w.opts.Data {
+		if node.Data, node.Stat, err = w.c.Get(path); err != nil {
+			return nil, err
+		}
+	}
+	if w.opts.ACL {
+		if node.ACL, _, err = w.c.GetACL(path); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
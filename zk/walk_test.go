@@ -0,0 +1,192 @@
+package zk
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingClient records the highest number of concurrent Children calls.
+type countingClient struct {
+	Client
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (c *countingClient) Children(path string) ([]string, *Stat, error) {
+	c.mu.Lock()
+	c.running++
+	if c.running > c.max {
+		c.max = c.running
+	}
+	c.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	defer func() {
+		c.mu.Lock()
+		c.running--
+		c.mu.Unlock()
+	}()
+	return c.Client.Children(path)
+}
+
+var walkTree = []string{"/r", "/r/a", "/r/a/x", "/r/a/y", "/r/b", "/r/b/z", "/r/c"}
+
+func walkPaths(t *testing.T, c Client, opts *WalkOptions, skip string) []string {
+	t.Helper()
+	var visited []string
+	err := walk(c, "/r", func(node *WalkNode) error {
+		visited = append(visited, node.Path)
+		if node.Path == skip {
+			return SkipSubtree
+		}
+		return nil
+	}, opts)
+	if err != nil {
+		t.Fatalf("walk returned error: %+v", err)
+	}
+	return visited
+}
+
+func TestWalkOrder(t *testing.T) {
+	t.Parallel()
+	f := fakeTree(t, walkTree...)
+	for _, postOrder := range []bool{false, true} {
+		visited := walkPaths(t, f, &WalkOptions{PostOrder: postOrder}, "")
+		index := make(map[string]int)
+		for i, p := range visited {
+			index[p] = i
+		}
+		if len(index) != len(walkTree) || len(visited) != len(walkTree) {
+			t.Fatalf("visited %v; want each of %v once", visited, walkTree)
+		}
+		for _, p := range walkTree[1:] {
+			parent := p[:len(p)-2]
+			if before := index[parent] < index[p]; before == postOrder {
+				t.Errorf("PostOrder=%v: visited %v; %s in the wrong order relative to %s", postOrder, visited, parent, p)
+			}
+		}
+	}
+}
+
+func TestWalkDepthAndSkip(t *testing.T) {
+	t.Parallel()
+	f := fakeTree(t, walkTree...)
+	visited := walkPaths(t, f, &WalkOptions{MaxDepth: 1}, "")
+	sort.Strings(visited)
+	if want := []string{"/r", "/r/a", "/r/b", "/r/c"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("MaxDepth 1 visited %v; want %v", visited, want)
+	}
+
+	visited = walkPaths(t, f, nil, "/r/a")
+	sort.Strings(visited)
+	if want := []string{"/r", "/r/a", "/r/b", "/r/b/z", "/r/c"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("skipping /r/a visited %v; want %v", visited, want)
+	}
+}
+
+func TestWalkFetchesDataAndACL(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+	acl := DigestACL(PermRead, "user", "pass")
+	if _, err := f.Create("/r", []byte("root"), 0, acl); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Create("/r/a", []byte("child"), 0, WorldACL(PermAll)); err != nil {
+		t.Fatal(err)
+	}
+	nodes := make(map[string]*WalkNode)
+	err := walk(f, "/r", func(node *WalkNode) error {
+		nodes[node.Path] = node
+		return nil
+	}, &WalkOptions{Data: true, ACL: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := nodes["/r"]
+	if r == nil || string(r.Data) != "root" || !reflect.DeepEqual(r.ACL, acl) || r.Stat.NumChildren != 1 {
+		t.Errorf("root node = %+v; want data, ACL and Stat", r)
+	}
+	if a := nodes["/r/a"]; a == nil || string(a.Data) != "child" || a.Depth != 1 {
+		t.Errorf("child node = %+v", a)
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+	t.Parallel()
+	f := fakeTree(t, walkTree...)
+
+	// A node deleted after its parent was listed is skipped.
+	f.InjectError("Children", "/r/b", ErrNoNode)
+	visited := walkPaths(t, f, nil, "")
+	sort.Strings(visited)
+	if want := []string{"/r", "/r/a", "/r/a/x", "/r/a/y", "/r/c"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("visited %v; want %v", visited, want)
+	}
+
+	if err := walk(f, "/missing", func(*WalkNode) error { return nil }, nil); !errors.Is(err, ErrNoNode) {
+		t.Errorf("walk of a missing root returned %v; want ErrNoNode", err)
+	}
+
+	f.InjectError("Children", "/r/a", ErrConnectionClosed)
+	if err := walk(f, "/r", func(*WalkNode) error { return nil }, nil); !errors.Is(err, ErrConnectionClosed) {
+		t.Errorf("walk returned %v; want ErrConnectionClosed", err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := walk(f, "/r", func(node *WalkNode) error {
+		calls++
+		return stop
+	}, nil)
+	if err != stop || calls != 1 {
+		t.Errorf("walk returned %v after %d calls; want the callback error after 1 call", err, calls)
+	}
+}
+
+func TestWalkConcurrency(t *testing.T) {
+	t.Parallel()
+	f := NewFakeClient()
+	f.Create("/r", nil, 0, WorldACL(PermAll))
+	for i := 0; i < 20; i++ {
+		f.Create("/r/"+string(rune('a'+i)), nil, 0, WorldACL(PermAll))
+	}
+	c := &countingClient{Client: f}
+	n := 0
+	if err := walk(c, "/r", func(*WalkNode) error { n++; return nil }, &WalkOptions{Concurrency: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if n != 21 {
+		t.Errorf("visited %d nodes; want 21", n)
+	}
+	if c.max > 3 || c.max < 2 {
+		t.Errorf("up to %d concurrent requests; want 2 or 3", c.max)
+	}
+}
+
+func TestWalkWideTreeGoroutines(t *testing.T) {
+	f := NewFakeClient()
+	f.Create("/r", nil, 0, WorldACL(PermAll))
+	for i := 0; i < 200; i++ {
+		f.Create(fmt.Sprintf("/r/%d", i), nil, 0, WorldACL(PermAll))
+	}
+	base := runtime.NumGoroutine()
+	max := 0
+	err := walk(f, "/r", func(*WalkNode) error {
+		if n := runtime.NumGoroutine() - base; n > max {
+			max = n
+		}
+		return nil
+	}, &WalkOptions{Concurrency: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max > 4 {
+		t.Errorf("walk ran %d goroutines for 200 siblings; want at most 4", max)
+	}
+}
@@ -3,6 +3,7 @@ package zk
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -72,7 +73,7 @@ func TestCreate(t *testing.T) {
 	path := "/gozk-test"
 	path2 := path + "2"
 
-	if err := zk.Delete(path, -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete(path, -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 
@@ -130,7 +131,7 @@ func TestMulti(t *testing.T) {
 
 	path := "/gozk-test"
 
-	if err := zk.Delete(path, -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete(path, -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 	ops := []interface{}{
@@ -173,12 +174,12 @@ func TestIfAuthdataSurvivesReconnect(t *testing.T) {
 	acl := DigestACL(PermAll, "userfoo", "passbar")
 
 	_, err = zk.Create(testNode, []byte("Some very secret content"), 0, acl)
-	if err != nil && err != ErrNodeExists {
+	if err != nil && !errors.Is(err, ErrNodeExists) {
 		t.Fatalf("Failed to create test node : %+v", err)
 	}
 
 	_, _, err = zk.Get(testNode)
-	if err == nil || err != ErrNoAuth {
+	if err == nil || !errors.Is(err, ErrNoAuth) {
 		var msg string
 
 		if err == nil {
@@ -224,7 +225,7 @@ func TestMultiFailures(t *testing.T) {
 
 	// Ensure firstPath doesn't exist and secondPath does. This will cause the
 	// 2nd operation in the Multi() to fail.
-	if err := zk.Delete(firstPath, -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete(firstPath, -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 	if _, err := zk.Create(secondPath, nil /* data */, 0, WorldACL(PermAll)); err != nil {
@@ -236,7 +237,7 @@ func TestMultiFailures(t *testing.T) {
 		&CreateRequest{Path: secondPath, Data: []byte{3, 4}, Acl: WorldACL(PermAll)},
 	}
 	res, err := zk.Multi(ops...)
-	if err != ErrNodeExists {
+	if !errors.Is(err, ErrNodeExists) {
 		t.Fatalf("Multi() didn't return correct error: %+v", err)
 	}
 	if len(res) != 2 {
@@ -248,7 +249,7 @@ func TestMultiFailures(t *testing.T) {
 	if res[1].Error != ErrNodeExists {
 		t.Fatalf("Second operation returned incorrect error %+v", res[1].Error)
 	}
-	if _, _, err := zk.Get(firstPath); err != ErrNoNode {
+	if _, _, err := zk.Get(firstPath); !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Node %s was incorrectly created: %+v", firstPath, err)
 	}
 }
@@ -271,7 +272,7 @@ func TestGetSetACL(t *testing.T) {
 
 	path := "/gozk-test"
 
-	if err := zk.Delete(path, -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete(path, -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 	if path, err := zk.Create(path, []byte{1, 2, 3, 4}, 0, WorldACL(PermAll)); err != nil {
@@ -320,7 +321,7 @@ func TestAuth(t *testing.T) {
 	defer zk.Close()
 
 	path := "/gozk-digest-test"
-	if err := zk.Delete(path, -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete(path, -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 
@@ -340,7 +341,7 @@ func TestAuth(t *testing.T) {
 		t.Fatalf("GetACL mismatch expected %+v instead of %+v", acl, a)
 	}
 
-	if _, _, err := zk.Get(path); err != ErrNoAuth {
+	if _, _, err := zk.Get(path); !errors.Is(err, ErrNoAuth) {
 		t.Fatalf("Get returned error %+v instead of ErrNoAuth", err)
 	}
 
@@ -370,7 +371,7 @@ func TestChildren(t *testing.T) {
 	defer zk.Close()
 
 	deleteNode := func(node string) {
-		if err := zk.Delete(node, -1); err != nil && err != ErrNoNode {
+		if err := zk.Delete(node, -1); err != nil && !errors.Is(err, ErrNoNode) {
 			t.Fatalf("Delete returned error: %+v", err)
 		}
 	}
@@ -422,7 +423,7 @@ func TestChildWatch(t *testing.T) {
 	}
 	defer zk.Close()
 
-	if err := zk.Delete("/gozk-test", -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete("/gozk-test", -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 
@@ -464,7 +465,7 @@ func TestChildWatch(t *testing.T) {
 		t.Fatal("Children should return 0 children")
 	}
 
-	if err := zk.Delete("/gozk-test", -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete("/gozk-test", -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 
@@ -501,7 +502,7 @@ func TestSetWatchers(t *testing.T) {
 	}
 	defer zk2.Close()
 
-	if err := zk.Delete("/gozk-test", -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete("/gozk-test", -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 
@@ -526,7 +527,7 @@ func TestSetWatchers(t *testing.T) {
 
 	// Simulate network error by brutally closing the network connection.
 	zk.conn.Close()
-	if err := zk2.Delete(testPath, -1); err != nil && err != ErrNoNode {
+	if err := zk2.Delete(testPath, -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 	// Allow some time for the `zk` session to reconnect and set watches.
@@ -575,7 +576,7 @@ func TestExpiringWatch(t *testing.T) {
 	}
 	defer zk.Close()
 
-	if err := zk.Delete("/gozk-test", -1); err != nil && err != ErrNoNode {
+	if err := zk.Delete("/gozk-test", -1); err != nil && !errors.Is(err, ErrNoNode) {
 		t.Fatalf("Delete returned error: %+v", err)
 	}
 
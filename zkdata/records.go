@@ -0,0 +1,262 @@
+// Package zkdata reads the files ZooKeeper servers write to their data
+// directories: snapshots of the data tree (snapshot.<zxid>) and transaction
+// logs (log.<zxid>). It needs no running server, which makes it useful for
+// post-mortems and for comparing the state of servers.
+//
+// The records are decoded with the jute encoding of the zk package.
+package zkdata
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const (
+	// SnapshotMagic starts every snapshot file ("ZKSN").
+	SnapshotMagic = 0x5a4b534e
+	// TxnLogMagic starts every transaction log file ("ZKLG").
+	TxnLogMagic = 0x5a4b4c47
+)
+
+var (
+	// ErrBadMagic is returned for files that aren't snapshots or
+	// transaction logs, as expected.
+	ErrBadMagic = errors.New("zkdata: bad magic number")
+	// ErrChecksum is returned when the checksum stored in a file doesn't
+	// match its contents.
+	ErrChecksum = errors.New("zkdata: checksum mismatch")
+	// ErrCorrupt is returned when a file doesn't follow the expected
+	// structure.
+	ErrCorrupt = errors.New("zkdata: corrupt file")
+)
+
+// FileHeader starts snapshots and transaction logs.
+type FileHeader struct {
+	Magic   int32
+	Version int32
+	DBID    int64
+}
+
+// StatPersisted is the Stat of a node as stored in a snapshot. Unlike
+// zk.Stat it has no data length and number of children.
+type StatPersisted struct {
+	Czxid          int64
+	Mzxid          int64
+	Ctime          int64
+	Mtime          int64
+	Version        int32
+	Cversion       int32
+	Aversion       int32
+	EphemeralOwner int64
+	Pzxid          int64
+}
+
+// TxnType is the type of a transaction.
+type TxnType int32
+
+// Transaction types, see org.apache.zookeeper.ZooDefs.OpCode.
+const (
+	TxnError           TxnType = -1
+	TxnCreate          TxnType = 1
+	TxnDelete          TxnType = 2
+	TxnSetData         TxnType = 5
+	TxnSetACL          TxnType = 7
+	TxnCheck           TxnType = 13
+	TxnMulti           TxnType = 14
+	TxnCreate2         TxnType = 15
+	TxnReconfig        TxnType = 16
+	TxnCreateContainer TxnType = 19
+	TxnDeleteContainer TxnType = 20
+	TxnCreateTTL       TxnType = 21
+	TxnCreateSession   TxnType = -10
+	TxnCloseSession    TxnType = -11
+)
+
+var txnTypeNames = map[TxnType]string{
+	TxnError:           "error",
+	TxnCreate:          "create",
+	TxnDelete:          "delete",
+	TxnSetData:         "setData",
+	TxnSetACL:          "setACL",
+	TxnCheck:           "check",
+	TxnMulti:           "multi",
+	TxnCreate2:         "create2",
+	TxnReconfig:        "reconfig",
+	TxnCreateContainer: "createContainer",
+	TxnDeleteContainer: "deleteContainer",
+	TxnCreateTTL:       "createTTL",
+	TxnCreateSession:   "createSession",
+	TxnCloseSession:    "closeSession",
+}
+
+func (t TxnType) String() string {
+	if name := txnTypeNames[t]; name != "" {
+		return name
+	}
+	return fmt.Sprintf("txn%d", int32(t))
+}
+
+// TxnHeader starts every transaction.
+type TxnHeader struct {
+	ClientID int64 // Session that issued the request.
+	Cxid     int32 // Xid of the request.
+	Zxid     int64
+	Time     int64 // Milliseconds since the epoch.
+	Type     TxnType
+}
+
+// CreateTxn is the record of TxnCreate and TxnCreate2.
+type CreateTxn struct {
+	Path           string
+	Data           []byte
+	ACL            []zk.ACL
+	Ephemeral      bool
+	ParentCversion int32
+}
+
+// CreateContainerTxn is the record of TxnCreateContainer.
+type CreateContainerTxn struct {
+	Path           string
+	Data           []byte
+	ACL            []zk.ACL
+	ParentCversion int32
+}
+
+// CreateTTLTxn is the record of TxnCreateTTL.
+type CreateTTLTxn struct {
+	Path           string
+	Data           []byte
+	ACL            []zk.ACL
+	ParentCversion int32
+	TTL            int64
+}
+
+// DeleteTxn is the record of TxnDelete and TxnDeleteContainer.
+type DeleteTxn struct {
+	Path string
+}
+
+// SetDataTxn is the record of TxnSetData.
+type SetDataTxn struct {
+	Path    string
+	Data    []byte
+	Version int32
+}
+
+// SetACLTxn is the record of TxnSetACL.
+type SetACLTxn struct {
+	Path    string
+	ACL     []zk.ACL
+	Version int32
+}
+
+// CheckVersionTxn is the record of TxnCheck.
+type CheckVersionTxn struct {
+	Path    string
+	Version int32
+}
+
+// CreateSessionTxn is the record of TxnCreateSession.
+type CreateSessionTxn struct {
+	TimeoutMs int32
+}
+
+// ErrorTxn is the record of TxnError, and of the failed operations of a
+// multi transaction.
+type ErrorTxn struct {
+	Err int32
+}
+
+// MultiTxn is the record of TxnMulti.
+type MultiTxn struct {
+	Ops []SubTxn
+}
+
+// SubTxn is an operation of a multi transaction.
+type SubTxn struct {
+	Type   TxnType
+	Record interface{} // See Txn.Record.
+}
+
+// multiTxn is the jute layout of MultiTxn.
+type multiTxn struct {
+	Txns []struct {
+		Type int32
+		Data []byte
+	}
+}
+
+// newRecord returns a pointer to the record of a transaction type, or nil
+// if the type has no record or isn't known.
+func newRecord(t TxnType) interface{} {
+	switch t {
+	case TxnCreate, TxnCreate2:
+		return &CreateTxn{}
+	case TxnCreateContainer:
+		return &CreateContainerTxn{}
+	case TxnCreateTTL:
+		return &CreateTTLTxn{}
+	case TxnDelete, TxnDeleteContainer:
+		return &DeleteTxn{}
+	case TxnSetData:
+		return &SetDataTxn{}
+	case TxnSetACL:
+		return &SetACLTxn{}
+	case TxnCheck:
+		return &CheckVersionTxn{}
+	case TxnCreateSession:
+		return &CreateSessionTxn{}
+	case TxnError:
+		return &ErrorTxn{}
+	}
+	return nil
+}
+
+// decodeRecord decodes the record of a transaction of type t from buf. It
+// returns the record, nil if t has none, and the number of bytes read.
+func decodeRecord(t TxnType, buf []byte) (interface{}, int, error) {
+	if t == TxnMulti {
+		var m multiTxn
+		n, err := zk.DecodeRecord(buf, &m)
+		if err != nil {
+			return nil, n, err
+		}
+		multi := &MultiTxn{Ops: make([]SubTxn, len(m.Txns))}
+		for i, txn := range m.Txns {
+			sub := SubTxn{Type: TxnType(txn.Type)}
+			if sub.Record, _, err = decodeRecord(sub.Type, txn.Data); err != nil {
+				return nil, n, err
+			}
+			multi.Ops[i] = sub
+		}
+		return multi, n, nil
+	}
+	rec := newRecord(t)
+	if rec == nil {
+		return nil, 0, nil
+	}
+	n, err := zk.DecodeRecord(buf, rec)
+	return rec, n, err
+}
+
+// FileZxid returns the zxid in the name of a snapshot or transaction log
+// file, such as "snapshot.1a2b" or "log.100000001".
+func FileZxid(name string) (int64, bool) {
+	name = filepath.Base(name)
+	i := strings.IndexByte(name, '.')
+	if i < 0 {
+		return 0, false
+	}
+	// Compressed snapshots carry another extension.
+	hex := strings.SplitN(name[i+1:], ".", 2)[0]
+	zxid, err := strconv.ParseUint(hex, 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(zxid), true
+}
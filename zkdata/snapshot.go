@@ -0,0 +1,233 @@
+package zkdata
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// Snapshot is the content of a snapshot file: the sessions and the data
+// tree of a server at some zxid. Transactions logged after the snapshot was
+// started may already be applied to it, so it is only consistent once
+// replayed with the logs from its zxid on.
+type Snapshot struct {
+	Header   FileHeader
+	Sessions []Session
+	// ACLs is the ACL cache: the ACL lists of the nodes, referenced by
+	// Node.ACLRef.
+	ACLs   map[int64][]zk.ACL
+	Nodes  []*Node // Parents come before their children.
+	Digest *Digest // Set by servers with digests enabled (3.6 and later).
+
+	byPath map[string]*Node
+}
+
+// Session is a session open when the snapshot was taken.
+type Session struct {
+	ID        int64
+	TimeoutMs int32
+}
+
+// Node is a node of the data tree.
+type Node struct {
+	Path   string
+	Data   []byte
+	ACLRef int64 // Key of the ACL list in Snapshot.ACLs, -1 for the open ACL.
+	Stat   StatPersisted
+}
+
+// Digest is the digest of the data tree written after it.
+type Digest struct {
+	Zxid    int64
+	Version int32
+	Value   int64
+}
+
+// Node returns the node at path, or nil if there is none.
+func (s *Snapshot) Node(path string) *Node {
+	return s.byPath[path]
+}
+
+// Children returns the names of the children of path.
+func (s *Snapshot) Children(path string) []string {
+	var names []string
+	prefix := path + "/"
+	if path == "/" {
+		prefix = "/"
+	}
+	for _, n := range s.Nodes {
+		if rest := strings.TrimPrefix(n.Path, prefix); rest != n.Path && rest != "" && !strings.Contains(rest, "/") {
+			names = append(names, rest)
+		}
+	}
+	return names
+}
+
+// ACL returns the ACL list of n.
+func (s *Snapshot) ACL(n *Node) []zk.ACL {
+	if n.ACLRef == -1 {
+		return zk.WorldACL(zk.PermAll)
+	}
+	return s.ACLs[n.ACLRef]
+}
+
+// ReadSnapshotFile reads a snapshot file, which may be gzip compressed.
+func ReadSnapshotFile(name string) (*Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
+
+// ReadSnapshot reads a snapshot, which may be gzip compressed. If the
+// checksum doesn't match, the decoded snapshot is returned along with an
+// error wrapping ErrChecksum, so that damaged files can still be inspected.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshot(buf)
+}
+
+// snapshotDecoder decodes the records of a snapshot in sequence.
+type snapshotDecoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *snapshotDecoder) decode(v interface{}) {
+	if d.err != nil {
+		return
+	}
+	n, err := zk.DecodeRecord(d.buf[d.off:], v)
+	d.off += n
+	if err != nil {
+		d.err = fmt.Errorf("zkdata: at offset %d: %w", d.off, err)
+	}
+}
+
+func (d *snapshotDecoder) int32() int32 {
+	var v struct{ V int32 }
+	d.decode(&v)
+	return v.V
+}
+
+func (d *snapshotDecoder) string() string {
+	var v struct{ V string }
+	d.decode(&v)
+	return v.V
+}
+
+// sealSize is the encoded size of a seal: a checksum and the path "/".
+const sealSize = 8 + 4 + 1
+
+// seal decodes a seal and checks its checksum against everything before
+// it. A mismatch is returned rather than stored in d.err, so that decoding
+// can go on.
+func (d *snapshotDecoder) seal() error {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf)-d.off < sealSize {
+		d.err = fmt.Errorf("%w: truncated seal at offset %d", ErrCorrupt, d.off)
+		return nil
+	}
+	sum := adler32.Checksum(d.buf[:d.off])
+	var stored struct{ V int64 }
+	d.decode(&stored)
+	if path := d.string(); d.err == nil && path != "/" {
+		d.err = fmt.Errorf("%w: seal at offset %d ends with %q", ErrCorrupt, d.off, path)
+	}
+	if d.err == nil && uint64(stored.V) != uint64(sum) {
+		return fmt.Errorf("%w: stored 0x%x, computed 0x%x", ErrChecksum, stored.V, sum)
+	}
+	return nil
+}
+
+func parseSnapshot(buf []byte) (*Snapshot, error) {
+	d := &snapshotDecoder{buf: buf}
+	s := &Snapshot{ACLs: make(map[int64][]zk.ACL), byPath: make(map[string]*Node)}
+
+	d.decode(&s.Header)
+	if d.err == nil && s.Header.Magic != SnapshotMagic {
+		return nil, ErrBadMagic
+	}
+
+	count := d.int32()
+	for i := int32(0); i < count && d.err == nil; i++ {
+		var sess Session
+		d.decode(&sess)
+		s.Sessions = append(s.Sessions, sess)
+	}
+
+	count = d.int32()
+	for i := int32(0); i < count && d.err == nil; i++ {
+		var entry struct {
+			Ref  int64
+			ACLs []zk.ACL
+		}
+		d.decode(&entry)
+		s.ACLs[entry.Ref] = entry.ACLs
+	}
+
+	// The nodes end with the path "/". The root itself is stored as "".
+	for d.err == nil {
+		path := d.string()
+		if path == "/" || d.err != nil {
+			break
+		}
+		n := &Node{Path: path}
+		if n.Path == "" {
+			n.Path = "/"
+		}
+		var node struct {
+			Data   []byte
+			ACLRef int64
+			Stat   StatPersisted
+		}
+		d.decode(&node)
+		n.Data, n.ACLRef, n.Stat = node.Data, node.ACLRef, node.Stat
+		s.Nodes = append(s.Nodes, n)
+		s.byPath[n.Path] = n
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	// The data tree is sealed with the checksum of everything before it and
+	// the path "/". Servers with digests enabled then write the digest,
+	// sealed the same way.
+	sumErr := d.seal()
+	if d.err == nil && d.off < len(buf) {
+		s.Digest = &Digest{}
+		d.decode(s.Digest)
+		if err := d.seal(); sumErr == nil {
+			sumErr = err
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return s, sumErr
+}
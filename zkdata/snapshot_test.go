@@ -0,0 +1,175 @@
+package zkdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"hash/adler32"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// juteWriter builds test files with the jute encoding.
+type juteWriter struct {
+	t   *testing.T
+	buf []byte
+}
+
+func (w *juteWriter) write(records ...interface{}) {
+	w.t.Helper()
+	b := make([]byte, 1<<16)
+	for _, r := range records {
+		n, err := zk.EncodeRecord(b, r)
+		if err != nil {
+			w.t.Fatalf("EncodeRecord(%#v) returned error: %v", r, err)
+		}
+		w.buf = append(w.buf, b[:n]...)
+	}
+}
+
+type juteInt32 struct{ V int32 }
+type juteInt64 struct{ V int64 }
+type juteString struct{ V string }
+
+var testACL = zk.DigestACL(zk.PermAll, "user", "pass")
+
+func writeSnapshot(t *testing.T, digest bool) []byte {
+	w := &juteWriter{t: t}
+	w.write(&FileHeader{Magic: SnapshotMagic, Version: 2, DBID: -1})
+	w.write(&juteInt32{1}, &Session{ID: 0x100, TimeoutMs: 30000})
+	w.write(&juteInt32{1}, &struct {
+		Ref  int64
+		ACLs []zk.ACL
+	}{1, testACL})
+	for _, n := range []struct {
+		path string
+		data []byte
+		ref  int64
+		stat StatPersisted
+	}{
+		{"", nil, -1, StatPersisted{Cversion: 2}},
+		{"/zookeeper", nil, -1, StatPersisted{}},
+		{"/app", []byte("hello"), 1, StatPersisted{Czxid: 2, Mzxid: 3, Version: 1}},
+		{"/app/eph", nil, -1, StatPersisted{Czxid: 4, EphemeralOwner: 0x100}},
+	} {
+		w.write(&juteString{n.path}, &struct {
+			Data []byte
+			Ref  int64
+			Stat StatPersisted
+		}{n.data, n.ref, n.stat})
+	}
+	w.write(&juteString{"/"})
+	w.write(&juteInt64{int64(adler32.Checksum(w.buf))}, &juteString{"/"})
+	if digest {
+		w.write(&Digest{Zxid: 4, Version: 2, Value: 0x1234})
+		w.write(&juteInt64{int64(adler32.Checksum(w.buf))}, &juteString{"/"})
+	}
+	return w.buf
+}
+
+func TestReadSnapshot(t *testing.T) {
+	t.Parallel()
+	s, err := ReadSnapshot(bytes.NewReader(writeSnapshot(t, false)))
+	if err != nil {
+		t.Fatalf("ReadSnapshot returned error: %+v", err)
+	}
+	if s.Header.Magic != SnapshotMagic || s.Header.Version != 2 {
+		t.Errorf("header = %+v", s.Header)
+	}
+	if want := []Session{{ID: 0x100, TimeoutMs: 30000}}; !reflect.DeepEqual(s.Sessions, want) {
+		t.Errorf("sessions = %+v; want %+v", s.Sessions, want)
+	}
+	if len(s.Nodes) != 4 || s.Nodes[0].Path != "/" {
+		t.Fatalf("nodes = %+v; want 4 starting with the root", s.Nodes)
+	}
+	app := s.Node("/app")
+	if app == nil || string(app.Data) != "hello" || app.Stat.Version != 1 {
+		t.Fatalf("/app = %+v", app)
+	}
+	if acl := s.ACL(app); !reflect.DeepEqual(acl, testACL) {
+		t.Errorf("ACL of /app = %v; want %v", acl, testACL)
+	}
+	if acl := s.ACL(s.Node("/")); !reflect.DeepEqual(acl, zk.WorldACL(zk.PermAll)) {
+		t.Errorf("ACL of / = %v; want the open ACL", acl)
+	}
+	if owner := s.Node("/app/eph").Stat.EphemeralOwner; owner != 0x100 {
+		t.Errorf("ephemeral owner = 0x%x; want 0x100", owner)
+	}
+	children := s.Children("/")
+	sort.Strings(children)
+	if want := []string{"app", "zookeeper"}; !reflect.DeepEqual(children, want) {
+		t.Errorf("children of / = %v; want %v", children, want)
+	}
+	if children := s.Children("/app"); !reflect.DeepEqual(children, []string{"eph"}) {
+		t.Errorf("children of /app = %v; want [eph]", children)
+	}
+	if s.Digest != nil {
+		t.Errorf("digest = %+v; want none", s.Digest)
+	}
+}
+
+func TestReadSnapshotDigestAndGzip(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(writeSnapshot(t, true))
+	gz.Close()
+	s, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("ReadSnapshot returned error: %+v", err)
+	}
+	if want := (&Digest{Zxid: 4, Version: 2, Value: 0x1234}); !reflect.DeepEqual(s.Digest, want) {
+		t.Errorf("digest = %+v; want %+v", s.Digest, want)
+	}
+
+	// The second seal covers the digest.
+	b := writeSnapshot(t, true)
+	b[len(b)-sealSize-1] ^= 1
+	if _, err := ReadSnapshot(bytes.NewReader(b)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("ReadSnapshot with a damaged digest returned %v; want ErrChecksum", err)
+	}
+}
+
+func TestReadSnapshotDamaged(t *testing.T) {
+	t.Parallel()
+	b := writeSnapshot(t, false)
+	i := bytes.Index(b, []byte("hello"))
+	b[i] = 'j'
+	s, err := ReadSnapshot(bytes.NewReader(b))
+	if !errors.Is(err, ErrChecksum) {
+		t.Errorf("ReadSnapshot returned %v; want ErrChecksum", err)
+	}
+	if s == nil || string(s.Node("/app").Data) != "jello" {
+		t.Error("the snapshot wasn't returned along with the checksum error")
+	}
+
+	if _, err := ReadSnapshot(bytes.NewReader(b[:i])); !errors.Is(err, zk.ErrShortBuffer) {
+		t.Errorf("ReadSnapshot of a truncated file returned %v; want ErrShortBuffer", err)
+	}
+
+	b[0] = 0
+	if _, err := ReadSnapshot(bytes.NewReader(b)); err != ErrBadMagic {
+		t.Errorf("ReadSnapshot returned %v; want ErrBadMagic", err)
+	}
+}
+
+func TestFileZxid(t *testing.T) {
+	t.Parallel()
+	for name, want := range map[string]int64{
+		"snapshot.1a2b":          0x1a2b,
+		"/data/version-2/log.10": 0x10,
+		"snapshot.ff.snappy":     0xff,
+	} {
+		if zxid, ok := FileZxid(name); !ok || zxid != want {
+			t.Errorf("FileZxid(%q) = (0x%x, %v); want 0x%x", name, zxid, ok, want)
+		}
+	}
+	for _, name := range []string{"myid", "snapshot.xyz"} {
+		if _, ok := FileZxid(name); ok {
+			t.Errorf("FileZxid(%q) succeeded", name)
+		}
+	}
+}
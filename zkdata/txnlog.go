@@ -0,0 +1,193 @@
+package zkdata
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"os"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// endOfRecord follows every transaction in a log.
+const endOfRecord = 0x42
+
+// DefaultMaxTxnLength is the default limit of TxnLogReader.MaxLength. It
+// matches the default jute.maxbuffer of the server, which rejects longer
+// transactions, plus room for the transaction header.
+const DefaultMaxTxnLength = 0xfffff + 1024
+
+// Txn is a transaction of a log.
+type Txn struct {
+	Header TxnHeader
+	// Record is a pointer to one of the *Txn types of this package that
+	// matches Header.Type, or nil for types without a record, such as
+	// TxnCloseSession, and unknown ones.
+	Record interface{}
+	// Digest of the data tree after the transaction, set by servers with
+	// digests enabled (3.6 and later).
+	Digest *TxnDigest
+	// Raw holds the bytes that weren't decoded: everything after the
+	// header for unknown types, or what follows the record if it isn't a
+	// digest.
+	Raw []byte
+}
+
+// txnDigestSize is the encoded size of a TxnDigest.
+const txnDigestSize = 4 + 8
+
+// TxnDigest is the digest of the data tree logged after a transaction.
+type TxnDigest struct {
+	Version int32
+	Value   int64
+}
+
+// TxnLogReader reads the transactions of a log.
+type TxnLogReader struct {
+	Header FileHeader
+	// MaxLength bounds the length of a transaction, so that a damaged length
+	// doesn't cause a huge allocation. DefaultMaxTxnLength if zero; raise it
+	// for servers with a larger jute.maxbuffer.
+	MaxLength int
+
+	r      *bufio.Reader
+	offset int64
+}
+
+// OpenTxnLog opens a transaction log file. The caller must close the
+// returned file once done with the reader.
+func OpenTxnLog(name string) (*TxnLogReader, *os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := NewTxnLogReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return r, f, nil
+}
+
+// NewTxnLogReader reads the header of a transaction log from r and returns
+// a reader for its transactions.
+func NewTxnLogReader(r io.Reader) (*TxnLogReader, error) {
+	lr := &TxnLogReader{r: bufio.NewReader(r)}
+	buf := make([]byte, 16)
+	if err := lr.read(buf); err != nil {
+		return nil, err
+	}
+	if _, err := zk.DecodeRecord(buf, &lr.Header); err != nil {
+		return nil, err
+	}
+	if lr.Header.Magic != TxnLogMagic {
+		return nil, ErrBadMagic
+	}
+	return lr, nil
+}
+
+func (lr *TxnLogReader) read(buf []byte) error {
+	n, err := io.ReadFull(lr.r, buf)
+	lr.offset += int64(n)
+	return err
+}
+
+// Next returns the next transaction, and io.EOF at the end of the log. Logs
+// are preallocated, so the end is where the zero padding starts. If the
+// checksum of a transaction doesn't match, Next returns it along with an
+// error wrapping ErrChecksum, so that damaged logs can still be inspected;
+// reading may go on after such an error.
+func (lr *TxnLogReader) Next() (*Txn, error) {
+	var hdr [12]byte
+	if err := lr.read(hdr[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: truncated transaction at offset %d", ErrCorrupt, lr.offset)
+	}
+	crc := binary.BigEndian.Uint64(hdr[:8])
+	length := int32(binary.BigEndian.Uint32(hdr[8:]))
+	if crc == 0 && length == 0 {
+		return nil, io.EOF
+	}
+	maxLength := lr.MaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxTxnLength
+	}
+	if length <= 0 || int(length) > maxLength {
+		return nil, fmt.Errorf("%w: transaction length %d at offset %d", ErrCorrupt, length, lr.offset)
+	}
+
+	start := lr.offset
+	buf := make([]byte, int(length)+1)
+	if err := lr.read(buf); err != nil {
+		return nil, fmt.Errorf("%w: truncated transaction at offset %d", ErrCorrupt, start)
+	}
+	if buf[length] != endOfRecord {
+		return nil, fmt.Errorf("%w: missing end of record at offset %d", ErrCorrupt, lr.offset-1)
+	}
+	buf = buf[:length]
+
+	txn, err := parseTxn(buf)
+	if err != nil {
+		return nil, fmt.Errorf("zkdata: transaction at offset %d: %w", start, err)
+	}
+	if sum := adler32.Checksum(buf); uint64(sum) != crc {
+		return txn, fmt.Errorf("%w: zxid 0x%x: stored 0x%x, computed 0x%x", ErrChecksum, txn.Header.Zxid, crc, sum)
+	}
+	return txn, nil
+}
+
+// ReadTxnLogFile reads all the transactions of a log file. It stops at the
+// first error; the transactions read until then are returned along with it.
+func ReadTxnLogFile(name string) (FileHeader, []*Txn, error) {
+	lr, f, err := OpenTxnLog(name)
+	if err != nil {
+		return FileHeader{}, nil, err
+	}
+	defer f.Close()
+	var txns []*Txn
+	for {
+		txn, err := lr.Next()
+		if err == io.EOF {
+			return lr.Header, txns, nil
+		} else if err != nil {
+			if txn != nil {
+				txns = append(txns, txn)
+			}
+			return lr.Header, txns, err
+		}
+		txns = append(txns, txn)
+	}
+}
+
+func parseTxn(buf []byte) (*Txn, error) {
+	txn := &Txn{}
+	n, err := zk.DecodeRecord(buf, &txn.Header)
+	if err != nil {
+		return nil, err
+	}
+	rec, m, err := decodeRecord(txn.Header.Type, buf[n:])
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil && txn.Header.Type != TxnCloseSession {
+		txn.Raw = buf[n:]
+		return txn, nil
+	}
+	txn.Record = rec
+	n += m
+
+	switch rest := buf[n:]; len(rest) {
+	case 0:
+	case txnDigestSize:
+		txn.Digest = &TxnDigest{}
+		if _, err := zk.DecodeRecord(rest, txn.Digest); err != nil {
+			return nil, err
+		}
+	default:
+		txn.Raw = rest
+	}
+	return txn, nil
+}
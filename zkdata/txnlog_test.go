@@ -0,0 +1,153 @@
+package zkdata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/adler32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testTxn struct {
+	typ     TxnType
+	records []interface{}
+}
+
+func encode(t *testing.T, records ...interface{}) []byte {
+	w := &juteWriter{t: t}
+	w.write(records...)
+	return w.buf
+}
+
+func writeTxnLog(t *testing.T, txns []testTxn) []byte {
+	w := &juteWriter{t: t}
+	w.write(&FileHeader{Magic: TxnLogMagic, Version: 2, DBID: 0})
+	for i, txn := range txns {
+		body := encode(t, &TxnHeader{ClientID: 0x100, Cxid: int32(i), Zxid: int64(i + 1), Time: 1000, Type: txn.typ})
+		if len(txn.records) > 0 {
+			body = append(body, encode(t, txn.records...)...)
+		}
+		w.write(&juteInt64{int64(adler32.Checksum(body))}, &struct{ B []byte }{body})
+		w.buf = append(w.buf, endOfRecord)
+	}
+	// Preallocated space.
+	return append(w.buf, make([]byte, 64)...)
+}
+
+func testLog(t *testing.T) []byte {
+	multi := &multiTxn{}
+	multi.Txns = append(multi.Txns, struct {
+		Type int32
+		Data []byte
+	}{int32(TxnCreate), encode(t, &CreateTxn{Path: "/m", Data: []byte("x"), ACL: testACL})}, struct {
+		Type int32
+		Data []byte
+	}{int32(TxnDelete), encode(t, &DeleteTxn{Path: "/old"})})
+	return writeTxnLog(t, []testTxn{
+		{TxnCreateSession, []interface{}{&CreateSessionTxn{TimeoutMs: 30000}}},
+		{TxnCreate, []interface{}{&CreateTxn{Path: "/a", Data: []byte("data"), ACL: testACL, Ephemeral: true, ParentCversion: 1}}},
+		{TxnSetData, []interface{}{&SetDataTxn{Path: "/a", Data: []byte("new"), Version: 1}, &TxnDigest{Version: 2, Value: 7}}},
+		{TxnMulti, []interface{}{multi}},
+		{TxnCloseSession, nil},
+	})
+}
+
+func TestTxnLogReader(t *testing.T) {
+	t.Parallel()
+	lr, err := NewTxnLogReader(bytes.NewReader(testLog(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txns []*Txn
+	for {
+		txn, err := lr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next returned error: %+v", err)
+		}
+		txns = append(txns, txn)
+	}
+	if len(txns) != 5 {
+		t.Fatalf("read %d transactions; want 5", len(txns))
+	}
+
+	if rec, ok := txns[0].Record.(*CreateSessionTxn); !ok || rec.TimeoutMs != 30000 {
+		t.Errorf("createSession record = %#v", txns[0].Record)
+	}
+	want := &CreateTxn{Path: "/a", Data: []byte("data"), ACL: testACL, Ephemeral: true, ParentCversion: 1}
+	if !reflect.DeepEqual(txns[1].Record, want) {
+		t.Errorf("create record = %#v; want %#v", txns[1].Record, want)
+	}
+	if h := txns[1].Header; h.Type != TxnCreate || h.Zxid != 2 || h.ClientID != 0x100 {
+		t.Errorf("create header = %+v", h)
+	}
+	if rec, ok := txns[2].Record.(*SetDataTxn); !ok || string(rec.Data) != "new" {
+		t.Errorf("setData record = %#v", txns[2].Record)
+	}
+	if d := txns[2].Digest; d == nil || d.Value != 7 {
+		t.Errorf("setData digest = %+v; want value 7", d)
+	}
+	multi, ok := txns[3].Record.(*MultiTxn)
+	if !ok || len(multi.Ops) != 2 {
+		t.Fatalf("multi record = %#v", txns[3].Record)
+	}
+	if create, ok := multi.Ops[0].Record.(*CreateTxn); !ok || create.Path != "/m" || multi.Ops[0].Type != TxnCreate {
+		t.Errorf("first multi op = %#v", multi.Ops[0])
+	}
+	if del, ok := multi.Ops[1].Record.(*DeleteTxn); !ok || del.Path != "/old" {
+		t.Errorf("second multi op = %#v", multi.Ops[1])
+	}
+	if txns[4].Header.Type != TxnCloseSession || txns[4].Record != nil {
+		t.Errorf("closeSession = %+v", txns[4])
+	}
+	if s := txns[3].Header.Type.String(); s != "multi" {
+		t.Errorf("TxnMulti.String() = %q", s)
+	}
+}
+
+func TestTxnLogDamaged(t *testing.T) {
+	t.Parallel()
+	b := testLog(t)
+	i := bytes.Index(b, []byte("data"))
+	b[i] = 'D'
+	name := filepath.Join(t.TempDir(), "log.1")
+	if err := os.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hdr, txns, err := ReadTxnLogFile(name)
+	if !errors.Is(err, ErrChecksum) {
+		t.Fatalf("ReadTxnLogFile returned %v; want ErrChecksum", err)
+	}
+	if hdr.Magic != TxnLogMagic || len(txns) != 2 {
+		t.Errorf("read header %+v and %d transactions; want 2 up to the damaged one", hdr, len(txns))
+	}
+
+	lr, err := NewTxnLogReader(bytes.NewReader(b[:i]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lr.Next()
+	if _, err := lr.Next(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Next on a truncated log returned %v; want ErrCorrupt", err)
+	}
+
+	// A damaged length is rejected before anything is allocated for it.
+	b = testLog(t)
+	binary.BigEndian.PutUint32(b[16+8:], 0x7fffffff)
+	if lr, err = NewTxnLogReader(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lr.Next(); !errors.Is(err, ErrCorrupt) || !strings.Contains(err.Error(), "length") {
+		t.Errorf("Next with a huge length returned %v; want ErrCorrupt for the length", err)
+	}
+
+	if _, err := NewTxnLogReader(bytes.NewReader(encode(t, &FileHeader{Magic: SnapshotMagic}))); err != ErrBadMagic {
+		t.Errorf("NewTxnLogReader returned %v; want ErrBadMagic", err)
+	}
+}